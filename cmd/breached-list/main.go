@@ -0,0 +1,130 @@
+// Command breached-list builds the breached password list of password.breached_list
+// from the Pwned Passwords SHA-1 list ordered by hash, or from a file of passwords:
+//
+//	breached-list -pwned=pwned-passwords-sha1-ordered-by-hash-v8.txt -min-count=10 -out=breached.bin
+//	breached-list -passwords=passwords.txt -out=breached.bin
+//
+// The Pwned Passwords list is converted line by line, so it is never held in memory.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/breached"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	var pwned, passwords, out string
+	var minCount int
+
+	flag.StringVar(&pwned, "pwned", "", "Pwned Passwords SHA-1 list ordered by hash, with HASH:COUNT lines")
+	flag.StringVar(&passwords, "passwords", "", "file with a password per line")
+	flag.IntVar(&minCount, "min-count", 1, "skip Pwned Passwords seen fewer times than this")
+	flag.StringVar(&out, "out", "breached.bin", "path of the list to write")
+	flag.Parse()
+
+	if (pwned == "") == (passwords == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		fail(err)
+	}
+	w := bufio.NewWriter(f)
+	list := breached.NewWriter(w)
+
+	if pwned != "" {
+		err = fromPwned(list, pwned, minCount)
+	} else {
+		err = fromPasswords(list, passwords)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	if err := w.Flush(); err != nil {
+		fail(err)
+	}
+	if err := f.Close(); err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("wrote %d hashes to %s\n", list.Len(), out)
+}
+
+func fromPwned(list *breached.Writer, path string, minCount int) error {
+	return eachLine(path, func(n int, line string) error {
+		hash, count, _ := strings.Cut(line, ":")
+		if c, err := strconv.Atoi(strings.TrimSpace(count)); err == nil && c < minCount {
+			return nil
+		}
+
+		h, err := breached.ParseSHA1(hash)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+
+		if err := list.Add(h); err != nil {
+			return fmt.Errorf("line %d: %w, use the list ordered by hash", n, err)
+		}
+		return nil
+	})
+}
+
+func fromPasswords(list *breached.Writer, path string) error {
+	var hashes []uint64
+	err := eachLine(path, func(_ int, line string) error {
+		hashes = append(hashes, breached.Hash(line))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(hashes)
+	for _, hash := range hashes {
+		if err := list.Add(hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func eachLine(path string, fn func(n int, line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			if err := fn(n, line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,81 @@
+// Command service-account manages service accounts and their API keys:
+//
+//	service-account -create-account=clubs
+//	service-account -create-key=clubs -scopes=users:read,roles:check -ttl=8760h
+//	service-account -revoke-key=<prefix>
+//
+// The API key is printed once on creation and cannot be recovered afterwards.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/serviceaccount"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage/postgresql"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	var databaseDSN, createAccount, createKey, scopes, revokeKey string
+	var ttl time.Duration
+
+	flag.StringVar(&databaseDSN, "database-dsn", os.Getenv("DATABASE_DSN"), "PostgreSQL database URL")
+	flag.StringVar(&createAccount, "create-account", "", "name of the service account to create")
+	flag.StringVar(&createKey, "create-key", "", "name of the service account to create an API key for")
+	flag.StringVar(&scopes, "scopes", "", "comma separated scopes of the new API key")
+	flag.DurationVar(&ttl, "ttl", 0, "lifetime of the new API key, zero for no expiry")
+	flag.StringVar(&revokeKey, "revoke-key", "", "prefix of the API key to revoke")
+	flag.Parse()
+
+	err := validation.Validate(databaseDSN, validation.Required)
+	if err != nil {
+		fail(fmt.Errorf("database-dsn: %w", err))
+	}
+
+	postgres, err := postgresql.New(databaseDSN, config.Postgres{})
+	if err != nil {
+		fail(err)
+	}
+	defer postgres.Close()
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	accounts := serviceaccount.New(log, postgres)
+	ctx := context.Background()
+
+	switch {
+	case createAccount != "":
+		account, err := accounts.CreateServiceAccount(ctx, createAccount)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("created service account %q (id %d)\n", account.Name, account.ID)
+	case createKey != "":
+		key, apiKey, err := accounts.CreateAPIKey(ctx, createKey, strings.Split(scopes, ","), ttl)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("created api key %s for %q with scopes %s\n", apiKey.Prefix, apiKey.ServiceAccountName, strings.Join(apiKey.Scopes, ","))
+		fmt.Println("store the key now, it will not be shown again:")
+		fmt.Println(key)
+	case revokeKey != "":
+		err := accounts.RevokeAPIKey(ctx, revokeKey)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("revoked api key %s\n", revokeKey)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/app"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
 	"log/slog"
@@ -28,6 +29,16 @@ func main() {
 
 	application := app.New(log, cfg)
 	go application.GRPCSrv.MustRun()
+	go application.HTTPSrv.MustRun()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if application.Tokens != nil {
+		go application.Tokens.RunKeyRotation(ctx)
+	}
+	go application.Roles.RunExpiry(ctx)
+	go application.Impersonations.RunExpiry(ctx)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
@@ -36,6 +47,7 @@ func main() {
 
 	log.Info("stopping application", slog.String("signal", sign.String()))
 	application.GRPCSrv.Stop()
+	application.HTTPSrv.Stop(context.Background())
 
 	log.Info("application stopped")
 
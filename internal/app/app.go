@@ -2,31 +2,65 @@ package app
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	grpcapp "github.com/ARUMANDESU/uniclubs-user-service/internal/app/grpc"
+	httpapp "github.com/ARUMANDESU/uniclubs-user-service/internal/app/http"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/clients/image"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/rabbitmq"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/invitation"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/ldap"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/management"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/mfa"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/oidc"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/password"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/permission"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/registration"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/role"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/serviceaccount"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/token"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage/postgresql"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage/redis"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/hasher"
 	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/secretbox"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"log/slog"
 )
 
 type App struct {
 	GRPCSrv *grpcapp.App
+	// HTTPSrv serves the metrics, and the OpenID Connect provider and the SSO login
+	// when they are enabled.
+	HTTPSrv *httpapp.App
+	// Tokens is nil when signed access tokens are disabled.
+	Tokens         *token.Tokens
+	Roles          *role.Roles
+	Impersonations *auth.Impersonations
 }
 
 func New(log *slog.Logger, cfg *config.Config) *App {
 	const op = "App.New"
 	l := log.With(slog.String("op", op))
 
-	postgres, err := postgresql.New(cfg.DatabaseDSN)
+	postgres, err := postgresql.New(cfg.DatabaseDSN, cfg.Postgres)
 	if err != nil {
 		l.Error("failed to connect to postgresql", logger.Err(err))
 		panic(err)
 	}
+	roleNames, err := postgres.GetRoleNames(context.Background())
+	if err != nil {
+		l.Error("failed to get roles", logger.Err(err))
+		panic(err)
+	}
+	if err := domain.CheckRoles(roleNames); err != nil {
+		l.Error("roles in the database do not match the protobuf roles", logger.Err(err))
+		panic(err)
+	}
+
 	redisStrg, err := redis.New(cfg.RedisURL)
 	if err != nil {
 		l.Error("failed to connect to redis", logger.Err(err))
@@ -45,10 +79,193 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 		panic(err)
 	}
 
-	authService := auth.New(log, postgres, redisStrg, redisStrg, rmq)
-	managementService := management.New(log, postgres, imageClient, rmq)
+	userStorage := redis.NewUserCache(log, redisStrg, postgres, cfg.Cache.UserTTL)
+
+	var secretBox *secretbox.Box
+	if cfg.MFA.EncryptionKey != "" {
+		secretBox, err = newSecretBox(cfg.MFA.EncryptionKey)
+		if err != nil {
+			l.Error("invalid mfa encryption key", logger.Err(err))
+			panic(err)
+		}
+	}
+	mfaService := mfa.New(log, postgres, userStorage, secretBox, cfg.MFA.Issuer)
+
+	oldPeppers := make([][]byte, 0, len(cfg.PasswordHash.OldPeppers))
+	for _, pepper := range cfg.PasswordHash.OldPeppers {
+		oldPeppers = append(oldPeppers, []byte(pepper))
+	}
+	passwordHasher, err := hasher.New(hasher.Params{
+		Memory:      cfg.PasswordHash.Memory,
+		Iterations:  cfg.PasswordHash.Iterations,
+		Parallelism: cfg.PasswordHash.Parallelism,
+		SaltLength:  cfg.PasswordHash.SaltLength,
+		KeyLength:   cfg.PasswordHash.KeyLength,
+	}, []byte(cfg.PasswordHash.Pepper), oldPeppers...)
+	if err != nil {
+		l.Error("invalid password hash config", logger.Err(err))
+		panic(err)
+	}
+
+	authenticators := []auth.Authenticator{auth.NewPasswordAuthenticator(log, userStorage, passwordHasher)}
+	if cfg.LDAP.Enabled {
+		ldapAuthenticator, err := ldap.New(log, userStorage, postgres, cfg.LDAP)
+		if err != nil {
+			l.Error("invalid ldap config", logger.Err(err))
+			panic(err)
+		}
+		authenticators = append(authenticators, ldapAuthenticator)
+	}
+
+	registrationPolicy, err := registration.New(cfg.Registration)
+	if err != nil {
+		l.Error("invalid registration config", logger.Err(err))
+		panic(err)
+	}
+	passwordPolicy, err := password.New(cfg.Password)
+	if err != nil {
+		l.Error("invalid password config", logger.Err(err))
+		panic(err)
+	}
+	invitations := invitation.New(log, postgres)
 
-	grpcApp := grpcapp.New(log, cfg.GRPC.Port, authService, managementService)
+	// sessions and activation tokens are looked up by the token the caller sends,
+	// so they must not share a prefix with any other key
+	sessions := redisStrg.WithPrefix("session:")
+
+	authService := auth.New(
+		log,
+		userStorage,
+		sessions,
+		redisStrg.WithPrefix("activation:"),
+		redisStrg,
+		redisStrg,
+		authenticators,
+		mfaService,
+		redisStrg.WithPrefix("mfa_challenge:"),
+		redisStrg.WithPrefix("magic_link:"),
+		redisStrg.WithPrefix("login:"),
+		redisStrg.WithPrefix("magic_link_requests:"),
+		registrationPolicy,
+		passwordPolicy,
+		passwordHasher,
+		invitations,
+		rmq,
+		cfg.Phone,
+		cfg.MFA,
+		cfg.Login,
+	)
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+	})
+	if err != nil {
+		l.Error("invalid webauthn config", logger.Err(err))
+		panic(err)
+	}
+	passkeys := auth.NewPasskeys(
+		log,
+		authService,
+		webAuthn,
+		postgres,
+		redisStrg.WithPrefix("webauthn:"),
+		cfg.WebAuthn.CeremonyTTL,
+	)
+
+	managementService := management.New(log, userStorage, imageClient, rmq)
+
+	var tokenService *token.Tokens
+	if cfg.Tokens.Enabled {
+		tokenBox, err := newSecretBox(cfg.Tokens.EncryptionKey)
+		if err != nil {
+			l.Error("invalid tokens encryption key", logger.Err(err))
+			panic(err)
+		}
+		tokenService = token.New(log, postgres, redisStrg, sessions, userStorage, rmq, tokenBox, cfg.Tokens)
+		if err := tokenService.RotateKeys(context.Background()); err != nil {
+			l.Error("failed to load signing keys", logger.Err(err))
+			panic(err)
+		}
+	}
+
+	serviceAccounts := serviceaccount.New(log, postgres)
+
+	permissionService := permission.New(
+		log,
+		userStorage,
+		redis.NewPermissionCache(log, redisStrg, postgres, cfg.Cache.PermissionsTTL),
+	)
+	roleService := role.New(log, postgres, rmq, cfg.Roles)
+	impersonations := auth.NewImpersonations(
+		log,
+		authService,
+		postgres,
+		redisStrg.WithPrefix("impersonation:"),
+		cfg.Impersonation,
+	)
+
+	grpcApp := grpcapp.New(
+		log,
+		cfg.GRPC.Port,
+		authService,
+		managementService,
+		tokenService,
+		permissionService,
+		roleService,
+		impersonations,
+		invitations,
+		mfaService,
+		passkeys,
+		serviceAccounts,
+		cfg.APIKeys,
+	)
+
+	var provider *oidc.Provider
+	if cfg.OIDC.Enabled {
+		if tokenService == nil {
+			err := errors.New("oidc requires tokens to be enabled")
+			l.Error("invalid oidc config", logger.Err(err))
+			panic(err)
+		}
+		provider = oidc.New(
+			log,
+			authService,
+			tokenService,
+			postgres,
+			redisStrg,
+			userStorage,
+			cfg.OIDC,
+		)
+	}
+
+	var sso *auth.SSO
+	if cfg.SSO.Enabled {
+		sso, err = auth.NewSSO(
+			context.Background(),
+			log,
+			authService,
+			postgres,
+			redisStrg.WithPrefix("sso:"),
+			cfg.SSO,
+		)
+		if err != nil {
+			l.Error("failed to discover sso identity provider", logger.Err(err))
+			panic(err)
+		}
+	}
+
+	httpApp := httpapp.New(log, cfg.HTTP, userStorage, provider, sso, cfg.SSO)
+
+	return &App{GRPCSrv: grpcApp, HTTPSrv: httpApp, Tokens: tokenService, Roles: roleService, Impersonations: impersonations}
+}
+
+func newSecretBox(encodedKey string) (*secretbox.Box, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, err
+	}
 
-	return &App{GRPCSrv: grpcApp}
+	return secretbox.New(key)
 }
@@ -2,7 +2,20 @@ package grpcapp
 
 import (
 	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	accountSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/account"
+	impersonationSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/impersonation"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	invitationsSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/invitations"
+	magicLinksSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/magiclinks"
+	mfaSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/mfa"
+	passkeysSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/passkeys"
+	permissionsSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/permissions"
+	rolesSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/roles"
+	tokensSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/tokens"
 	userSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/user"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/token"
 	"google.golang.org/grpc"
 	"log/slog"
 	"net"
@@ -14,10 +27,46 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, port int, authService userSrv.Auth, managementService userSrv.Management) *App {
-	gRPCServer := grpc.NewServer()
+// New creates the gRPC server. tokenService is nil when signed access tokens are
+// disabled, in which case no access tokens are issued and the tokens service is not
+// registered. Sessions are authenticated by impersonations, so that impersonation
+// sessions carry their impersonator.
+func New(
+	log *slog.Logger,
+	port int,
+	authService *auth.Auth,
+	managementService userSrv.Management,
+	tokenService *token.Tokens,
+	permissionService permissionsSrv.Permissions,
+	roleService rolesSrv.Roles,
+	impersonations *auth.Impersonations,
+	invitations invitationsSrv.Invitations,
+	mfaService mfaSrv.MFA,
+	passkeys passkeysSrv.Passkeys,
+	serviceAccounts interceptors.ServiceAccounts,
+	apiKeysCfg config.APIKeys,
+) *App {
+	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		interceptors.Auth(log, impersonations, serviceAccounts, interceptors.Policies, apiKeysCfg.Required),
+	))
 
-	userSrv.Register(gRPCServer, authService, managementService)
+	if tokenService != nil {
+		userSrv.Register(gRPCServer, authService, managementService, tokenService, impersonations)
+		tokensSrv.Register(gRPCServer, tokenService)
+		mfaSrv.Register(gRPCServer, mfaService, authService, tokenService)
+		passkeysSrv.Register(gRPCServer, passkeys, tokenService)
+		magicLinksSrv.Register(gRPCServer, authService, tokenService)
+	} else {
+		userSrv.Register(gRPCServer, authService, managementService, nil, impersonations)
+		mfaSrv.Register(gRPCServer, mfaService, authService, nil)
+		passkeysSrv.Register(gRPCServer, passkeys, nil)
+		magicLinksSrv.Register(gRPCServer, authService, nil)
+	}
+	permissionsSrv.Register(gRPCServer, permissionService)
+	rolesSrv.Register(gRPCServer, roleService)
+	impersonationSrv.Register(gRPCServer, impersonations)
+	invitationsSrv.Register(gRPCServer, invitations)
+	accountSrv.Register(gRPCServer, authService)
 
 	return &App{
 		log:        log,
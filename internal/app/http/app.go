@@ -0,0 +1,94 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	metricsSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/http/metrics"
+	oidcSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/http/oidc"
+	ssoSrv "github.com/ARUMANDESU/uniclubs-user-service/internal/http/sso"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/oidc"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+// New creates the HTTP server, which always serves the metrics. provider and sso are
+// nil when the OpenID Connect provider or the login through an external identity
+// provider are disabled, in which case their endpoints are not registered.
+func New(
+	log *slog.Logger,
+	cfg config.HTTP,
+	userCache metricsSrv.UserCache,
+	provider *oidc.Provider,
+	sso *auth.SSO,
+	ssoCfg config.SSO,
+) *App {
+	mux := http.NewServeMux()
+	metricsSrv.Register(mux, userCache)
+	if provider != nil {
+		oidcSrv.Register(mux, log, provider)
+	}
+	if sso != nil {
+		ssoSrv.Register(mux, log, sso, ssoCfg.FrontendURL, ssoCfg.StateTTL)
+	}
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: cfg.Timeout,
+			ReadTimeout:       cfg.Timeout,
+			WriteTimeout:      cfg.Timeout,
+		},
+		port: cfg.Port,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("port", a.port),
+	)
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("HTTP server is running", slog.String("addr", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop(ctx context.Context) {
+	const op = "httpapp.Stop"
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("stopping HTTP server")
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		log.Error("failed to stop HTTP server", logger.Err(err))
+	}
+}
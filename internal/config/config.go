@@ -9,12 +9,29 @@ import (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env:"ENV" env-default:"local"`
-	GRPC        GRPC          `yaml:"grpc"`
-	Rabbitmq    Rabbitmq      `yaml:"rabbitmq"`
-	DatabaseDSN string        `yaml:"database_dsn" env:"DATABASE_DSN" env-required:"true"`
-	RedisURL    string        `yaml:"redis_url" env:"REDIS_URL" env-required:"true"`
-	Clients     ClientsConfig `yaml:"clients"`
+	Env           string        `yaml:"env" env:"ENV" env-default:"local"`
+	GRPC          GRPC          `yaml:"grpc"`
+	Rabbitmq      Rabbitmq      `yaml:"rabbitmq"`
+	DatabaseDSN   string        `yaml:"database_dsn" env:"DATABASE_DSN" env-required:"true"`
+	Postgres      Postgres      `yaml:"postgres"`
+	RedisURL      string        `yaml:"redis_url" env:"REDIS_URL" env-required:"true"`
+	Clients       ClientsConfig `yaml:"clients"`
+	Cache         Cache         `yaml:"cache"`
+	Roles         Roles         `yaml:"roles"`
+	Phone         Phone         `yaml:"phone"`
+	MFA           MFA           `yaml:"mfa"`
+	WebAuthn      WebAuthn      `yaml:"webauthn"`
+	Login         Login         `yaml:"login"`
+	Registration  Registration  `yaml:"registration"`
+	Password      Password      `yaml:"password"`
+	PasswordHash  PasswordHash  `yaml:"password_hash"`
+	Impersonation Impersonation `yaml:"impersonation"`
+	Tokens        Tokens        `yaml:"tokens"`
+	HTTP          HTTP          `yaml:"http"`
+	OIDC          OIDC          `yaml:"oidc"`
+	SSO           SSO           `yaml:"sso"`
+	LDAP          LDAP          `yaml:"ldap"`
+	APIKeys       APIKeys       `yaml:"api_keys"`
 }
 
 type GRPC struct {
@@ -22,6 +39,210 @@ type GRPC struct {
 	Timeout time.Duration `yaml:"timeout" env:"GRPC_TIMEOUT"`
 }
 
+type Postgres struct {
+	MaxConns               int32         `yaml:"max_conns" env:"POSTGRES_MAX_CONNS" env-default:"10"`
+	MinConns               int32         `yaml:"min_conns" env:"POSTGRES_MIN_CONNS" env-default:"2"`
+	MaxConnLifetime        time.Duration `yaml:"max_conn_lifetime" env:"POSTGRES_MAX_CONN_LIFETIME" env-default:"1h"`
+	MaxConnIdleTime        time.Duration `yaml:"max_conn_idle_time" env:"POSTGRES_MAX_CONN_IDLE_TIME" env-default:"30m"`
+	StatementCacheCapacity int           `yaml:"statement_cache_capacity" env:"POSTGRES_STATEMENT_CACHE_CAPACITY" env-default:"512"`
+}
+
+type Cache struct {
+	UserTTL        time.Duration `yaml:"user_ttl" env:"CACHE_USER_TTL" env-default:"5m"`
+	PermissionsTTL time.Duration `yaml:"permissions_ttl" env:"CACHE_PERMISSIONS_TTL" env-default:"5m"`
+}
+
+type Roles struct {
+	// ExpiryInterval is how often expired scoped role grants are reverted.
+	ExpiryInterval time.Duration `yaml:"expiry_interval" env:"ROLES_EXPIRY_INTERVAL" env-default:"1m"`
+}
+
+type Phone struct {
+	DefaultCountryCode string        `yaml:"default_country_code" env:"PHONE_DEFAULT_COUNTRY_CODE" env-default:"7"`
+	TrunkPrefix        string        `yaml:"trunk_prefix" env:"PHONE_TRUNK_PREFIX" env-default:"8"`
+	OTPTTL             time.Duration `yaml:"otp_ttl" env:"PHONE_OTP_TTL" env-default:"5m"`
+	OTPMaxAttempts     int           `yaml:"otp_max_attempts" env:"PHONE_OTP_MAX_ATTEMPTS" env-default:"5"`
+	OTPResendInterval  time.Duration `yaml:"otp_resend_interval" env:"PHONE_OTP_RESEND_INTERVAL" env-default:"1m"`
+	// OTPKey is the secret keying the HMAC of the verification codes stored in redis.
+	// Phone verification is unavailable while it is empty.
+	OTPKey string `yaml:"otp_key" env:"PHONE_OTP_KEY"`
+}
+
+type MFA struct {
+	Issuer string `yaml:"issuer" env:"MFA_ISSUER" env-default:"UniClubs"`
+	// EncryptionKey is the base64 encoded 32 byte key used to encrypt TOTP secrets.
+	// Two-factor enrolment is unavailable while it is empty.
+	EncryptionKey string        `yaml:"encryption_key" env:"MFA_ENCRYPTION_KEY"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env:"MFA_CHALLENGE_TTL" env-default:"5m"`
+	MaxAttempts   int           `yaml:"max_attempts" env:"MFA_MAX_ATTEMPTS" env-default:"5"`
+}
+
+type WebAuthn struct {
+	RPID          string        `yaml:"rp_id" env:"WEBAUTHN_RP_ID" env-default:"localhost"`
+	RPDisplayName string        `yaml:"rp_display_name" env:"WEBAUTHN_RP_DISPLAY_NAME" env-default:"UniClubs"`
+	RPOrigins     []string      `yaml:"rp_origins" env:"WEBAUTHN_RP_ORIGINS" env-default:"http://localhost:3000"`
+	CeremonyTTL   time.Duration `yaml:"ceremony_ttl" env:"WEBAUTHN_CEREMONY_TTL" env-default:"5m"`
+}
+
+// Login is the lockout policy shared by every way of logging in with an email,
+// and the settings of passwordless login.
+type Login struct {
+	MaxAttempts     int           `yaml:"max_attempts" env:"LOGIN_MAX_ATTEMPTS" env-default:"5"`
+	LockoutDuration time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" env-default:"15m"`
+	MagicLinkTTL    time.Duration `yaml:"magic_link_ttl" env:"LOGIN_MAGIC_LINK_TTL" env-default:"15m"`
+	// MagicLinkMaxRequests is how many magic links can be requested for an email per
+	// MagicLinkRequestWindow. It is counted apart from failed logins.
+	MagicLinkMaxRequests   int           `yaml:"magic_link_max_requests" env:"LOGIN_MAGIC_LINK_MAX_REQUESTS" env-default:"3"`
+	MagicLinkRequestWindow time.Duration `yaml:"magic_link_request_window" env:"LOGIN_MAGIC_LINK_REQUEST_WINDOW" env-default:"15m"`
+}
+
+// Registration restricts who can register. Domains match their subdomains too.
+type Registration struct {
+	// Mode is "open", or "invite_only" to require an invitation code to register.
+	Mode string `yaml:"mode" env:"REGISTRATION_MODE" env-default:"open"`
+	// AllowedDomains are the only email domains users can register with, any domain
+	// is allowed when it is empty.
+	AllowedDomains []string `yaml:"allowed_domains" env:"REGISTRATION_ALLOWED_DOMAINS"`
+	DeniedDomains  []string `yaml:"denied_domains" env:"REGISTRATION_DENIED_DOMAINS"`
+	// BlockDisposable rejects the disposable email domains of the embedded list.
+	BlockDisposable bool `yaml:"block_disposable" env:"REGISTRATION_BLOCK_DISPOSABLE" env-default:"true"`
+	// BarcodeFormats are the barcode formats required for the emails of a domain.
+	BarcodeFormats []BarcodeFormat `yaml:"barcode_formats"`
+}
+
+type BarcodeFormat struct {
+	Domain string `yaml:"domain"`
+	// Pattern is a regular expression the whole barcode must match.
+	Pattern string `yaml:"pattern"`
+}
+
+// Password is the policy for new passwords. Existing passwords are not checked.
+type Password struct {
+	MinLength int `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	MaxLength int `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" env-default:"64"`
+	// MinCharClasses is how many of lowercase and uppercase letters, digits and
+	// symbols a password must contain.
+	MinCharClasses int `yaml:"min_char_classes" env:"PASSWORD_MIN_CHAR_CLASSES" env-default:"2"`
+	// MinStrength is the minimum estimated strength, from 0 for too guessable to 4
+	// for very unguessable.
+	MinStrength int `yaml:"min_strength" env:"PASSWORD_MIN_STRENGTH" env-default:"2"`
+	// RejectPersonalInfo rejects passwords containing the name or email of the user.
+	RejectPersonalInfo bool `yaml:"reject_personal_info" env:"PASSWORD_REJECT_PERSONAL_INFO" env-default:"true"`
+	// BreachedList is the path of a breached password list built by cmd/breached-list.
+	// The embedded list of common passwords is used when it is empty.
+	BreachedList string `yaml:"breached_list" env:"PASSWORD_BREACHED_LIST"`
+}
+
+// PasswordHash configures the argon2id hashes of passwords. Hashes of bcrypt or with
+// other parameters are upgraded when their users log in.
+type PasswordHash struct {
+	// Memory is in KiB.
+	Memory      uint32 `yaml:"memory" env:"PASSWORD_HASH_MEMORY" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env:"PASSWORD_HASH_ITERATIONS" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env:"PASSWORD_HASH_PARALLELISM" env-default:"2"`
+	SaltLength  uint32 `yaml:"salt_length" env:"PASSWORD_HASH_SALT_LENGTH" env-default:"16"`
+	KeyLength   uint32 `yaml:"key_length" env:"PASSWORD_HASH_KEY_LENGTH" env-default:"32"`
+	// Pepper is an optional secret kept out of the database and mixed into the hashes.
+	// Hashes made with a pepper can not be verified without it.
+	Pepper string `yaml:"pepper" env:"PASSWORD_HASH_PEPPER"`
+	// OldPeppers still verify the hashes made with them after Pepper is rotated.
+	// Those hashes are rehashed with Pepper as users log in.
+	OldPeppers []string `yaml:"old_peppers" env:"PASSWORD_HASH_OLD_PEPPERS"`
+}
+
+type Impersonation struct {
+	SessionTTL time.Duration `yaml:"session_ttl" env:"IMPERSONATION_SESSION_TTL" env-default:"15m"`
+	// ExpiryInterval is how often the end of expired impersonations is recorded.
+	ExpiryInterval time.Duration `yaml:"expiry_interval" env:"IMPERSONATION_EXPIRY_INTERVAL" env-default:"1m"`
+}
+
+// Tokens configures the signed access tokens minted alongside sessions.
+type Tokens struct {
+	Enabled bool `yaml:"enabled" env:"TOKENS_ENABLED" env-default:"false"`
+	// EncryptionKey is the base64 encoded 32 byte key used to encrypt the signing
+	// keys at rest. It is required when tokens are enabled.
+	EncryptionKey       string        `yaml:"encryption_key" env:"TOKENS_ENCRYPTION_KEY"`
+	Issuer              string        `yaml:"issuer" env:"TOKENS_ISSUER" env-default:"uniclubs-user-service"`
+	AccessTTL           time.Duration `yaml:"access_ttl" env:"TOKENS_ACCESS_TTL" env-default:"15m"`
+	RefreshTTL          time.Duration `yaml:"refresh_ttl" env:"TOKENS_REFRESH_TTL" env-default:"720h"`
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval" env:"TOKENS_KEY_ROTATION_INTERVAL" env-default:"720h"`
+}
+
+type HTTP struct {
+	Port    int           `yaml:"port" env:"HTTP_PORT" env-default:"8080"`
+	Timeout time.Duration `yaml:"timeout" env:"HTTP_TIMEOUT" env-default:"10s"`
+}
+
+// OIDC configures the OpenID Connect provider served over HTTP. It requires signed
+// access tokens to be enabled.
+type OIDC struct {
+	Enabled bool `yaml:"enabled" env:"OIDC_ENABLED" env-default:"false"`
+	// Issuer is the public base URL of the HTTP server, the endpoints are served
+	// under it.
+	Issuer  string        `yaml:"issuer" env:"OIDC_ISSUER" env-default:"http://localhost:8080"`
+	CodeTTL time.Duration `yaml:"code_ttl" env:"OIDC_CODE_TTL" env-default:"1m"`
+}
+
+// SSO configures login through an external OpenID Connect identity provider, such
+// as the university SSO. It is served over HTTP.
+type SSO struct {
+	Enabled      bool   `yaml:"enabled" env:"SSO_ENABLED" env-default:"false"`
+	IssuerURL    string `yaml:"issuer_url" env:"SSO_ISSUER_URL"`
+	ClientID     string `yaml:"client_id" env:"SSO_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"SSO_CLIENT_SECRET"`
+	// RedirectURL is the public URL of the /sso/callback endpoint.
+	RedirectURL string `yaml:"redirect_url" env:"SSO_REDIRECT_URL" env-default:"http://localhost:8080/sso/callback"`
+	// FrontendURL receives the result of the login in its fragment: session_token,
+	// mfa_challenge or error.
+	FrontendURL string   `yaml:"frontend_url" env:"SSO_FRONTEND_URL" env-default:"http://localhost:3000/sso"`
+	Scopes      []string `yaml:"scopes" env:"SSO_SCOPES" env-default:"openid,email,profile"`
+	// BarcodeClaim is the ID token claim holding the student barcode.
+	BarcodeClaim string        `yaml:"barcode_claim" env:"SSO_BARCODE_CLAIM" env-default:"student_id"`
+	StateTTL     time.Duration `yaml:"state_ttl" env:"SSO_STATE_TTL" env-default:"10m"`
+}
+
+// LDAP configures password login against an LDAP directory, tried after the local
+// passwords.
+type LDAP struct {
+	Enabled  bool   `yaml:"enabled" env:"LDAP_ENABLED" env-default:"false"`
+	URL      string `yaml:"url" env:"LDAP_URL" env-default:"ldap://localhost:389"`
+	StartTLS bool   `yaml:"start_tls" env:"LDAP_START_TLS" env-default:"false"`
+	// BindDN and BindPassword are the service account used to search for users.
+	BindDN       string `yaml:"bind_dn" env:"LDAP_BIND_DN"`
+	BindPassword string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	BaseDN       string `yaml:"base_dn" env:"LDAP_BASE_DN"`
+	// UserFilter finds the user by email, %s is replaced by the escaped email.
+	UserFilter string         `yaml:"user_filter" env:"LDAP_USER_FILTER" env-default:"(mail=%s)"`
+	Attributes LDAPAttributes `yaml:"attributes"`
+	// GroupRoles maps group DNs to roles. The first group the user is a member of
+	// decides the role, users in none of the groups get DefaultRole.
+	GroupRoles  []LDAPGroupRole `yaml:"group_roles"`
+	DefaultRole string          `yaml:"default_role" env:"LDAP_DEFAULT_ROLE" env-default:"USER"`
+	Timeout     time.Duration   `yaml:"timeout" env:"LDAP_TIMEOUT" env-default:"5s"`
+}
+
+// LDAPAttributes are the directory attributes mapped onto a user.
+type LDAPAttributes struct {
+	Email     string `yaml:"email" env:"LDAP_ATTR_EMAIL" env-default:"mail"`
+	FirstName string `yaml:"first_name" env:"LDAP_ATTR_FIRST_NAME" env-default:"givenName"`
+	LastName  string `yaml:"last_name" env:"LDAP_ATTR_LAST_NAME" env-default:"sn"`
+	Barcode   string `yaml:"barcode" env:"LDAP_ATTR_BARCODE" env-default:"employeeNumber"`
+	Groups    string `yaml:"groups" env:"LDAP_ATTR_GROUPS" env-default:"memberOf"`
+}
+
+type LDAPGroupRole struct {
+	Group string `yaml:"group"`
+	Role  string `yaml:"role"`
+}
+
+// APIKeys configures the API keys of service accounts.
+type APIKeys struct {
+	// Required rejects anonymous calls to the read-only checks between services. It
+	// can be turned off while callers are being migrated, other methods always need
+	// credentials.
+	Required bool `yaml:"required" env:"API_KEYS_REQUIRED" env-default:"true"`
+}
+
 type Rabbitmq struct {
 	User         string `yaml:"user" env:"RABBITMQ_USER"`
 	Password     string `yaml:"password" env:"RABBITMQ_PASSWORD"`
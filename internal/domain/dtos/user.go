@@ -14,6 +14,8 @@ type UserRegisterDTO struct {
 	Major     string
 	GroupName string
 	Year      int32
+	// InviteCode is empty if no invitation code was sent.
+	InviteCode string
 }
 
 func (u *UserRegisterDTO) ToDomain() *domain.User {
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// Identity links a user to an account at an external OpenID Connect identity
+// provider. The issuer and subject identify the external account.
+type Identity struct {
+	ID        int64
+	UserID    int64
+	Issuer    string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// Impersonation end reasons.
+const (
+	ImpersonationStopped = "stopped"
+	ImpersonationExpired = "expired"
+)
+
+// Impersonation is a session in which a staff member acts as another user, to see
+// exactly what the user sees.
+type Impersonation struct {
+	ID             int64
+	ImpersonatorID int64
+	UserID         int64
+	StartedAt      time.Time
+	ExpiresAt      time.Time
+	// EndedAt and EndReason are zero while the impersonation lasts.
+	EndedAt   *time.Time
+	EndReason string
+}
@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// Invitation lets people register while registration is invite only. Only the hash
+// of its code is stored.
+type Invitation struct {
+	ID       int64
+	CodeHash []byte
+	// Email binds the invitation to a single email, it is empty if anyone with the
+	// code can use it.
+	Email string
+	// Role is assigned to the users registered with the invitation, it is empty for
+	// the default role.
+	Role      Role
+	MaxUses   int
+	Uses      int
+	CreatedBy int64
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+// Expired reports whether the invitation has expired at now.
+func (i *Invitation) Expired(now time.Time) bool {
+	return i.ExpiresAt != nil && !now.Before(*i.ExpiresAt)
+}
+
+// UsedUp reports whether the invitation has been used as many times as allowed.
+func (i *Invitation) UsedUp() bool {
+	return i.Uses >= i.MaxUses
+}
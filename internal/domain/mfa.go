@@ -0,0 +1,13 @@
+package domain
+
+// MFA is the TOTP second factor of a user.
+type MFA struct {
+	UserID int64
+	// Secret is the TOTP shared secret, encrypted at rest.
+	Secret []byte
+	// Enabled is false until the enrolment has been confirmed with a valid code.
+	Enabled bool
+	// LastUsedStep is the TOTP time step of the last accepted code, codes from
+	// this or earlier steps are rejected to prevent replay.
+	LastUsedStep int64
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "slices"
+
+// OAuthClient is an application registered to log users in through the OpenID
+// Connect provider.
+type OAuthClient struct {
+	ID string
+	// SecretHash is the bcrypt hash of the client secret. It is empty for public
+	// clients, such as the mobile app, which cannot keep a secret.
+	SecretHash   string
+	Name         string
+	RedirectURIs []string
+}
+
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// AllowsRedirectURI reports whether uri is one of the registered redirect URIs.
+// URIs are compared exactly.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AuthorizationCode is the state behind an OAuth authorization code.
+type AuthorizationCode struct {
+	ClientID      string `json:"client_id"`
+	UserID        int64  `json:"user_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce"`
+	CodeChallenge string `json:"code_challenge"`
+	// SessionToken is the session created by the login the code was issued for.
+	SessionToken string `json:"session_token"`
+	AuthTime     int64  `json:"auth_time"`
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Principal is the caller of an RPC: a user authenticated by a session, a service
+// account authenticated by an API key, or both when a service acts for a user.
+type Principal struct {
+	// UserID and Role are zero if no user session was presented.
+	UserID int64
+	Role   Role
+	// APIKey is nil if no API key was presented.
+	APIKey *APIKey
+	// ImpersonatorID is the staff member acting as the user, it is zero unless the
+	// session is an impersonation.
+	ImpersonatorID int64
+}
+
+// Impersonated reports whether the user session is an impersonation.
+func (p *Principal) Impersonated() bool {
+	return p.IsUser() && p.ImpersonatorID != 0
+}
+
+// IsUser reports whether the call carries a user session.
+func (p *Principal) IsUser() bool {
+	return p != nil && p.UserID != 0
+}
+
+// HasRole reports whether the user has one of roles.
+func (p *Principal) HasRole(roles ...Role) bool {
+	return p.IsUser() && slices.Contains(roles, p.Role)
+}
+
+// HasScope reports whether the API key of the call has scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && p.APIKey != nil && p.APIKey.HasScope(scope)
+}
+
+// Actor identifies the principal in audit records, like "user:1",
+// "user:1 impersonated by user:2" or "service_account:clubs".
+func (p *Principal) Actor() string {
+	switch {
+	case p.Impersonated():
+		return fmt.Sprintf("user:%d impersonated by user:%d", p.UserID, p.ImpersonatorID)
+	case p.IsUser():
+		return fmt.Sprintf("user:%d", p.UserID)
+	case p != nil && p.APIKey != nil:
+		return "service_account:" + p.APIKey.ServiceAccountName
+	default:
+		return ""
+	}
+}
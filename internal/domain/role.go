@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	userv1 "github.com/ARUMANDESU/uniclubs-protos/gen/go/user"
+	"slices"
+	"strings"
+)
+
+// Role is the global role of a user. The names are the names of the userv1.Role
+// enum values and of the rows of the roles table.
+type Role string
+
+const (
+	RoleGuest Role = "GUEST"
+	RoleUser  Role = "USER"
+	RoleModer Role = "MODER"
+	RoleAdmin Role = "ADMIN"
+	RoleDSVR  Role = "DSVR"
+)
+
+// Roles lists all known roles, in the order of the userv1.Role enum.
+var Roles = []Role{RoleGuest, RoleUser, RoleModer, RoleAdmin, RoleDSVR}
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// ParseRole returns the role with the given name.
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if !slices.Contains(Roles, role) {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRole, name)
+	}
+	return role, nil
+}
+
+// RoleFromProto returns the role of the enum value.
+func RoleFromProto(role userv1.Role) (Role, error) {
+	name, ok := userv1.Role_name[int32(role)]
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrUnknownRole, role)
+	}
+	return ParseRole(name)
+}
+
+// Proto returns the enum value of the role. r must be one of Roles.
+func (r Role) Proto() userv1.Role {
+	return userv1.Role(userv1.Role_value[string(r)])
+}
+
+func (r Role) String() string {
+	return string(r)
+}
+
+// Scan implements sql.Scanner, so unknown role names read from storage are
+// reported instead of being mistaken for another role.
+func (r *Role) Scan(src any) error {
+	name, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("%w: cannot scan %T", ErrUnknownRole, src)
+	}
+	role, err := ParseRole(name)
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// CheckRoles reports the differences between names, the roles found in storage,
+// and Roles.
+func CheckRoles(names []string) error {
+	var missing, unknown []string
+	for _, role := range Roles {
+		if !slices.Contains(names, string(role)) {
+			missing = append(missing, string(role))
+		}
+	}
+	for _, name := range names {
+		if _, err := ParseRole(name); err != nil {
+			unknown = append(unknown, name)
+		}
+	}
+
+	var errs []error
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("missing roles: %s", strings.Join(missing, ", ")))
+	}
+	if len(unknown) > 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrUnknownRole, strings.Join(unknown, ", ")))
+	}
+	return errors.Join(errs...)
+}
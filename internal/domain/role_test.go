@@ -0,0 +1,41 @@
+package domain
+
+import (
+	userv1 "github.com/ARUMANDESU/uniclubs-protos/gen/go/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRoles_MatchProto(t *testing.T) {
+	require.Len(t, Roles, len(userv1.Role_name))
+	for _, role := range Roles {
+		parsed, err := RoleFromProto(role.Proto())
+		require.NoError(t, err)
+		assert.Equal(t, role, parsed)
+		assert.Equal(t, role.Proto().String(), role.String())
+	}
+
+	_, err := RoleFromProto(userv1.Role(len(Roles)))
+	assert.ErrorIs(t, err, ErrUnknownRole)
+}
+
+func TestRole_Scan(t *testing.T) {
+	var role Role
+	require.NoError(t, role.Scan("MODER"))
+	assert.Equal(t, RoleModer, role)
+
+	assert.ErrorIs(t, role.Scan("SUPERUSER"), ErrUnknownRole, "unknown roles must not be mapped to another role")
+	assert.ErrorIs(t, role.Scan(nil), ErrUnknownRole)
+}
+
+func TestCheckRoles(t *testing.T) {
+	assert.NoError(t, CheckRoles([]string{"DSVR", "ADMIN", "MODER", "USER", "GUEST"}))
+
+	err := CheckRoles([]string{"DSVR", "ADMIN", "MODER", "USER"})
+	assert.ErrorContains(t, err, "missing roles: GUEST")
+
+	err = CheckRoles([]string{"DSVR", "ADMIN", "MODER", "USER", "GUEST", "OWNER"})
+	assert.ErrorIs(t, err, ErrUnknownRole)
+	assert.ErrorContains(t, err, "OWNER")
+}
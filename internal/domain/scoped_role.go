@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Role scope types.
+const (
+	RoleScopeClub = "club"
+)
+
+// RoleScopeTypes lists all known role scope types.
+var RoleScopeTypes = []string{RoleScopeClub}
+
+var ErrInvalidRoleScope = errors.New(`role scope must be "<type>:<id>"`)
+
+// RoleScope is the object a scoped role applies to, like a single club.
+type RoleScope struct {
+	Type string
+	ID   int64
+}
+
+// ParseRoleScope parses a scope written as "<type>:<id>", like "club:42".
+func ParseRoleScope(s string) (RoleScope, error) {
+	scopeType, id, ok := strings.Cut(s, ":")
+	if !ok || !slices.Contains(RoleScopeTypes, scopeType) {
+		return RoleScope{}, ErrInvalidRoleScope
+	}
+
+	scopeID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || scopeID < 1 {
+		return RoleScope{}, ErrInvalidRoleScope
+	}
+
+	return RoleScope{Type: scopeType, ID: scopeID}, nil
+}
+
+func (s RoleScope) String() string {
+	return fmt.Sprintf("%s:%d", s.Type, s.ID)
+}
+
+// ScopedRole is a role a user holds only within a scope, on top of their global
+// role.
+type ScopedRole struct {
+	UserID    int64
+	Scope     RoleScope
+	Role      Role
+	CreatedAt time.Time
+	// ExpiresAt is nil for grants that do not expire.
+	ExpiresAt *time.Time
+}
+
+// Active reports whether the grant has not expired at now.
+func (r *ScopedRole) Active(now time.Time) bool {
+	return r.ExpiresAt == nil || now.Before(*r.ExpiresAt)
+}
+
+// Scoped role audit actions.
+const (
+	ScopedRoleGranted = "granted"
+	ScopedRoleRevoked = "revoked"
+	ScopedRoleExpired = "expired"
+)
+
+// ScopedRoleAudit records a change of the scoped roles of a user.
+type ScopedRoleAudit struct {
+	ID         int64
+	ScopedRole ScopedRole
+	Action     string
+	// Actor is who made the change, like "user:1", or empty for expiries.
+	Actor     string
+	CreatedAt time.Time
+}
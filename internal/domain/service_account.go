@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Scopes granted to API keys.
+const (
+	ScopeUsersRead   = "users:read"
+	ScopeRolesCheck  = "roles:check"
+	ScopeRolesManage = "roles:manage"
+)
+
+// Scopes lists all known scopes.
+var Scopes = []string{ScopeUsersRead, ScopeRolesCheck, ScopeRolesManage}
+
+// ServiceAccount is a non-human caller, such as another service, authenticated by
+// its API keys.
+type ServiceAccount struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+// APIKey is a key of a service account. Only the hash of its secret is stored.
+type APIKey struct {
+	ID                 int64
+	ServiceAccountID   int64
+	ServiceAccountName string
+	Prefix             string
+	SecretHash         []byte
+	Scopes             []string
+	CreatedAt          time.Time
+	ExpiresAt          *time.Time
+	LastUsedAt         *time.Time
+	RevokedAt          *time.Time
+}
+
+// Active reports whether the key is neither revoked nor expired at now.
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// SigningKey is an Ed25519 key used to sign access tokens.
+type SigningKey struct {
+	// ID is the key id published in the JWKS and in the kid header of tokens.
+	ID string
+	// PrivateKey is the Ed25519 seed, encrypted at rest.
+	PrivateKey []byte
+	CreatedAt  time.Time
+	// ExpiresAt is when the key stops being published, after the last token it
+	// signed has expired.
+	ExpiresAt time.Time
+}
+
+// RefreshToken is the state behind an opaque refresh token.
+type RefreshToken struct {
+	UserID int64
+	// SessionID identifies the session, and the refresh token family of the session.
+	SessionID string
+	// SessionToken is the session the family belongs to. It is only set when a
+	// token is used, so that the session can be checked and revoked.
+	SessionToken string
+	// ClientID is the OpenID Connect client the family was issued to, empty for
+	// families issued by the gRPC API.
+	ClientID string
+}
@@ -7,37 +7,76 @@ import (
 )
 
 type User struct {
-	ID           int64     `json:"id"`
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	AvatarURL    string    `json:"avatar_url"`
-	Email        string    `json:"email"`
-	PasswordHash []byte    `json:"-"`
-	Activated    bool      `json:"activated"`
-	CreatedAt    time.Time `json:"created_at"`
-	Role         string    `json:"role"`
-	Barcode      string    `json:"barcode"`
-	PhoneNumber  string    `json:"phone_number"`
-	Major        string    `json:"major"`
-	GroupName    string    `json:"group_name"`
-	Year         int32     `json:"year"`
+	ID              int64      `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	AvatarURL       string     `json:"avatar_url"`
+	Email           string     `json:"email"`
+	PasswordHash    []byte     `json:"-"`
+	Activated       bool       `json:"activated"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Role            Role       `json:"role"`
+	Barcode         string     `json:"barcode"`
+	PhoneNumber     string     `json:"phone_number"`
+	Major           string     `json:"major"`
+	GroupName       string     `json:"group_name"`
+	Year            int32      `json:"year"`
+	Version         int32      `json:"version"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
 }
 
-func (u *User) MapRoleStringToEnum() userv1.Role {
-	switch u.Role {
-	case "GUEST":
-		return userv1.Role_GUEST
-	case "USER":
-		return userv1.Role_USER
-	case "MODER":
-		return userv1.Role_MODER
-	case "ADMIN":
-		return userv1.Role_ADMIN
-	case "DSVR":
-		return userv1.Role_DSVR
+// User fields that can be changed by a partial update. The names are shared by the
+// protobuf field mask paths and the users table columns. The phone number is not
+// listed because it can only be set through phone verification.
+const (
+	FieldEmail     = "email"
+	FieldFirstName = "first_name"
+	FieldLastName  = "last_name"
+	FieldBarcode   = "barcode"
+	FieldMajor     = "major"
+	FieldGroupName = "group_name"
+	FieldYear      = "year"
+	FieldAvatarURL = "avatar_url"
+)
+
+// FieldValue returns the value of an updatable field, ok is false for unknown fields.
+func (u *User) FieldValue(field string) (value any, ok bool) {
+	switch field {
+	case FieldEmail:
+		return u.Email, true
+	case FieldFirstName:
+		return u.FirstName, true
+	case FieldLastName:
+		return u.LastName, true
+	case FieldBarcode:
+		return u.Barcode, true
+	case FieldMajor:
+		return u.Major, true
+	case FieldGroupName:
+		return u.GroupName, true
+	case FieldYear:
+		return u.Year, true
+	case FieldAvatarURL:
+		return u.AvatarURL, true
 	default:
-		return userv1.Role_GUEST // or any default value
+		return nil, false
+	}
+}
+
+// ChangedFields returns the fields whose value in other differs from the value in u.
+func (u *User) ChangedFields(other *User, fields []string) []string {
+	changed := make([]string, 0, len(fields))
+	for _, field := range fields {
+		oldValue, ok := u.FieldValue(field)
+		if !ok {
+			continue
+		}
+		newValue, _ := other.FieldValue(field)
+		if oldValue != newValue {
+			changed = append(changed, field)
+		}
 	}
+	return changed
 }
 
 func (u *User) ToUserObject() *userv1.UserObject {
@@ -52,7 +91,7 @@ func (u *User) ToUserObject() *userv1.UserObject {
 		GroupName: u.GroupName,
 		Year:      u.Year,
 		CreatedAt: timestamppb.New(u.CreatedAt),
-		Role:      u.MapRoleStringToEnum(),
+		Role:      u.Role.Proto(),
 	}
 }
 
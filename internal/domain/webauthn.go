@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// WebAuthnCredential is a passkey registered by a user.
+type WebAuthnCredential struct {
+	ID              int64
+	UserID          int64
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	// SignCount is the last signature counter reported by the authenticator. A
+	// counter that does not increase indicates a cloned authenticator.
+	SignCount      uint32
+	Transports     []string
+	BackupEligible bool
+	BackupState    bool
+	CreatedAt      time.Time
+	LastUsedAt     *time.Time
+}
@@ -0,0 +1,287 @@
+// Package account serves the changes users make to their own account.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types:
+//
+//	conn.Invoke(ctx, "/user.Account/RequestEmailChange", req, &emptypb.Empty{})
+//
+// with req = {"email": "new@astanait.edu.kz"} sends a confirmation link to the new
+// email of the calling user, whose current email stays in use until
+//
+//	conn.Invoke(ctx, "/user.Account/ConfirmEmailChange", req, &emptypb.Empty{})
+//
+// is called with the token of the link, req = {"token": "..."}. A token can be used
+// only once.
+//
+//	conn.Invoke(ctx, "/user.Account/RequestPhoneVerification", req, &emptypb.Empty{})
+//	conn.Invoke(ctx, "/user.Account/ConfirmPhoneVerification", req, &emptypb.Empty{})
+//
+// send a one-time code to req = {"phone_number": "+77011234567"} and store the
+// number on the calling user once the code is confirmed with req = {"code": "123456"}.
+//
+// Impersonation sessions can not change the email or phone of the user.
+package account
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrEmailTaken          = errors.New("email is already taken")
+	ErrEmailUnchanged      = errors.New("new email is the same as the current one")
+	ErrEmailChangeNotFound = errors.New("email change token not found")
+	ErrUserRequired        = errors.New("only users can change their account")
+	ErrImpersonated        = errors.New("impersonation sessions can not change the account")
+	ErrInvalidPhoneNumber  = errors.New("invalid phone number")
+	ErrPhoneCodeNotFound   = errors.New("no pending phone verification code, request a new one")
+	ErrInvalidPhoneCode    = errors.New("invalid phone verification code")
+	ErrTooManyAttempts     = errors.New("too many invalid codes, request a new one")
+	ErrTooManyRequests     = errors.New("a code was sent recently, try again later")
+	ErrPhoneUnavailable    = errors.New("phone verification is not available")
+	ErrInternal            = errors.New("internal error")
+)
+
+type Account interface {
+	RequestEmailChange(ctx context.Context, userID int64, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	RequestPhoneVerification(ctx context.Context, userID int64, phoneNumber string) error
+	ConfirmPhoneVerification(ctx context.Context, userID int64, code string) error
+}
+
+type AccountServer interface {
+	RequestEmailChange(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	ConfirmEmailChange(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	RequestPhoneVerification(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	ConfirmPhoneVerification(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+}
+
+type serverApi struct {
+	account Account
+}
+
+func Register(gRPC *grpc.Server, account Account) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{account: account})
+}
+
+func (s serverApi) RequestEmailChange(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	email := req.GetFields()["email"].GetStringValue()
+	err := validation.Validate(email, validation.Required, is.Email)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "email: %s", err)
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.account.RequestEmailChange(ctx, userID, email)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) ConfirmEmailChange(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	token := req.GetFields()["token"].GetStringValue()
+	err := validation.Validate(token, validation.Required)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "token: %s", err)
+	}
+
+	err = s.account.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) RequestPhoneVerification(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	phoneNumber := req.GetFields()["phone_number"].GetStringValue()
+	err := validation.Validate(phoneNumber, validation.Required)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "phone_number: %s", err)
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.account.RequestPhoneVerification(ctx, userID, phoneNumber)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) ConfirmPhoneVerification(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	code := req.GetFields()["code"].GetStringValue()
+	err := validation.Validate(code, validation.Required, is.Digit)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "code: %s", err)
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.account.ConfirmPhoneVerification(ctx, userID, code)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// callerID returns the user calling the RPC. Impersonators can not change the
+// email or phone of the user, it would let them take the account over.
+func callerID(ctx context.Context) (int64, error) {
+	principal, _ := interceptors.PrincipalFromContext(ctx)
+	if !principal.IsUser() {
+		return 0, status.Error(codes.PermissionDenied, ErrUserRequired.Error())
+	}
+	if principal.Impersonated() {
+		return 0, status.Error(codes.PermissionDenied, ErrImpersonated.Error())
+	}
+
+	return principal.UserID, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrUserNotExist):
+		return status.Error(codes.NotFound, ErrUserNotFound.Error())
+	case errors.Is(err, auth.ErrUserExists):
+		return status.Error(codes.AlreadyExists, ErrEmailTaken.Error())
+	case errors.Is(err, auth.ErrEmailUnchanged):
+		return status.Error(codes.InvalidArgument, ErrEmailUnchanged.Error())
+	case errors.Is(err, auth.ErrEmailChangeNotExists):
+		return status.Error(codes.NotFound, ErrEmailChangeNotFound.Error())
+	case errors.Is(err, auth.ErrInvalidPhoneNumber):
+		return status.Error(codes.InvalidArgument, ErrInvalidPhoneNumber.Error())
+	case errors.Is(err, auth.ErrPhoneOTPNotExists):
+		return status.Error(codes.NotFound, ErrPhoneCodeNotFound.Error())
+	case errors.Is(err, auth.ErrInvalidPhoneOTP):
+		return status.Error(codes.InvalidArgument, ErrInvalidPhoneCode.Error())
+	case errors.Is(err, auth.ErrPhoneOTPAttemptsExceeded):
+		return status.Error(codes.ResourceExhausted, ErrTooManyAttempts.Error())
+	case errors.Is(err, auth.ErrTooManyRequests):
+		return status.Error(codes.ResourceExhausted, ErrTooManyRequests.Error())
+	case errors.Is(err, auth.ErrPhoneUnavailable):
+		return status.Error(codes.FailedPrecondition, ErrPhoneUnavailable.Error())
+	default:
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.Account",
+	HandlerType: (*AccountServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestEmailChange",
+			Handler:    requestEmailChangeHandler,
+		},
+		{
+			MethodName: "ConfirmEmailChange",
+			Handler:    confirmEmailChangeHandler,
+		},
+		{
+			MethodName: "RequestPhoneVerification",
+			Handler:    requestPhoneVerificationHandler,
+		},
+		{
+			MethodName: "ConfirmPhoneVerification",
+			Handler:    confirmPhoneVerificationHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func requestEmailChangeHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountServer).RequestEmailChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Account/RequestEmailChange",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(AccountServer).RequestEmailChange(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func confirmEmailChangeHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountServer).ConfirmEmailChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Account/ConfirmEmailChange",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(AccountServer).ConfirmEmailChange(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func requestPhoneVerificationHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountServer).RequestPhoneVerification(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Account/RequestPhoneVerification",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(AccountServer).RequestPhoneVerification(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func confirmPhoneVerificationHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountServer).ConfirmPhoneVerification(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Account/ConfirmPhoneVerification",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(AccountServer).ConfirmPhoneVerification(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
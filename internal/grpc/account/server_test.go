@@ -0,0 +1,127 @@
+package account
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestAccount_RejectsImpersonation(t *testing.T) {
+	sessions := fakeSessions{
+		"student":       {UserID: 1, Role: domain.RoleUser},
+		"impersonation": {UserID: 1, Role: domain.RoleUser, ImpersonatorID: 2},
+	}
+
+	tests := []struct {
+		method string
+		req    map[string]any
+		call   func(s serverApi, ctx context.Context, req *structpb.Struct) error
+	}{
+		{
+			method: "/user.Account/RequestEmailChange",
+			req:    map[string]any{"email": "new@astanait.edu.kz"},
+			call: func(s serverApi, ctx context.Context, req *structpb.Struct) error {
+				_, err := s.RequestEmailChange(ctx, req)
+				return err
+			},
+		},
+		{
+			method: "/user.Account/RequestPhoneVerification",
+			req:    map[string]any{"phone_number": "+77011234567"},
+			call: func(s serverApi, ctx context.Context, req *structpb.Struct) error {
+				_, err := s.RequestPhoneVerification(ctx, req)
+				return err
+			},
+		},
+		{
+			method: "/user.Account/ConfirmPhoneVerification",
+			req:    map[string]any{"code": "123456"},
+			call: func(s serverApi, ctx context.Context, req *structpb.Struct) error {
+				_, err := s.ConfirmPhoneVerification(ctx, req)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req, err := structpb.NewStruct(tt.req)
+			require.NoError(t, err)
+
+			account := &fakeAccount{}
+			s := serverApi{account: account}
+
+			err = call(t, sessions, "impersonation", tt.method, req, func(ctx context.Context) error {
+				return tt.call(s, ctx, req)
+			})
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			assert.Zero(t, account.calls, "the account must not be changed")
+
+			err = call(t, sessions, "student", tt.method, req, func(ctx context.Context) error {
+				return tt.call(s, ctx, req)
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 1, account.calls)
+		})
+	}
+}
+
+// call runs fn behind the auth interceptor, as the user of sessionToken.
+func call(t *testing.T, sessions fakeSessions, sessionToken string, method string, req any, fn func(ctx context.Context) error) error {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	interceptor := interceptors.Auth(log, sessions, nil, interceptors.Policies, true)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+sessionToken))
+	_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ any) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+type fakeSessions map[string]*domain.Principal
+
+func (f fakeSessions) Principal(_ context.Context, sessionToken string) (*domain.Principal, error) {
+	principal, ok := f[sessionToken]
+	if !ok {
+		return nil, auth.ErrSessionNotExists
+	}
+	copied := *principal
+	return &copied, nil
+}
+
+type fakeAccount struct {
+	calls int
+}
+
+func (a *fakeAccount) RequestEmailChange(context.Context, int64, string) error {
+	a.calls++
+	return nil
+}
+
+func (a *fakeAccount) ConfirmEmailChange(context.Context, string) error {
+	a.calls++
+	return nil
+}
+
+func (a *fakeAccount) RequestPhoneVerification(context.Context, int64, string) error {
+	a.calls++
+	return nil
+}
+
+func (a *fakeAccount) ConfirmPhoneVerification(context.Context, int64, string) error {
+	a.calls++
+	return nil
+}
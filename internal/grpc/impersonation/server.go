@@ -0,0 +1,112 @@
+// Package impersonation serves the impersonation of users by staff.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types:
+//
+//	conn.Invoke(ctx, "/user.Impersonation/Impersonate", req, &structpb.Struct{})
+//
+// with req = {"user_id": 1} returns {"session_token": "...", "user_id": 1,
+// "expires_at": "2024-01-01T00:00:00Z"}. The session token is used like any session
+// of the user until it expires or is passed to Logout.
+package impersonation
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"time"
+)
+
+var (
+	ErrUserNotFound            = errors.New("user not found")
+	ErrImpersonationNotAllowed = errors.New("user can not be impersonated")
+	ErrImpersonated            = errors.New("impersonation sessions can not impersonate")
+	ErrInternal                = errors.New("internal error")
+)
+
+type Impersonations interface {
+	Impersonate(ctx context.Context, impersonatorID int64, userID int64) (string, *domain.Impersonation, error)
+}
+
+type ImpersonationServer interface {
+	Impersonate(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+}
+
+type serverApi struct {
+	impersonations Impersonations
+}
+
+func Register(gRPC *grpc.Server, impersonations Impersonations) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{impersonations: impersonations})
+}
+
+func (s serverApi) Impersonate(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	userID := int64(req.GetFields()["user_id"].GetNumberValue())
+	err := validation.Validate(userID, validation.Required, validation.Min(int64(1)))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id: %s", err)
+	}
+
+	principal, _ := interceptors.PrincipalFromContext(ctx)
+	if !principal.IsUser() {
+		return nil, status.Error(codes.PermissionDenied, ErrImpersonationNotAllowed.Error())
+	}
+	if principal.Impersonated() {
+		return nil, status.Error(codes.PermissionDenied, ErrImpersonated.Error())
+	}
+
+	token, impersonation, err := s.impersonations.Impersonate(ctx, principal.UserID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUserNotExist):
+			return nil, status.Error(codes.NotFound, ErrUserNotFound.Error())
+		case errors.Is(err, auth.ErrImpersonationNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, ErrImpersonationNotAllowed.Error())
+		default:
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+	}
+
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"session_token": structpb.NewStringValue(token),
+		"user_id":       structpb.NewNumberValue(float64(impersonation.UserID)),
+		"expires_at":    structpb.NewStringValue(impersonation.ExpiresAt.UTC().Format(time.RFC3339)),
+	}}, nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.Impersonation",
+	HandlerType: (*ImpersonationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Impersonate",
+			Handler:    impersonateHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func impersonateHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImpersonationServer).Impersonate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Impersonation/Impersonate",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(ImpersonationServer).Impersonate(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
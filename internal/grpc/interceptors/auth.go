@@ -0,0 +1,149 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/serviceaccount"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"strings"
+)
+
+const (
+	// authorizationKey carries the session token of a user as "Bearer <token>".
+	authorizationKey = "authorization"
+	// apiKeyKey carries the API key of a service account.
+	apiKeyKey = "x-api-key"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("authentication required")
+	ErrInvalidSession   = errors.New("invalid or expired session")
+	ErrInvalidAPIKey    = errors.New("invalid api key")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInternal         = errors.New("internal error")
+)
+
+type Sessions interface {
+	Principal(ctx context.Context, sessionToken string) (*domain.Principal, error)
+}
+
+type ServiceAccounts interface {
+	Authenticate(ctx context.Context, key string) (*domain.APIKey, error)
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller of the RPC, ok is false for anonymous
+// calls.
+func PrincipalFromContext(ctx context.Context) (principal *domain.Principal, ok bool) {
+	principal, ok = ctx.Value(principalKey{}).(*domain.Principal)
+	return principal, ok
+}
+
+// Auth authenticates the session token and the API key sent in the metadata and
+// authorizes the call with the policy of the method. Invalid credentials are
+// rejected, except on public methods where they are ignored, so that a stale
+// session does not prevent logging in again. When apiKeysRequired is false,
+// anonymous calls to methods whose policy is KeyOptional are let through with a
+// warning, so that callers can be migrated. Every other method open to service
+// accounts still needs credentials.
+func Auth(
+	log *slog.Logger,
+	sessions Sessions,
+	accounts ServiceAccounts,
+	policies map[string]Policy,
+	apiKeysRequired bool,
+) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		const op = "interceptors.Auth"
+		log := log.With(slog.String("op", op), slog.String("method", info.FullMethod))
+
+		policy, ok := policies[info.FullMethod]
+		if !ok {
+			log.Error("method has no policy")
+			return nil, status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+		}
+
+		principal, err := authenticate(ctx, log, sessions, accounts)
+		if err != nil {
+			if !policy.Public {
+				return nil, err
+			}
+			principal = nil
+		}
+
+		if !policy.Allows(principal, req) {
+			switch {
+			case principal == nil && !apiKeysRequired && policy.KeyOptional:
+				log.Warn("call without credentials allowed, api keys are not required")
+			case principal == nil:
+				return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+			default:
+				log.Info("call denied", slog.Int64("user_id", principal.UserID), slog.String("role", principal.Role.String()))
+				return nil, status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+			}
+		}
+
+		if principal != nil {
+			ctx = context.WithValue(ctx, principalKey{}, principal)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authenticate returns the principal of the credentials in the metadata, or nil if
+// there are none.
+func authenticate(ctx context.Context, log *slog.Logger, sessions Sessions, accounts ServiceAccounts) (*domain.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var principal *domain.Principal
+
+	if values := md.Get(authorizationKey); len(values) > 0 {
+		sessionToken, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok || sessionToken == "" {
+			return nil, status.Error(codes.Unauthenticated, ErrInvalidSession.Error())
+		}
+
+		p, err := sessions.Principal(ctx, sessionToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrSessionNotExists), errors.Is(err, auth.ErrUserNotExist):
+				return nil, status.Error(codes.Unauthenticated, ErrInvalidSession.Error())
+			default:
+				log.Error("failed to authenticate session", logger.Err(err))
+				return nil, status.Error(codes.Internal, ErrInternal.Error())
+			}
+		}
+		principal = p
+	}
+
+	if values := md.Get(apiKeyKey); len(values) > 0 {
+		key, err := accounts.Authenticate(ctx, values[0])
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceaccount.ErrInvalidAPIKey),
+				errors.Is(err, serviceaccount.ErrAPIKeyExpired),
+				errors.Is(err, serviceaccount.ErrAPIKeyRevoked):
+				log.Info("api key rejected", logger.Err(err))
+				return nil, status.Error(codes.Unauthenticated, ErrInvalidAPIKey.Error())
+			default:
+				log.Error("failed to authenticate api key", logger.Err(err))
+				return nil, status.Error(codes.Internal, ErrInternal.Error())
+			}
+		}
+		if principal == nil {
+			principal = &domain.Principal{}
+		}
+		principal.APIKey = key
+	}
+
+	return principal, nil
+}
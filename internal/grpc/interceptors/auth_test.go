@@ -0,0 +1,134 @@
+package interceptors
+
+import (
+	"context"
+	userv1 "github.com/ARUMANDESU/uniclubs-protos/gen/go/user"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/serviceaccount"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+type fakeSessions map[string]*domain.Principal
+
+func (f fakeSessions) Principal(_ context.Context, sessionToken string) (*domain.Principal, error) {
+	principal, ok := f[sessionToken]
+	if !ok {
+		return nil, auth.ErrSessionNotExists
+	}
+	copied := *principal
+	return &copied, nil
+}
+
+type fakeServiceAccounts map[string]*domain.APIKey
+
+func (f fakeServiceAccounts) Authenticate(_ context.Context, key string) (*domain.APIKey, error) {
+	apiKey, ok := f[key]
+	if !ok {
+		return nil, serviceaccount.ErrInvalidAPIKey
+	}
+	return apiKey, nil
+}
+
+func TestAuth(t *testing.T) {
+	sessions := fakeSessions{
+		"student": {UserID: 1, Role: "USER"},
+		"admin":   {UserID: 2, Role: "ADMIN"},
+		"dsvr":    {UserID: 3, Role: "DSVR"},
+	}
+	accounts := fakeServiceAccounts{
+		"reader":  {ServiceAccountName: "notifications", Scopes: []string{domain.ScopeUsersRead}},
+		"checker": {ServiceAccountName: "clubs", Scopes: []string{domain.ScopeRolesCheck}},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name     string
+		method   string
+		req      any
+		session  string
+		key      string
+		required bool
+		code     codes.Code
+	}{
+		{name: "public method", method: "/user.User/Login", required: true, code: codes.OK},
+		{name: "invalid session on public method", method: "/user.User/Login", session: "unknown", required: true, code: codes.OK},
+		{name: "unknown method", method: "/user.User/Unknown", session: "admin", required: true, code: codes.PermissionDenied},
+		{name: "anonymous", method: "/user.User/DeleteUser", req: &userv1.DeleteUserRequest{UserId: 1}, required: true, code: codes.Unauthenticated},
+		{name: "invalid session", method: "/user.User/GetUser", session: "unknown", required: true, code: codes.Unauthenticated},
+		{name: "authenticated", method: "/user.User/GetUser", session: "student", required: true, code: codes.OK},
+		{name: "update self", method: "/user.User/UpdateUser", req: &userv1.UpdateUserRequest{UserId: 1}, session: "student", required: true, code: codes.OK},
+		{name: "update other user", method: "/user.User/UpdateUser", req: &userv1.UpdateUserRequest{UserId: 2}, session: "student", required: true, code: codes.PermissionDenied},
+		{name: "admin updates other user", method: "/user.User/UpdateUser", req: &userv1.UpdateUserRequest{UserId: 1}, session: "admin", required: true, code: codes.OK},
+		{name: "delete self", method: "/user.User/DeleteUser", req: &userv1.DeleteUserRequest{UserId: 1}, session: "student", required: true, code: codes.PermissionDenied},
+		{name: "supervisor deletes user", method: "/user.User/DeleteUser", req: &userv1.DeleteUserRequest{UserId: 1}, session: "dsvr", required: true, code: codes.OK},
+		{name: "scoped key", method: "/user.User/SearchUsers", key: "reader", required: true, code: codes.OK},
+		{name: "missing scope", method: "/user.User/SearchUsers", key: "checker", required: true, code: codes.PermissionDenied},
+		{name: "unknown key", method: "/user.User/SearchUsers", key: "unknown", required: true, code: codes.Unauthenticated},
+		{name: "missing key", method: "/user.User/CheckUserRole", required: true, code: codes.Unauthenticated},
+		{name: "missing key not required", method: "/user.User/CheckUserRole", required: false, code: codes.OK},
+		{name: "missing credentials not required", method: "/user.User/DeleteUser", required: false, code: codes.Unauthenticated},
+		{name: "missing key not required to grant role", method: "/user.Roles/GrantScopedRole", req: &structpb.Struct{}, required: false, code: codes.Unauthenticated},
+		{name: "missing key not required to revoke role", method: "/user.Roles/RevokeScopedRole", req: &structpb.Struct{}, required: false, code: codes.Unauthenticated},
+		{name: "missing key not required to search users", method: "/user.User/SearchUsers", required: false, code: codes.Unauthenticated},
+		{name: "check own permission", method: "/user.Permissions/CheckPermission", req: permissionRequest(t, 1), session: "student", required: true, code: codes.OK},
+		{name: "check permission of other user", method: "/user.Permissions/CheckPermission", req: permissionRequest(t, 2), session: "student", required: true, code: codes.PermissionDenied},
+		{name: "key and session", method: "/user.User/UpdateUser", req: &userv1.UpdateUserRequest{UserId: 1}, session: "student", key: "reader", required: true, code: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tt.session != "" {
+				md.Set(authorizationKey, "Bearer "+tt.session)
+			}
+			if tt.key != "" {
+				md.Set(apiKeyKey, tt.key)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+
+			var called bool
+			handler := func(ctx context.Context, req any) (any, error) {
+				called = true
+				principal, ok := PrincipalFromContext(ctx)
+				if _, known := sessions[tt.session]; known {
+					require.True(t, ok)
+					assert.Equal(t, sessions[tt.session].UserID, principal.UserID)
+				}
+				if _, known := accounts[tt.key]; known {
+					require.True(t, ok)
+					assert.Equal(t, accounts[tt.key], principal.APIKey)
+				}
+				return nil, nil
+			}
+
+			interceptor := Auth(log, sessions, accounts, Policies, tt.required)
+			_, err := interceptor(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			require.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.code == codes.OK, called)
+		})
+	}
+}
+
+func permissionRequest(t *testing.T, userID int64) *structpb.Struct {
+	req, err := structpb.NewStruct(map[string]any{"user_id": userID, "permission": "events:manage"})
+	require.NoError(t, err)
+	return req
+}
+
+func TestPolicies_CoverEveryMethod(t *testing.T) {
+	for _, method := range userv1.User_ServiceDesc.Methods {
+		fullMethod := "/" + userv1.User_ServiceDesc.ServiceName + "/" + method.MethodName
+		_, ok := Policies[fullMethod]
+		assert.True(t, ok, "%s has no policy", fullMethod)
+	}
+}
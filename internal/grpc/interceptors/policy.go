@@ -0,0 +1,117 @@
+package interceptors
+
+import (
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Policy declares who may call a method. A call is allowed if any of the rules
+// allows it.
+type Policy struct {
+	// Public methods can be called without credentials.
+	Public bool
+	// Authenticated allows any user with a session.
+	Authenticated bool
+	// Roles allows users with one of the roles.
+	Roles []domain.Role
+	// Self allows users to call the method for themselves, as given by the user_id
+	// field of the request, or of the struct for services without protos.
+	Self bool
+	// Scope allows service accounts whose API key has the scope.
+	Scope string
+	// KeyOptional lets anonymous calls through when API keys are not required, so
+	// that services calling the method can be migrated to keys. It is only set on
+	// read-only checks made between services.
+	KeyOptional bool
+}
+
+// Allows reports whether the principal may make the call, principal is nil for
+// anonymous calls.
+func (p Policy) Allows(principal *domain.Principal, req any) bool {
+	switch {
+	case p.Public:
+		return true
+	case p.Authenticated && principal.IsUser():
+		return true
+	case len(p.Roles) > 0 && principal.HasRole(p.Roles...):
+		return true
+	case p.Self && principal.IsUser() && requestUserID(req) == principal.UserID:
+		return true
+	case p.Scope != "" && principal.HasScope(p.Scope):
+		return true
+	default:
+		return false
+	}
+}
+
+func requestUserID(req any) int64 {
+	switch r := req.(type) {
+	case interface{ GetUserId() int64 }:
+		return r.GetUserId()
+	case *structpb.Struct:
+		return int64(r.GetFields()["user_id"].GetNumberValue())
+	default:
+		return 0
+	}
+}
+
+var (
+	admins      = []domain.Role{domain.RoleAdmin}
+	supervisors = []domain.Role{domain.RoleAdmin, domain.RoleDSVR}
+)
+
+// Policies holds the policy of every method served. Methods without a policy are
+// denied.
+var Policies = map[string]Policy{
+	"/user.User/Register":       {Public: true},
+	"/user.User/Login":          {Public: true},
+	"/user.User/Logout":         {Public: true},
+	"/user.User/Authenticate":   {Public: true},
+	"/user.User/ActivateUser":   {Public: true},
+	"/user.User/GetUser":        {Authenticated: true, Scope: domain.ScopeUsersRead},
+	"/user.User/SearchUsers":    {Roles: supervisors, Scope: domain.ScopeUsersRead},
+	"/user.User/CheckUserRole":  {Scope: domain.ScopeRolesCheck, KeyOptional: true},
+	"/user.User/UpdateUser":     {Self: true, Roles: admins},
+	"/user.User/UpdateAvatar":   {Self: true, Roles: admins},
+	"/user.User/DeleteUser":     {Roles: supervisors},
+	"/user.User/ChangeUserRole": {Roles: supervisors},
+	"/user.User/LockAccount":    {Roles: supervisors},
+	"/user.User/UnlockAccount":  {Roles: supervisors},
+	"/user.Tokens/GetJWKS":      {Public: true},
+	"/user.Tokens/Refresh":      {Public: true},
+
+	"/user.Permissions/CheckPermission":     {Self: true, Roles: supervisors, Scope: domain.ScopeRolesCheck, KeyOptional: true},
+	"/user.Permissions/ListPermissions":     {Self: true, Roles: supervisors, Scope: domain.ScopeRolesCheck, KeyOptional: true},
+	"/user.Permissions/ListRolePermissions": {Authenticated: true, Scope: domain.ScopeRolesCheck, KeyOptional: true},
+	"/user.Permissions/GrantPermission":     {Roles: supervisors},
+	"/user.Permissions/RevokePermission":    {Roles: supervisors},
+
+	"/user.Roles/GrantScopedRole":  {Roles: supervisors, Scope: domain.ScopeRolesManage},
+	"/user.Roles/RevokeScopedRole": {Roles: supervisors, Scope: domain.ScopeRolesManage},
+	"/user.Roles/ListScopedRoles":  {Self: true, Roles: supervisors, Scope: domain.ScopeRolesCheck, KeyOptional: true},
+
+	"/user.Impersonation/Impersonate": {Roles: supervisors},
+
+	"/user.Invitations/CreateInvitation": {Roles: supervisors},
+	"/user.Invitations/ListInvitations":  {Roles: supervisors},
+	"/user.Invitations/RevokeInvitation": {Roles: supervisors},
+
+	"/user.Account/RequestEmailChange": {Authenticated: true},
+	"/user.Account/ConfirmEmailChange": {Public: true},
+
+	"/user.Account/RequestPhoneVerification": {Authenticated: true},
+	"/user.Account/ConfirmPhoneVerification": {Authenticated: true},
+
+	"/user.MFA/Enroll":    {Authenticated: true},
+	"/user.MFA/Confirm":   {Authenticated: true},
+	"/user.MFA/Disable":   {Authenticated: true},
+	"/user.MFA/VerifyMFA": {Public: true},
+
+	"/user.Passkeys/BeginRegistration":  {Authenticated: true},
+	"/user.Passkeys/FinishRegistration": {Authenticated: true},
+	"/user.Passkeys/BeginLogin":         {Public: true},
+	"/user.Passkeys/FinishLogin":        {Public: true},
+
+	"/user.MagicLinks/RequestMagicLink": {Public: true},
+	"/user.MagicLinks/RedeemMagicLink":  {Public: true},
+}
@@ -0,0 +1,227 @@
+// Package invitations serves the invitation codes people register with while
+// registration is invite only.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types:
+//
+//	conn.Invoke(ctx, "/user.Invitations/CreateInvitation", req, &structpb.Struct{})
+//
+// with req = {"max_uses": 10, "email": "student@astanait.edu.kz", "role": "MODER",
+// "expires_at": "2024-01-01T00:00:00Z"} returns the invitation with its "code", which
+// is not shown again. All the fields are optional, an invitation is single use and
+// does not expire by default.
+//
+//	conn.Invoke(ctx, "/user.Invitations/ListInvitations", &emptypb.Empty{}, &structpb.ListValue{})
+//	conn.Invoke(ctx, "/user.Invitations/RevokeInvitation", req, &emptypb.Empty{})
+//
+// list the invitations without their codes and revoke the invitation of
+// req = {"id": 1}. The code is sent to Register in the x-invite-code metadata header.
+package invitations
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/invitation"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"time"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInternal           = errors.New("internal error")
+)
+
+type Invitations interface {
+	CreateInvitation(ctx context.Context, invitation *domain.Invitation) (string, error)
+	ListInvitations(ctx context.Context) ([]*domain.Invitation, error)
+	RevokeInvitation(ctx context.Context, invitationID int64) error
+}
+
+type InvitationsServer interface {
+	CreateInvitation(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+	ListInvitations(ctx context.Context, req *emptypb.Empty) (*structpb.ListValue, error)
+	RevokeInvitation(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+}
+
+type serverApi struct {
+	invitations Invitations
+}
+
+func Register(gRPC *grpc.Server, invitations Invitations) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{invitations: invitations})
+}
+
+func (s serverApi) CreateInvitation(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	fields := req.GetFields()
+	principal, _ := interceptors.PrincipalFromContext(ctx)
+
+	inv := &domain.Invitation{
+		Email:     fields["email"].GetStringValue(),
+		Role:      domain.Role(fields["role"].GetStringValue()),
+		MaxUses:   1,
+		CreatedBy: principal.UserID,
+	}
+	if value, ok := fields["max_uses"]; ok {
+		inv.MaxUses = int(value.GetNumberValue())
+	}
+	if value, ok := fields["expires_at"]; ok {
+		expiresAt, err := time.Parse(time.RFC3339, value.GetStringValue())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "expires_at: must be an RFC 3339 timestamp")
+		}
+		// timestamp columns do not keep the zone, so they are stored in UTC
+		expiresAt = expiresAt.UTC()
+		inv.ExpiresAt = &expiresAt
+	}
+
+	code, err := s.invitations.CreateInvitation(ctx, inv)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	res := invitationToStruct(inv)
+	res.Fields["code"] = structpb.NewStringValue(code)
+
+	return res, nil
+}
+
+func (s serverApi) ListInvitations(ctx context.Context, _ *emptypb.Empty) (*structpb.ListValue, error) {
+	invitations, err := s.invitations.ListInvitations(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	list := &structpb.ListValue{Values: make([]*structpb.Value, len(invitations))}
+	for i, inv := range invitations {
+		list.Values[i] = structpb.NewStructValue(invitationToStruct(inv))
+	}
+
+	return list, nil
+}
+
+func (s serverApi) RevokeInvitation(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	invitationID := int64(req.GetFields()["id"].GetNumberValue())
+	err := validation.Validate(invitationID, validation.Required, validation.Min(int64(1)))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "id: %s", err)
+	}
+
+	err = s.invitations.RevokeInvitation(ctx, invitationID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func invitationToStruct(inv *domain.Invitation) *structpb.Struct {
+	fields := map[string]*structpb.Value{
+		"id":         structpb.NewNumberValue(float64(inv.ID)),
+		"email":      structpb.NewStringValue(inv.Email),
+		"role":       structpb.NewStringValue(inv.Role.String()),
+		"max_uses":   structpb.NewNumberValue(float64(inv.MaxUses)),
+		"uses":       structpb.NewNumberValue(float64(inv.Uses)),
+		"created_by": structpb.NewNumberValue(float64(inv.CreatedBy)),
+		"created_at": structpb.NewStringValue(inv.CreatedAt.UTC().Format(time.RFC3339)),
+	}
+	if inv.ExpiresAt != nil {
+		fields["expires_at"] = structpb.NewStringValue(inv.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if inv.RevokedAt != nil {
+		fields["revoked_at"] = structpb.NewStringValue(inv.RevokedAt.UTC().Format(time.RFC3339))
+	}
+	return &structpb.Struct{Fields: fields}
+}
+
+func toStatus(err error) error {
+	var validationErrs validation.Errors
+	switch {
+	case errors.As(err, &validationErrs):
+		return status.Error(codes.InvalidArgument, validationErrs.Error())
+	case errors.Is(err, invitation.ErrInvitationNotExists):
+		return status.Error(codes.NotFound, ErrInvitationNotFound.Error())
+	default:
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.Invitations",
+	HandlerType: (*InvitationsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateInvitation",
+			Handler:    createInvitationHandler,
+		},
+		{
+			MethodName: "ListInvitations",
+			Handler:    listInvitationsHandler,
+		},
+		{
+			MethodName: "RevokeInvitation",
+			Handler:    revokeInvitationHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func createInvitationHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvitationsServer).CreateInvitation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Invitations/CreateInvitation",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(InvitationsServer).CreateInvitation(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listInvitationsHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvitationsServer).ListInvitations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Invitations/ListInvitations",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(InvitationsServer).ListInvitations(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func revokeInvitationHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvitationsServer).RevokeInvitation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Invitations/RevokeInvitation",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(InvitationsServer).RevokeInvitation(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -0,0 +1,189 @@
+// Package magiclinks serves passwordless login with links sent by email.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types:
+//
+//	conn.Invoke(ctx, "/user.MagicLinks/RequestMagicLink", req, &emptypb.Empty{})
+//
+// with req = {"email": "student@astanait.edu.kz"} mails a single use login link.
+// It succeeds for unknown emails too, so that it does not reveal which emails are
+// registered.
+//
+//	conn.Invoke(ctx, "/user.MagicLinks/RedeemMagicLink", req, &structpb.Struct{}, grpc.Header(&md), grpc.Trailer(&trailer))
+//
+// with the token of the link, req = {"token": "..."}, returns {"session_token":
+// "...", "user_id": 1} and the access and refresh tokens in the same headers as
+// Login. Like Login, users with two-factor authentication get Unauthenticated and
+// an x-mfa-challenge trailer instead, which is passed to user.MFA/VerifyMFA.
+package magiclinks
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// accessTokenKey and refreshTokenKey are the header keys carrying the tokens,
+	// the same as the ones Login uses.
+	accessTokenKey  = "x-access-token"
+	refreshTokenKey = "x-refresh-token"
+	// mfaChallengeKey is the trailer key carrying the MFA challenge, the same as
+	// the one Login uses.
+	mfaChallengeKey = "x-mfa-challenge"
+)
+
+var (
+	ErrMagicLinkNotFound = errors.New("magic link not found or expired")
+	ErrTooManyRequests   = errors.New("too many magic links requested, try again later")
+	ErrLockedOut         = errors.New("too many failed login attempts, try again later")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrMFARequired       = errors.New("second factor required")
+	ErrTooManyAttempts   = errors.New("too many invalid second factors, try again later")
+	ErrInternal          = errors.New("internal error")
+)
+
+type MagicLinks interface {
+	RequestMagicLink(ctx context.Context, email string) error
+	RedeemMagicLink(ctx context.Context, token string) (*domain.User, string, error)
+}
+
+// Tokens mints signed access tokens. It is nil when access tokens are disabled.
+type Tokens interface {
+	Issue(ctx context.Context, user *domain.User, sessionToken string) (accessToken string, refreshToken string, err error)
+}
+
+type MagicLinksServer interface {
+	RequestMagicLink(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	RedeemMagicLink(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+}
+
+type serverApi struct {
+	magicLinks MagicLinks
+	tokens     Tokens
+}
+
+func Register(gRPC *grpc.Server, magicLinks MagicLinks, tokens Tokens) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{magicLinks: magicLinks, tokens: tokens})
+}
+
+func (s serverApi) RequestMagicLink(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	email := req.GetFields()["email"].GetStringValue()
+	err := validation.Validate(email, validation.Required, is.Email)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "email: %s", err)
+	}
+
+	err = s.magicLinks.RequestMagicLink(ctx, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrTooManyRequests):
+			return nil, status.Error(codes.ResourceExhausted, ErrTooManyRequests.Error())
+		case errors.Is(err, auth.ErrTooManyAttempts):
+			return nil, status.Error(codes.ResourceExhausted, ErrLockedOut.Error())
+		default:
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) RedeemMagicLink(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	token := req.GetFields()["token"].GetStringValue()
+	err := validation.Validate(token, validation.Required)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "token: %s", err)
+	}
+
+	user, sessionToken, err := s.magicLinks.RedeemMagicLink(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMFARequired):
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(mfaChallengeKey, sessionToken))
+			return nil, status.Error(codes.Unauthenticated, ErrMFARequired.Error())
+		case errors.Is(err, auth.ErrTooManyAttempts):
+			return nil, status.Error(codes.ResourceExhausted, ErrTooManyAttempts.Error())
+		case errors.Is(err, auth.ErrMagicLinkNotExists):
+			return nil, status.Error(codes.NotFound, ErrMagicLinkNotFound.Error())
+		case errors.Is(err, auth.ErrUserNotExist):
+			return nil, status.Error(codes.NotFound, ErrUserNotFound.Error())
+		default:
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+	}
+
+	if s.tokens != nil {
+		accessToken, refreshToken, err := s.tokens.Issue(ctx, user, sessionToken)
+		if err != nil {
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs(accessTokenKey, accessToken, refreshTokenKey, refreshToken))
+	}
+
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"session_token": structpb.NewStringValue(sessionToken),
+		"user_id":       structpb.NewNumberValue(float64(user.ID)),
+	}}, nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.MagicLinks",
+	HandlerType: (*MagicLinksServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestMagicLink",
+			Handler:    requestMagicLinkHandler,
+		},
+		{
+			MethodName: "RedeemMagicLink",
+			Handler:    redeemMagicLinkHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func requestMagicLinkHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MagicLinksServer).RequestMagicLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.MagicLinks/RequestMagicLink",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(MagicLinksServer).RequestMagicLink(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func redeemMagicLinkHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MagicLinksServer).RedeemMagicLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.MagicLinks/RedeemMagicLink",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(MagicLinksServer).RedeemMagicLink(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
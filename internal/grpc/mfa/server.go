@@ -0,0 +1,330 @@
+// Package mfa serves the enrolment of users in two-factor authentication and the
+// second step of their login.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types:
+//
+//	conn.Invoke(ctx, "/user.MFA/Enroll", &emptypb.Empty{}, &structpb.Struct{})
+//
+// returns {"uri": "otpauth://totp/..."} with a new TOTP secret of the calling user,
+// shown as a QR code by the client. The secret is used for login once
+//
+//	conn.Invoke(ctx, "/user.MFA/Confirm", req, &structpb.Struct{})
+//
+// is called with a code of the authenticator app, req = {"code": "123456"}, which
+// returns {"recovery_codes": [...]}. They are not shown again.
+//
+//	conn.Invoke(ctx, "/user.MFA/Disable", req, &emptypb.Empty{})
+//
+// turns two-factor authentication off with req = {"code": "123456"}, a TOTP or
+// recovery code. When Login fails with Unauthenticated and sends an x-mfa-challenge
+// trailer, the login is completed by
+//
+//	conn.Invoke(ctx, "/user.MFA/VerifyMFA", req, &structpb.Struct{}, grpc.Header(&md))
+//
+// with req = {"challenge": "...", "code": "123456"}, which returns {"session_token":
+// "...", "user_id": 1} and the access and refresh tokens in the same headers as Login.
+package mfa
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/mfa"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// accessTokenKey and refreshTokenKey are the header keys carrying the tokens, the
+// same as the ones Login uses.
+const (
+	accessTokenKey  = "x-access-token"
+	refreshTokenKey = "x-refresh-token"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserRequired      = errors.New("only users can manage two-factor authentication")
+	ErrImpersonated      = errors.New("impersonation sessions can not manage two-factor authentication")
+	ErrMFAUnavailable    = errors.New("two-factor authentication is not available")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrEnrolmentNotFound = errors.New("no pending enrolment, call Enroll first")
+	ErrInvalidCode       = errors.New("invalid code")
+	ErrChallengeNotFound = errors.New("mfa challenge not found or expired, log in again")
+	ErrTooManyAttempts   = errors.New("too many invalid codes, try again later")
+	ErrInternal          = errors.New("internal error")
+)
+
+type MFA interface {
+	Enroll(ctx context.Context, userID int64) (uri string, err error)
+	Confirm(ctx context.Context, userID int64, code string) (recoveryCodes []string, err error)
+	Disable(ctx context.Context, userID int64, code string) error
+}
+
+type Auth interface {
+	VerifyMFA(ctx context.Context, challenge string, code string) (*domain.User, string, error)
+}
+
+// Tokens mints signed access tokens. It is nil when access tokens are disabled.
+type Tokens interface {
+	Issue(ctx context.Context, user *domain.User, sessionToken string) (accessToken string, refreshToken string, err error)
+}
+
+type MFAServer interface {
+	Enroll(ctx context.Context, req *emptypb.Empty) (*structpb.Struct, error)
+	Confirm(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+	Disable(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	VerifyMFA(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+}
+
+type serverApi struct {
+	mfa    MFA
+	auth   Auth
+	tokens Tokens
+}
+
+func Register(gRPC *grpc.Server, mfa MFA, auth Auth, tokens Tokens) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{mfa: mfa, auth: auth, tokens: tokens})
+}
+
+func (s serverApi) Enroll(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, err := s.mfa.Enroll(ctx, userID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"uri": structpb.NewStringValue(uri),
+	}}, nil
+}
+
+func (s serverApi) Confirm(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	code := req.GetFields()["code"].GetStringValue()
+	err := validation.Validate(code, validation.Required)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "code: %s", err)
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.mfa.Confirm(ctx, userID, code)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	list := &structpb.ListValue{Values: make([]*structpb.Value, len(recoveryCodes))}
+	for i, recoveryCode := range recoveryCodes {
+		list.Values[i] = structpb.NewStringValue(recoveryCode)
+	}
+
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"recovery_codes": structpb.NewListValue(list),
+	}}, nil
+}
+
+func (s serverApi) Disable(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	code := req.GetFields()["code"].GetStringValue()
+	err := validation.Validate(code, validation.Required)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "code: %s", err)
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mfa.Disable(ctx, userID, code)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) VerifyMFA(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	fields := req.GetFields()
+	challenge := fields["challenge"].GetStringValue()
+	code := fields["code"].GetStringValue()
+	err := validation.Errors{
+		"challenge": validation.Validate(challenge, validation.Required),
+		"code":      validation.Validate(code, validation.Required),
+	}.Filter()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	user, token, err := s.auth.VerifyMFA(ctx, challenge, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMFAChallengeNotExists):
+			return nil, status.Error(codes.Unauthenticated, ErrChallengeNotFound.Error())
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, ErrInvalidCode.Error())
+		case errors.Is(err, auth.ErrTooManyAttempts):
+			return nil, status.Error(codes.ResourceExhausted, ErrTooManyAttempts.Error())
+		case errors.Is(err, auth.ErrUserNotExist):
+			return nil, status.Error(codes.NotFound, ErrUserNotFound.Error())
+		default:
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+	}
+
+	if s.tokens != nil {
+		accessToken, refreshToken, err := s.tokens.Issue(ctx, user, token)
+		if err != nil {
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs(accessTokenKey, accessToken, refreshTokenKey, refreshToken))
+	}
+
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"session_token": structpb.NewStringValue(token),
+		"user_id":       structpb.NewNumberValue(float64(user.ID)),
+	}}, nil
+}
+
+// callerID returns the user calling the RPC. Impersonators can not change the
+// second factor of the user they impersonate.
+func callerID(ctx context.Context) (int64, error) {
+	principal, _ := interceptors.PrincipalFromContext(ctx)
+	if !principal.IsUser() {
+		return 0, status.Error(codes.PermissionDenied, ErrUserRequired.Error())
+	}
+	if principal.Impersonated() {
+		return 0, status.Error(codes.PermissionDenied, ErrImpersonated.Error())
+	}
+
+	return principal.UserID, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, mfa.ErrUserNotExist):
+		return status.Error(codes.NotFound, ErrUserNotFound.Error())
+	case errors.Is(err, mfa.ErrMFAUnavailable):
+		return status.Error(codes.FailedPrecondition, ErrMFAUnavailable.Error())
+	case errors.Is(err, mfa.ErrMFANotEnabled):
+		return status.Error(codes.FailedPrecondition, ErrMFANotEnabled.Error())
+	case errors.Is(err, mfa.ErrMFAAlreadyEnabled):
+		return status.Error(codes.AlreadyExists, ErrMFAAlreadyEnabled.Error())
+	case errors.Is(err, mfa.ErrMFAEnrolmentNotExist):
+		return status.Error(codes.FailedPrecondition, ErrEnrolmentNotFound.Error())
+	case errors.Is(err, mfa.ErrInvalidCode):
+		return status.Error(codes.InvalidArgument, ErrInvalidCode.Error())
+	default:
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.MFA",
+	HandlerType: (*MFAServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Enroll",
+			Handler:    enrollHandler,
+		},
+		{
+			MethodName: "Confirm",
+			Handler:    confirmHandler,
+		},
+		{
+			MethodName: "Disable",
+			Handler:    disableHandler,
+		},
+		{
+			MethodName: "VerifyMFA",
+			Handler:    verifyMFAHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func enrollHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MFAServer).Enroll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.MFA/Enroll",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(MFAServer).Enroll(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func confirmHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MFAServer).Confirm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.MFA/Confirm",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(MFAServer).Confirm(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func disableHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MFAServer).Disable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.MFA/Disable",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(MFAServer).Disable(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func verifyMFAHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MFAServer).VerifyMFA(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.MFA/VerifyMFA",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(MFAServer).VerifyMFA(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -0,0 +1,278 @@
+// Package passkeys serves the WebAuthn ceremonies registering passkeys and logging
+// in with them.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types. The WebAuthn options and responses are
+// passed as JSON strings, as the browser API produces and consumes them:
+//
+//	conn.Invoke(ctx, "/user.Passkeys/BeginRegistration", &emptypb.Empty{}, &wrapperspb.StringValue{})
+//	conn.Invoke(ctx, "/user.Passkeys/FinishRegistration", wrapperspb.String(attestation), &emptypb.Empty{})
+//
+// register a passkey for the calling user: the first returns the
+// PublicKeyCredentialCreationOptions for navigator.credentials.create, and the
+// second takes the credential it created.
+//
+//	conn.Invoke(ctx, "/user.Passkeys/BeginLogin", &emptypb.Empty{}, &wrapperspb.StringValue{})
+//	conn.Invoke(ctx, "/user.Passkeys/FinishLogin", wrapperspb.String(assertion), &structpb.Struct{}, grpc.Header(&md))
+//
+// log in without a password: the first returns the
+// PublicKeyCredentialRequestOptions for navigator.credentials.get, and the second
+// takes the assertion it returned and returns {"session_token": "...", "user_id": 1}
+// and the access and refresh tokens in the same headers as Login.
+package passkeys
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// accessTokenKey and refreshTokenKey are the header keys carrying the tokens, the
+// same as the ones Login uses.
+const (
+	accessTokenKey  = "x-access-token"
+	refreshTokenKey = "x-refresh-token"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserRequired      = errors.New("only users can register passkeys")
+	ErrImpersonated      = errors.New("impersonation sessions can not register passkeys")
+	ErrCeremonyNotFound  = errors.New("passkey ceremony not found or expired, start again")
+	ErrInvalidPasskey    = errors.New("invalid passkey response")
+	ErrPasskeyExists     = errors.New("passkey already registered")
+	ErrInvalidCredential = errors.New("passkey not accepted")
+	ErrInternal          = errors.New("internal error")
+)
+
+type Passkeys interface {
+	BeginRegistration(ctx context.Context, userID int64) (options []byte, err error)
+	FinishRegistration(ctx context.Context, userID int64, response []byte) error
+	BeginLogin(ctx context.Context) (options []byte, err error)
+	PasskeyLogin(ctx context.Context, response []byte) (*domain.User, string, error)
+}
+
+// Tokens mints signed access tokens. It is nil when access tokens are disabled.
+type Tokens interface {
+	Issue(ctx context.Context, user *domain.User, sessionToken string) (accessToken string, refreshToken string, err error)
+}
+
+type PasskeysServer interface {
+	BeginRegistration(ctx context.Context, req *emptypb.Empty) (*wrapperspb.StringValue, error)
+	FinishRegistration(ctx context.Context, req *wrapperspb.StringValue) (*emptypb.Empty, error)
+	BeginLogin(ctx context.Context, req *emptypb.Empty) (*wrapperspb.StringValue, error)
+	FinishLogin(ctx context.Context, req *wrapperspb.StringValue) (*structpb.Struct, error)
+}
+
+type serverApi struct {
+	passkeys Passkeys
+	tokens   Tokens
+}
+
+func Register(gRPC *grpc.Server, passkeys Passkeys, tokens Tokens) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{passkeys: passkeys, tokens: tokens})
+}
+
+func (s serverApi) BeginRegistration(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := s.passkeys.BeginRegistration(ctx, userID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return wrapperspb.String(string(options)), nil
+}
+
+func (s serverApi) FinishRegistration(ctx context.Context, req *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	err := validation.Validate(req.GetValue(), validation.Required)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "value: %s", err)
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.passkeys.FinishRegistration(ctx, userID, []byte(req.GetValue()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) BeginLogin(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
+	options, err := s.passkeys.BeginLogin(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return wrapperspb.String(string(options)), nil
+}
+
+func (s serverApi) FinishLogin(ctx context.Context, req *wrapperspb.StringValue) (*structpb.Struct, error) {
+	err := validation.Validate(req.GetValue(), validation.Required)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "value: %s", err)
+	}
+
+	user, token, err := s.passkeys.PasskeyLogin(ctx, []byte(req.GetValue()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if s.tokens != nil {
+		accessToken, refreshToken, err := s.tokens.Issue(ctx, user, token)
+		if err != nil {
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs(accessTokenKey, accessToken, refreshTokenKey, refreshToken))
+	}
+
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"session_token": structpb.NewStringValue(token),
+		"user_id":       structpb.NewNumberValue(float64(user.ID)),
+	}}, nil
+}
+
+// callerID returns the user calling the RPC. Impersonators can not register a
+// passkey, it would let them log in as the user after the impersonation ends.
+func callerID(ctx context.Context) (int64, error) {
+	principal, _ := interceptors.PrincipalFromContext(ctx)
+	if !principal.IsUser() {
+		return 0, status.Error(codes.PermissionDenied, ErrUserRequired.Error())
+	}
+	if principal.Impersonated() {
+		return 0, status.Error(codes.PermissionDenied, ErrImpersonated.Error())
+	}
+
+	return principal.UserID, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrUserNotExist):
+		return status.Error(codes.NotFound, ErrUserNotFound.Error())
+	case errors.Is(err, auth.ErrPasskeyCeremonyNotExists):
+		return status.Error(codes.FailedPrecondition, ErrCeremonyNotFound.Error())
+	case errors.Is(err, auth.ErrInvalidPasskey):
+		return status.Error(codes.InvalidArgument, ErrInvalidPasskey.Error())
+	case errors.Is(err, auth.ErrPasskeyExists):
+		return status.Error(codes.AlreadyExists, ErrPasskeyExists.Error())
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, ErrInvalidCredential.Error())
+	default:
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.Passkeys",
+	HandlerType: (*PasskeysServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "BeginRegistration",
+			Handler:    beginRegistrationHandler,
+		},
+		{
+			MethodName: "FinishRegistration",
+			Handler:    finishRegistrationHandler,
+		},
+		{
+			MethodName: "BeginLogin",
+			Handler:    beginLoginHandler,
+		},
+		{
+			MethodName: "FinishLogin",
+			Handler:    finishLoginHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func beginRegistrationHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PasskeysServer).BeginRegistration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Passkeys/BeginRegistration",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PasskeysServer).BeginRegistration(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func finishRegistrationHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PasskeysServer).FinishRegistration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Passkeys/FinishRegistration",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PasskeysServer).FinishRegistration(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func beginLoginHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PasskeysServer).BeginLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Passkeys/BeginLogin",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PasskeysServer).BeginLogin(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func finishLoginHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PasskeysServer).FinishLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Passkeys/FinishLogin",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PasskeysServer).FinishLogin(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -0,0 +1,289 @@
+// Package permissions serves permission checks and the editing of the permissions
+// granted to roles.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types. Requests with several fields are
+// structs:
+//
+//	conn.Invoke(ctx, "/user.Permissions/CheckPermission", req, &wrapperspb.BoolValue{})
+//
+// with req = {"user_id": 1, "permission": "events:manage"} reports whether the user
+// has the permission,
+//
+//	conn.Invoke(ctx, "/user.Permissions/ListPermissions", req, &structpb.ListValue{})
+//
+// with req = {"user_id": 1} returns the names of the permissions of the user,
+//
+//	conn.Invoke(ctx, "/user.Permissions/ListRolePermissions", wrapperspb.String(role), &structpb.ListValue{})
+//
+// returns the names of the permissions granted to the role, and
+//
+//	conn.Invoke(ctx, "/user.Permissions/GrantPermission", req, &emptypb.Empty{})
+//	conn.Invoke(ctx, "/user.Permissions/RevokePermission", req, &emptypb.Empty{})
+//
+// with req = {"role": "MODER", "permission": "events:manage"} edit the grants.
+package permissions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/permission"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrInternal           = errors.New("internal error")
+)
+
+type Permissions interface {
+	CheckPermission(ctx context.Context, userID int64, permission string) (bool, error)
+	ListPermissions(ctx context.Context, userID int64) ([]string, error)
+	ListRolePermissions(ctx context.Context, role string) ([]string, error)
+	GrantPermission(ctx context.Context, role string, permission string) error
+	RevokePermission(ctx context.Context, role string, permission string) error
+}
+
+type PermissionsServer interface {
+	CheckPermission(ctx context.Context, req *structpb.Struct) (*wrapperspb.BoolValue, error)
+	ListPermissions(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error)
+	ListRolePermissions(ctx context.Context, req *wrapperspb.StringValue) (*structpb.ListValue, error)
+	GrantPermission(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	RevokePermission(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+}
+
+type serverApi struct {
+	permissions Permissions
+}
+
+func Register(gRPC *grpc.Server, permissions Permissions) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{permissions: permissions})
+}
+
+func (s serverApi) CheckPermission(ctx context.Context, req *structpb.Struct) (*wrapperspb.BoolValue, error) {
+	userID, err := userIDField(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	perm := req.GetFields()["permission"].GetStringValue()
+	err = validation.Validate(perm, validation.Required)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("permission: %s", err))
+	}
+
+	hasPermission, err := s.permissions.CheckPermission(ctx, userID, perm)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return wrapperspb.Bool(hasPermission), nil
+}
+
+func (s serverApi) ListPermissions(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error) {
+	userID, err := userIDField(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	perms, err := s.permissions.ListPermissions(ctx, userID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return stringList(perms), nil
+}
+
+func (s serverApi) ListRolePermissions(ctx context.Context, req *wrapperspb.StringValue) (*structpb.ListValue, error) {
+	err := validation.Validate(&req.Value, validation.Required)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	perms, err := s.permissions.ListRolePermissions(ctx, req.GetValue())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return stringList(perms), nil
+}
+
+func (s serverApi) GrantPermission(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	fields := req.GetFields()
+	err := s.permissions.GrantPermission(ctx, fields["role"].GetStringValue(), fields["permission"].GetStringValue())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) RevokePermission(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	fields := req.GetFields()
+	err := s.permissions.RevokePermission(ctx, fields["role"].GetStringValue(), fields["permission"].GetStringValue())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// userIDField returns the user_id field of a struct request.
+func userIDField(req *structpb.Struct) (int64, error) {
+	value := req.GetFields()["user_id"].GetNumberValue()
+	if value <= 0 || value != float64(int64(value)) {
+		return 0, errors.New("user_id: must be a positive integer")
+	}
+
+	return int64(value), nil
+}
+
+func stringList(values []string) *structpb.ListValue {
+	list := &structpb.ListValue{Values: make([]*structpb.Value, len(values))}
+	for i, v := range values {
+		list.Values[i] = structpb.NewStringValue(v)
+	}
+	return list
+}
+
+func toStatus(err error) error {
+	var validationErrs validation.Errors
+	switch {
+	case errors.As(err, &validationErrs):
+		return status.Error(codes.InvalidArgument, validationErrs.Error())
+	case errors.Is(err, permission.ErrUserNotExist):
+		return status.Error(codes.NotFound, ErrUserNotFound.Error())
+	case errors.Is(err, permission.ErrRoleNotExists):
+		return status.Error(codes.NotFound, ErrRoleNotFound.Error())
+	case errors.Is(err, permission.ErrPermissionNotExists):
+		return status.Error(codes.NotFound, ErrPermissionNotFound.Error())
+	default:
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.Permissions",
+	HandlerType: (*PermissionsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckPermission",
+			Handler:    checkPermissionHandler,
+		},
+		{
+			MethodName: "ListPermissions",
+			Handler:    listPermissionsHandler,
+		},
+		{
+			MethodName: "ListRolePermissions",
+			Handler:    listRolePermissionsHandler,
+		},
+		{
+			MethodName: "GrantPermission",
+			Handler:    grantPermissionHandler,
+		},
+		{
+			MethodName: "RevokePermission",
+			Handler:    revokePermissionHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func checkPermissionHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PermissionsServer).CheckPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Permissions/CheckPermission",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PermissionsServer).CheckPermission(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listPermissionsHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PermissionsServer).ListPermissions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Permissions/ListPermissions",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PermissionsServer).ListPermissions(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listRolePermissionsHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PermissionsServer).ListRolePermissions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Permissions/ListRolePermissions",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PermissionsServer).ListRolePermissions(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func grantPermissionHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PermissionsServer).GrantPermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Permissions/GrantPermission",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PermissionsServer).GrantPermission(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func revokePermissionHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PermissionsServer).RevokePermission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Permissions/RevokePermission",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PermissionsServer).RevokePermission(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
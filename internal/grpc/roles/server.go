@@ -0,0 +1,228 @@
+// Package roles serves the granting of roles within a scope, like a single club.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types:
+//
+//	conn.Invoke(ctx, "/user.Roles/GrantScopedRole", req, &emptypb.Empty{})
+//	conn.Invoke(ctx, "/user.Roles/RevokeScopedRole", req, &emptypb.Empty{})
+//
+// with req = {"user_id": 1, "scope_type": "club", "scope_id": 42, "role": "MODER"}
+// grant and revoke a scoped role. A grant may carry "expires_at" as an RFC 3339
+// timestamp, after which it is reverted, and
+//
+//	conn.Invoke(ctx, "/user.Roles/ListScopedRoles", req, &structpb.ListValue{})
+//
+// with req = {"user_id": 1} returns the scoped roles of the user as structs of the
+// same shape.
+package roles
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/grpc/interceptors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/role"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"time"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrScopedRoleExists   = errors.New("user already has the role in this scope")
+	ErrScopedRoleNotFound = errors.New("user does not have the role in this scope")
+	ErrInternal           = errors.New("internal error")
+)
+
+type Roles interface {
+	GrantScopedRole(ctx context.Context, scopedRole *domain.ScopedRole, actor string) error
+	RevokeScopedRole(ctx context.Context, scopedRole *domain.ScopedRole, actor string) error
+	ListScopedRoles(ctx context.Context, userID int64) ([]*domain.ScopedRole, error)
+}
+
+type RolesServer interface {
+	GrantScopedRole(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	RevokeScopedRole(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	ListScopedRoles(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error)
+}
+
+type serverApi struct {
+	roles Roles
+}
+
+func Register(gRPC *grpc.Server, roles Roles) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{roles: roles})
+}
+
+func (s serverApi) GrantScopedRole(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	scopedRole := scopedRoleFromStruct(req)
+	if value, ok := req.GetFields()["expires_at"]; ok {
+		expiresAt, err := time.Parse(time.RFC3339, value.GetStringValue())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "expires_at: must be an RFC 3339 timestamp")
+		}
+		// timestamp columns do not keep the zone, so they are stored in UTC
+		expiresAt = expiresAt.UTC()
+		scopedRole.ExpiresAt = &expiresAt
+	}
+
+	err := s.roles.GrantScopedRole(ctx, scopedRole, actor(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) RevokeScopedRole(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	err := s.roles.RevokeScopedRole(ctx, scopedRoleFromStruct(req), actor(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s serverApi) ListScopedRoles(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error) {
+	userID := int64(req.GetFields()["user_id"].GetNumberValue())
+	err := validation.Validate(userID, validation.Required, validation.Min(int64(1)))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id: %s", err)
+	}
+
+	scopedRoles, err := s.roles.ListScopedRoles(ctx, userID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	list := &structpb.ListValue{Values: make([]*structpb.Value, len(scopedRoles))}
+	for i, scopedRole := range scopedRoles {
+		fields := map[string]*structpb.Value{
+			"user_id":    structpb.NewNumberValue(float64(scopedRole.UserID)),
+			"scope_type": structpb.NewStringValue(scopedRole.Scope.Type),
+			"scope_id":   structpb.NewNumberValue(float64(scopedRole.Scope.ID)),
+			"role":       structpb.NewStringValue(scopedRole.Role.String()),
+		}
+		if scopedRole.ExpiresAt != nil {
+			fields["expires_at"] = structpb.NewStringValue(scopedRole.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+		list.Values[i] = structpb.NewStructValue(&structpb.Struct{Fields: fields})
+	}
+
+	return list, nil
+}
+
+func scopedRoleFromStruct(req *structpb.Struct) *domain.ScopedRole {
+	fields := req.GetFields()
+	return &domain.ScopedRole{
+		UserID: int64(fields["user_id"].GetNumberValue()),
+		Scope: domain.RoleScope{
+			Type: fields["scope_type"].GetStringValue(),
+			ID:   int64(fields["scope_id"].GetNumberValue()),
+		},
+		Role: domain.Role(fields["role"].GetStringValue()),
+	}
+}
+
+// actor returns the caller recorded in the audit log.
+func actor(ctx context.Context) string {
+	principal, _ := interceptors.PrincipalFromContext(ctx)
+	return principal.Actor()
+}
+
+func toStatus(err error) error {
+	var validationErrs validation.Errors
+	switch {
+	case errors.As(err, &validationErrs):
+		return status.Error(codes.InvalidArgument, validationErrs.Error())
+	case errors.Is(err, role.ErrUserNotExist):
+		return status.Error(codes.NotFound, ErrUserNotFound.Error())
+	case errors.Is(err, role.ErrRoleNotExists):
+		return status.Error(codes.NotFound, ErrRoleNotFound.Error())
+	case errors.Is(err, role.ErrScopedRoleExists):
+		return status.Error(codes.AlreadyExists, ErrScopedRoleExists.Error())
+	case errors.Is(err, role.ErrScopedRoleNotExists):
+		return status.Error(codes.NotFound, ErrScopedRoleNotFound.Error())
+	default:
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.Roles",
+	HandlerType: (*RolesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GrantScopedRole",
+			Handler:    grantScopedRoleHandler,
+		},
+		{
+			MethodName: "RevokeScopedRole",
+			Handler:    revokeScopedRoleHandler,
+		},
+		{
+			MethodName: "ListScopedRoles",
+			Handler:    listScopedRolesHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func grantScopedRoleHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RolesServer).GrantScopedRole(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Roles/GrantScopedRole",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(RolesServer).GrantScopedRole(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func revokeScopedRoleHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RolesServer).RevokeScopedRole(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Roles/RevokeScopedRole",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(RolesServer).RevokeScopedRole(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listScopedRolesHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RolesServer).ListScopedRoles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Roles/ListScopedRoles",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(RolesServer).ListScopedRoles(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
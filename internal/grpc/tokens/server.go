@@ -0,0 +1,142 @@
+// Package tokens serves the refresh of access tokens and the public keys used to
+// verify them.
+//
+// The published protos do not define this service yet, so its descriptor is
+// written by hand using well-known types:
+//
+//	conn.Invoke(ctx, "/user.Tokens/GetJWKS", &emptypb.Empty{}, &wrapperspb.StringValue{})
+//
+// returns the JSON Web Key Set as the string value, and
+//
+//	conn.Invoke(ctx, "/user.Tokens/Refresh", wrapperspb.String(refreshToken), &emptypb.Empty{}, grpc.Header(&md))
+//
+// returns the new tokens in the same headers as Login.
+package tokens
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/token"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// accessTokenKey and refreshTokenKey are the header keys carrying the tokens, the
+// same as the ones Login uses.
+const (
+	accessTokenKey  = "x-access-token"
+	refreshTokenKey = "x-refresh-token"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token already used, the session has been revoked")
+	ErrInternal             = errors.New("internal error")
+)
+
+type Tokens interface {
+	JWKS() ([]byte, error)
+	Refresh(ctx context.Context, refreshToken string) (accessToken string, newRefreshToken string, err error)
+}
+
+type TokensServer interface {
+	GetJWKS(ctx context.Context, req *emptypb.Empty) (*wrapperspb.StringValue, error)
+	Refresh(ctx context.Context, req *wrapperspb.StringValue) (*emptypb.Empty, error)
+}
+
+type serverApi struct {
+	tokens Tokens
+}
+
+func Register(gRPC *grpc.Server, tokens Tokens) {
+	gRPC.RegisterService(&serviceDesc, &serverApi{tokens: tokens})
+}
+
+func (s serverApi) GetJWKS(_ context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
+	jwks, err := s.tokens.JWKS()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return wrapperspb.String(string(jwks)), nil
+}
+
+func (s serverApi) Refresh(ctx context.Context, req *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	err := validation.Validate(&req.Value, validation.Required)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	accessToken, refreshToken, err := s.tokens.Refresh(ctx, req.GetValue())
+	if err != nil {
+		switch {
+		case errors.Is(err, token.ErrRefreshTokenNotExists):
+			return nil, status.Error(codes.NotFound, ErrRefreshTokenNotFound.Error())
+		case errors.Is(err, token.ErrRefreshTokenReused):
+			return nil, status.Error(codes.Unauthenticated, ErrRefreshTokenReused.Error())
+		default:
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(accessTokenKey, accessToken, refreshTokenKey, refreshToken))
+
+	return &emptypb.Empty{}, nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "user.Tokens",
+	HandlerType: (*TokensServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetJWKS",
+			Handler:    getJWKSHandler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    refreshHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func getJWKSHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).GetJWKS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Tokens/GetJWKS",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(TokensServer).GetJWKS(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func refreshHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokensServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.Tokens/Refresh",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(TokensServer).Refresh(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
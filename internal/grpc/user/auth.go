@@ -7,25 +7,32 @@ import (
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain/dtos"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/password"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
+// mfaChallengeKey is the trailer key carrying the MFA challenge token returned by
+// Login for users with two-factor authentication enabled.
+const mfaChallengeKey = "x-mfa-challenge"
+
 type Auth interface {
 	Login(ctx context.Context,
 		email string,
 		password string,
 	) (user *domain.User, token string, err error)
 	Register(ctx context.Context, user *dtos.UserRegisterDTO) (userID int64, err error)
-	Logout(ctx context.Context, sessionToken string) error
 	Authenticate(ctx context.Context, sessionToken string) (userID int64, err error)
 	CheckUserRole(
 		ctx context.Context,
 		userId int64,
-		roles []userv1.Role,
+		roles []domain.Role,
+		scope *domain.RoleScope,
 	) (bool, error)
 	ActivateUser(ctx context.Context, token string) error
 }
@@ -34,7 +41,8 @@ func (s serverApi) Register(ctx context.Context, req *userv1.RegisterRequest) (*
 
 	err := validation.ValidateStruct(req,
 		validation.Field(&req.Email, validation.Required, is.Email),
-		validation.Field(&req.Password, validation.Required, validation.Length(6, 64)),
+		// the password policy is checked by the service
+		validation.Field(&req.Password, validation.Required),
 		validation.Field(&req.Barcode, validation.Required),
 		validation.Field(&req.FirstName, validation.Required),
 		validation.Field(&req.LastName, validation.Required),
@@ -46,12 +54,20 @@ func (s serverApi) Register(ctx context.Context, req *userv1.RegisterRequest) (*
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	userID, err := s.auth.Register(ctx, dtos.RegisterRequestToDTO(req))
+	dto := dtos.RegisterRequestToDTO(req)
+	dto.InviteCode = inviteCodeFromMetadata(ctx)
+
+	userID, err := s.auth.Register(ctx, dto)
 	if err != nil {
-		if errors.Is(err, auth.ErrUserExists) {
+		var validationErrs validation.Errors
+		switch {
+		case errors.Is(err, auth.ErrUserExists):
 			return nil, status.Error(codes.AlreadyExists, ErrUserAlreadyExists.Error())
+		case errors.As(err, &validationErrs):
+			return nil, invalidArgument(validationErrs)
+		default:
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
 		}
-		return nil, status.Error(codes.Internal, ErrInternal.Error())
 	}
 
 	return &userv1.RegisterResponse{UserId: userID}, nil
@@ -60,7 +76,9 @@ func (s serverApi) Register(ctx context.Context, req *userv1.RegisterRequest) (*
 func (s serverApi) Login(ctx context.Context, req *userv1.LoginRequest) (*userv1.LoginResponse, error) {
 	err := validation.ValidateStruct(req,
 		validation.Field(&req.Email, validation.Required, is.Email),
-		validation.Field(&req.Password, validation.Required, validation.Length(6, 64)),
+		// existing passwords may predate the password policy, so only the longest
+		// length it allows is checked
+		validation.Field(&req.Password, validation.Required, validation.Length(0, password.MaxLength)),
 	)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
@@ -69,6 +87,12 @@ func (s serverApi) Login(ctx context.Context, req *userv1.LoginRequest) (*userv1
 	user, token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword())
 	if err != nil {
 		switch {
+		case errors.Is(err, auth.ErrMFARequired):
+			// LoginResponse has no room for the challenge, so it is sent as a trailer
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(mfaChallengeKey, token))
+			return nil, status.Error(codes.Unauthenticated, ErrMFARequired.Error())
+		case errors.Is(err, auth.ErrTooManyAttempts):
+			return nil, status.Error(codes.ResourceExhausted, ErrTooManyAttempts.Error())
 		case errors.Is(err, auth.ErrUserNotExist):
 			return nil, status.Error(codes.NotFound, "invalid email or password")
 		case errors.Is(err, auth.ErrInvalidCredentials):
@@ -79,6 +103,11 @@ func (s serverApi) Login(ctx context.Context, req *userv1.LoginRequest) (*userv1
 
 	}
 
+	err = s.setTokenHeaders(ctx, user, token)
+	if err != nil {
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+
 	return &userv1.LoginResponse{SessionToken: token, User: user.ToUserObject()}, nil
 }
 
@@ -88,7 +117,8 @@ func (s serverApi) Logout(ctx context.Context, req *userv1.LogoutRequest) (*empt
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	err = s.auth.Logout(ctx, req.GetSessionToken())
+	// impersonation sessions are ended, not only deleted
+	err = s.impersonations.Logout(ctx, req.GetSessionToken())
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -110,6 +140,14 @@ func (s serverApi) Authenticate(ctx context.Context, req *userv1.AuthenticateReq
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	impersonation, err := s.impersonations.Impersonation(ctx, req.GetSessionToken())
+	if err != nil {
+		return nil, status.Error(codes.Internal, ErrInternal.Error())
+	}
+	if impersonation != nil {
+		setImpersonatorHeader(ctx, impersonation.ImpersonatorID)
+	}
+
 	return &userv1.AuthenticateResponse{UserId: userID}, nil
 }
 
@@ -122,7 +160,20 @@ func (s serverApi) CheckUserRole(ctx context.Context, req *userv1.CheckUserRoleR
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	hasRole, err := s.auth.CheckUserRole(ctx, req.GetUserId(), req.GetRoles())
+	scope, err := roleScopeFromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]domain.Role, len(req.GetRoles()))
+	for i, r := range req.GetRoles() {
+		roles[i], err = domain.RoleFromProto(r)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "roles: %s", err)
+		}
+	}
+
+	hasRole, err := s.auth.CheckUserRole(ctx, req.GetUserId(), roles, scope)
 	if err != nil {
 		if errors.Is(err, auth.ErrUserNotExist) {
 			return nil, status.Error(codes.NotFound, ErrUserNotFound.Error())
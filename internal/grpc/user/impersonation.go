@@ -0,0 +1,23 @@
+package user
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strconv"
+)
+
+// impersonatorIDKey is the header key carrying the impersonator of the session
+// returned by Authenticate. AuthenticateResponse has only the user ID, so downstream
+// services read the impersonator from this header to block dangerous actions.
+const impersonatorIDKey = "x-impersonator-id"
+
+type Impersonations interface {
+	Impersonation(ctx context.Context, sessionToken string) (*domain.Impersonation, error)
+	Logout(ctx context.Context, sessionToken string) error
+}
+
+func setImpersonatorHeader(ctx context.Context, impersonatorID int64) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(impersonatorIDKey, strconv.FormatInt(impersonatorID, 10)))
+}
@@ -0,0 +1,20 @@
+package user
+
+import (
+	"context"
+	"google.golang.org/grpc/metadata"
+)
+
+// inviteCodeKey is the metadata key carrying the invitation code of Register, which
+// is required while registration is invite only.
+const inviteCodeKey = "x-invite-code"
+
+// inviteCodeFromMetadata returns the invitation code sent by the client, or "".
+func inviteCodeFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(inviteCodeKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -19,7 +19,7 @@ type Management interface {
 		query string,
 		filters domain.Filters,
 	) (users []*domain.User, metadata domain.Metadata, err error)
-	UpdateUser(ctx context.Context, user *domain.User) error
+	UpdateUser(ctx context.Context, user *domain.User, fields []string) (*domain.User, error)
 	DeleteUser(ctx context.Context, userID int64) error
 	UpdateAvatar(ctx context.Context, userID int64, image []byte) (*domain.User, error)
 }
@@ -27,44 +27,69 @@ type Management interface {
 func (s serverApi) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.UserObject, error) {
 	err := validation.ValidateStruct(req,
 		validation.Field(&req.UserId, validation.Required),
-		validation.Field(&req.Year, validation.Min(1)),
+		validation.Field(&req.UpdateMask, validation.Required),
 	)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	user, err := s.management.GetUser(ctx, req.GetUserId())
+	version, _, err := userVersionFromMetadata(ctx)
 	if err != nil {
-		if errors.Is(err, management.ErrUserNotExist) {
-			return nil, status.Error(codes.NotFound, ErrUserNotFound.Error())
-		}
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
 	}
 
+	user := &domain.User{ID: req.GetUserId(), Version: version}
+
 	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask: cannot be blank")
+	}
+
+	seen := make(map[string]bool, len(paths))
 	for _, path := range paths {
+		if seen[path] {
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask: duplicate path %q", path)
+		}
+		seen[path] = true
+
 		switch path {
-		case "first_name":
+		case domain.FieldFirstName:
+			err = validation.Validate(req.GetFirstName(), validation.Required)
 			user.FirstName = req.GetFirstName()
-		case "last_name":
+		case domain.FieldLastName:
+			err = validation.Validate(req.GetLastName(), validation.Required)
 			user.LastName = req.GetLastName()
-		case "major":
+		case domain.FieldMajor:
+			err = validation.Validate(req.GetMajor(), validation.Required)
 			user.Major = req.GetMajor()
-		case "group_name":
+		case domain.FieldGroupName:
+			err = validation.Validate(req.GetGroupName(), validation.Required)
 			user.GroupName = req.GetGroupName()
-		case "year":
+		case domain.FieldYear:
+			err = validation.Validate(req.GetYear(), validation.Required, validation.Min(int32(1)))
 			user.Year = req.GetYear()
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask: unsupported path %q", path)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: %s", path, err.Error())
 		}
 	}
 
-	err = s.management.UpdateUser(ctx, user)
+	user, err = s.management.UpdateUser(ctx, user, paths)
 	if err != nil {
-		if errors.Is(err, management.ErrUserNotExist) {
+		switch {
+		case errors.Is(err, management.ErrUserNotExist):
 			return nil, status.Error(codes.NotFound, ErrUserNotFound.Error())
+		case errors.Is(err, management.ErrEditConflict):
+			return nil, status.Error(codes.Aborted, ErrEditConflict.Error())
+		default:
+			return nil, status.Error(codes.Internal, err.Error())
 		}
-		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	setUserVersionHeader(ctx, user.Version)
+
 	return user.ToUserObject(), nil
 
 }
@@ -103,6 +128,8 @@ func (s serverApi) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*us
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	setUserVersionHeader(ctx, user.Version)
+
 	return user.ToUserObject(), nil
 }
 
@@ -148,9 +175,18 @@ func (s serverApi) UpdateAvatar(ctx context.Context, req *userv1.UpdateAvatarReq
 
 	user, err := s.management.UpdateAvatar(ctx, req.GetUserId(), req.GetImage())
 	if err != nil {
-		return nil, status.Error(codes.Internal, ErrInternal.Error())
+		switch {
+		case errors.Is(err, management.ErrUserNotExist):
+			return nil, status.Error(codes.NotFound, ErrUserNotFound.Error())
+		case errors.Is(err, management.ErrEditConflict):
+			return nil, status.Error(codes.Aborted, ErrEditConflict.Error())
+		default:
+			return nil, status.Error(codes.Internal, ErrInternal.Error())
+		}
 	}
 
+	setUserVersionHeader(ctx, user.Version)
+
 	return user.ToUserObject(), nil
 }
 
@@ -0,0 +1,31 @@
+package user
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// roleScopeKey is the metadata key carrying the scope of CheckUserRole, like
+// "club:42". CheckUserRoleRequest has no scope field, so it is read from the
+// request metadata.
+const roleScopeKey = "x-role-scope"
+
+// roleScopeFromMetadata returns the scope sent by the client, or nil if there is
+// none.
+func roleScopeFromMetadata(ctx context.Context) (*domain.RoleScope, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(roleScopeKey)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	scope, err := domain.ParseRoleScope(values[0])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s: %s", roleScopeKey, err)
+	}
+
+	return &scope, nil
+}
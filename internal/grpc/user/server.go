@@ -12,14 +12,24 @@ var (
 	ErrActivationTokenNotFound = errors.New("activation token not found")
 	ErrSessionNotFound         = errors.New("session not found")
 	ErrInternal                = errors.New("internal error")
+	ErrEditConflict            = errors.New("user was modified by someone else, reload and try again")
+	ErrMFARequired             = errors.New("second factor required")
+	ErrTooManyAttempts         = errors.New("too many failed login attempts, try again later")
 )
 
 type serverApi struct {
 	userv1.UnimplementedUserServer
-	auth       Auth
-	management Management
+	auth           Auth
+	management     Management
+	tokens         Tokens
+	impersonations Impersonations
 }
 
-func Register(gRPC *grpc.Server, auth Auth, management Management) {
-	userv1.RegisterUserServer(gRPC, &serverApi{auth: auth, management: management})
+func Register(gRPC *grpc.Server, auth Auth, management Management, tokens Tokens, impersonations Impersonations) {
+	userv1.RegisterUserServer(gRPC, &serverApi{
+		auth:           auth,
+		management:     management,
+		tokens:         tokens,
+		impersonations: impersonations,
+	})
 }
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+)
+
+// invalidArgument returns an InvalidArgument status with a BadRequest detail
+// holding a violation per field, so that clients can show each error next to its
+// field. Nested validation.Errors become violations of dotted fields such as
+// "password.breached".
+func invalidArgument(errs validation.Errors) error {
+	st := status.New(codes.InvalidArgument, errs.Error())
+
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: fieldViolations("", errs)})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+func fieldViolations(prefix string, errs validation.Errors) []*errdetails.BadRequest_FieldViolation {
+	fields := make([]string, 0, len(errs))
+	for field := range errs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, field := range fields {
+		var nested validation.Errors
+		if errors.As(errs[field], &nested) {
+			violations = append(violations, fieldViolations(prefix+field+".", nested)...)
+			continue
+		}
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       prefix + field,
+			Description: errs[field].Error(),
+		})
+	}
+
+	return violations
+}
@@ -0,0 +1,36 @@
+package user
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// accessTokenKey and refreshTokenKey are the header keys carrying the signed
+// access token and the refresh token issued on login, as LoginResponse has no
+// fields for them.
+const (
+	accessTokenKey  = "x-access-token"
+	refreshTokenKey = "x-refresh-token"
+)
+
+// Tokens mints signed access tokens. It is nil when access tokens are disabled.
+type Tokens interface {
+	Issue(ctx context.Context, user *domain.User, sessionToken string) (accessToken string, refreshToken string, err error)
+}
+
+func (s serverApi) setTokenHeaders(ctx context.Context, user *domain.User, sessionToken string) error {
+	if s.tokens == nil {
+		return nil
+	}
+
+	accessToken, refreshToken, err := s.tokens.Issue(ctx, user, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(accessTokenKey, accessToken, refreshTokenKey, refreshToken))
+
+	return nil
+}
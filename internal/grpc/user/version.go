@@ -0,0 +1,35 @@
+package user
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+)
+
+// userVersionKey is the metadata key carrying the user version. UserObject has no
+// version field, so the current version is sent back as a response header and the
+// version a client based its edit on is read from the request metadata.
+const userVersionKey = "x-user-version"
+
+func setUserVersionHeader(ctx context.Context, version int32) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(userVersionKey, strconv.Itoa(int(version))))
+}
+
+// userVersionFromMetadata returns the version sent by the client, if any.
+func userVersionFromMetadata(ctx context.Context) (version int32, ok bool, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(userVersionKey)
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+
+	v, err := strconv.ParseInt(values[0], 10, 32)
+	if err != nil || v < 1 {
+		return 0, false, status.Errorf(codes.InvalidArgument, "%s: must be a positive integer", userVersionKey)
+	}
+
+	return int32(v), true, nil
+}
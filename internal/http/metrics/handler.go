@@ -0,0 +1,42 @@
+// Package metrics serves the metrics of the service in the Prometheus text format:
+//
+//	GET /metrics
+package metrics
+
+import (
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage/redis"
+	"net/http"
+)
+
+type UserCache interface {
+	Stats() redis.CacheStats
+}
+
+type handler struct {
+	userCache UserCache
+}
+
+func Register(mux *http.ServeMux, userCache UserCache) {
+	h := &handler{userCache: userCache}
+
+	mux.HandleFunc("/metrics", h.metrics)
+}
+
+func (h *handler) metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := h.userCache.Stats()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeCounter(w, "user_cache_hits_total", "Users returned from the redis cache.", stats.Hits)
+	writeCounter(w, "user_cache_misses_total", "Users read from postgres because they were not cached.", stats.Misses)
+}
+
+func writeCounter(w http.ResponseWriter, name string, help string, value uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
@@ -0,0 +1,285 @@
+// Package oidc serves the OpenID Connect provider over HTTP:
+//
+//	GET  /.well-known/openid-configuration
+//	GET  /jwks
+//	GET  /authorize    renders the login form
+//	POST /authorize    checks the credentials and redirects back with a code
+//	POST /token
+//	GET  /userinfo
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/oidc"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Provider interface {
+	ValidateAuthorizeRequest(ctx context.Context, req oidc.AuthorizeRequest) (*domain.OAuthClient, error)
+	Authorize(ctx context.Context, req oidc.AuthorizeRequest, email string, password string, otp string) (redirectURI string, err error)
+	Exchange(ctx context.Context, req oidc.TokenRequest) (*oidc.TokenResponse, error)
+	UserInfo(ctx context.Context, accessToken string) (map[string]any, error)
+	Discovery() map[string]any
+	JWKS() ([]byte, error)
+}
+
+type handler struct {
+	log      *slog.Logger
+	provider Provider
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, provider Provider) {
+	h := &handler{log: log, provider: provider}
+
+	mux.HandleFunc("/.well-known/openid-configuration", h.discovery)
+	mux.HandleFunc("/jwks", h.jwks)
+	mux.HandleFunc("/authorize", h.authorize)
+	mux.HandleFunc("/token", h.token)
+	mux.HandleFunc("/userinfo", h.userInfo)
+}
+
+func (h *handler) discovery(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.provider.Discovery())
+}
+
+func (h *handler) jwks(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	jwks, err := h.provider.JWKS()
+	if err != nil {
+		h.log.Error("failed to get jwks", logger.Err(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(jwks)
+}
+
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.authorize"
+	log := h.log.With(slog.String("op", op))
+
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := oidc.AuthorizeRequest{
+		ClientID:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		ResponseType:        r.Form.Get("response_type"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+
+	client, err := h.provider.ValidateAuthorizeRequest(r.Context(), req)
+	if err != nil {
+		h.authorizeError(w, r, log, req, err)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		renderLogin(w, http.StatusOK, loginPage{ClientName: client.Name, Request: req})
+		return
+	}
+
+	redirectURI, err := h.provider.Authorize(r.Context(), req, r.PostForm.Get("email"), r.PostForm.Get("password"), r.PostForm.Get("otp"))
+	if err != nil {
+		page := loginPage{ClientName: client.Name, Request: req, Email: r.PostForm.Get("email")}
+		switch {
+		case errors.Is(err, auth.ErrMFARequired):
+			page.OTP = true
+			page.Error = "Enter the code from your authenticator app."
+			renderLogin(w, http.StatusUnauthorized, page)
+		case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrMFAChallengeNotExists):
+			page.OTP = r.PostForm.Get("otp") != ""
+			page.Error = "Invalid email or password."
+			renderLogin(w, http.StatusUnauthorized, page)
+		case errors.Is(err, auth.ErrTooManyAttempts):
+			page.Error = "Too many failed attempts, try again later."
+			renderLogin(w, http.StatusTooManyRequests, page)
+		default:
+			h.authorizeError(w, r, log, req, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
+
+// authorizeError reports an authorization error to the client through its redirect
+// URI, unless the client or the redirect URI are invalid.
+func (h *handler) authorizeError(w http.ResponseWriter, r *http.Request, log *slog.Logger, req oidc.AuthorizeRequest, err error) {
+	switch {
+	case errors.Is(err, oidc.ErrClientNotExists), errors.Is(err, oidc.ErrInvalidRedirectURI):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code, ok := errorCode(err)
+	if !ok {
+		log.Error("failed to authorize", logger.Err(err))
+	}
+
+	http.Redirect(w, r, oidc.RedirectURI(req.RedirectURI, url.Values{
+		"error":             {code},
+		"error_description": {errorDescription(code, err)},
+		"state":             {req.State},
+	}), http.StatusFound)
+}
+
+func (h *handler) token(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.token"
+	log := h.log.With(slog.String("op", op))
+
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, oidc.ErrInvalidRequest.Error(), err.Error())
+		return
+	}
+
+	req := oidc.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+	}
+	if clientID, secret, ok := r.BasicAuth(); ok {
+		req.ClientID, _ = url.QueryUnescape(clientID)
+		req.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	res, err := h.provider.Exchange(r.Context(), req)
+	if err != nil {
+		code, ok := errorCode(err)
+		switch {
+		case !ok:
+			log.Error("failed to exchange token", logger.Err(err))
+			writeError(w, http.StatusInternalServerError, code, "")
+		case code == oidc.ErrInvalidClient.Error():
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+			writeError(w, http.StatusUnauthorized, code, "")
+		default:
+			writeError(w, http.StatusBadRequest, code, errorDescription(code, err))
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *handler) userInfo(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.userInfo"
+	log := h.log.With(slog.String("op", op))
+
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		writeError(w, http.StatusUnauthorized, oidc.ErrInvalidToken.Error(), "")
+		return
+	}
+
+	claims, err := h.provider.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, oidc.ErrInvalidToken.Error(), "")
+			return
+		}
+		log.Error("failed to get user info", logger.Err(err))
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+var oauthErrors = []error{
+	oidc.ErrInvalidRequest,
+	oidc.ErrUnsupportedResponseType,
+	oidc.ErrInvalidScope,
+	oidc.ErrInvalidClient,
+	oidc.ErrInvalidGrant,
+	oidc.ErrUnsupportedGrantType,
+	oidc.ErrInvalidToken,
+}
+
+// errorCode returns the OAuth 2.0 error code of err, or server_error and false if
+// err is not an expected error.
+func errorCode(err error) (string, bool) {
+	for _, oauthErr := range oauthErrors {
+		if errors.Is(err, oauthErr) {
+			return oauthErr.Error(), true
+		}
+	}
+
+	return "server_error", false
+}
+
+// errorDescription returns the part of the error message after the error code, so
+// that no internal details are leaked.
+func errorDescription(code string, err error) string {
+	_, description, _ := strings.Cut(err.Error(), code+": ")
+	return description
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	writeJSON(w, status, struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
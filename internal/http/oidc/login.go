@@ -0,0 +1,54 @@
+package oidc
+
+import (
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/oidc"
+	"html/template"
+	"net/http"
+)
+
+type loginPage struct {
+	ClientName string
+	Request    oidc.AuthorizeRequest
+	Email      string
+	OTP        bool
+	Error      string
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Log in to {{.ClientName}}</title>
+</head>
+<body>
+	<h1>Log in to {{.ClientName}}</h1>
+	{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+	<form method="post" action="/authorize">
+		<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+		<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+		<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+		<input type="hidden" name="scope" value="{{.Request.Scope}}">
+		<input type="hidden" name="state" value="{{.Request.State}}">
+		<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+		<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+		<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+		<label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label>
+		<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+		{{if .OTP}}<label>Code <input type="text" name="otp" inputmode="numeric" autocomplete="one-time-code" required></label>{{end}}
+		<button type="submit">Log in</button>
+	</form>
+</body>
+</html>
+`))
+
+// renderLogin writes the login form. It must not be framed, so that the credentials
+// form cannot be used for clickjacking.
+func renderLogin(w http.ResponseWriter, status int, page loginPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	_ = loginTemplate.Execute(w, page)
+}
@@ -0,0 +1,133 @@
+// Package sso serves login through an external OpenID Connect identity provider:
+//
+//	GET /sso/login     redirects to the identity provider
+//	GET /sso/callback  completes the login and redirects to the frontend
+//
+// The frontend receives the result in the fragment of its URL, so that it is not
+// sent to any server: session_token, mfa_challenge to pass to VerifyMFA, or error.
+package sso
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// stateCookie binds the login to the browser that started it, so that a callback
+// URL cannot be used to log someone else into the attacker's account.
+const stateCookie = "sso_state"
+
+type SSO interface {
+	BeginSSO(ctx context.Context) (authURL string, state string, err error)
+	FinishSSO(ctx context.Context, state string, code string) (*domain.User, string, error)
+}
+
+type handler struct {
+	log         *slog.Logger
+	sso         SSO
+	frontendURL string
+	stateTTL    time.Duration
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, sso SSO, frontendURL string, stateTTL time.Duration) {
+	h := &handler{log: log, sso: sso, frontendURL: frontendURL, stateTTL: stateTTL}
+
+	mux.HandleFunc("/sso/login", h.login)
+	mux.HandleFunc("/sso/callback", h.callback)
+}
+
+func (h *handler) login(w http.ResponseWriter, r *http.Request) {
+	const op = "http.sso.login"
+	log := h.log.With(slog.String("op", op))
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	authURL, state, err := h.sso.BeginSSO(r.Context())
+	if err != nil {
+		log.Error("failed to begin sso", logger.Err(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/sso/callback",
+		MaxAge:   int(h.stateTTL.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h *handler) callback(w http.ResponseWriter, r *http.Request) {
+	const op = "http.sso.callback"
+	log := h.log.With(slog.String("op", op))
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/sso/callback", MaxAge: -1})
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		log.Info("identity provider returned an error", slog.String("error", errCode))
+		h.redirect(w, r, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		h.redirect(w, r, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	_, token, err := h.sso.FinishSSO(r.Context(), state, query.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMFARequired):
+			h.redirect(w, r, url.Values{"mfa_challenge": {token}})
+		case errors.Is(err, auth.ErrSSOStateNotExists):
+			h.redirect(w, r, url.Values{"error": {"invalid_state"}})
+		case errors.Is(err, auth.ErrSSOFailed):
+			h.redirect(w, r, url.Values{"error": {"access_denied"}})
+		case errors.Is(err, auth.ErrSSOMissingClaims):
+			h.redirect(w, r, url.Values{"error": {"missing_claims"}})
+		case errors.Is(err, auth.ErrSSOEmailNotVerified):
+			h.redirect(w, r, url.Values{"error": {"email_not_verified"}})
+		case errors.Is(err, auth.ErrSSORegistrationDenied):
+			h.redirect(w, r, url.Values{"error": {"registration_denied"}})
+		case errors.Is(err, auth.ErrUserExists):
+			h.redirect(w, r, url.Values{"error": {"account_exists"}})
+		case errors.Is(err, auth.ErrTooManyAttempts):
+			h.redirect(w, r, url.Values{"error": {"temporarily_unavailable"}})
+		default:
+			log.Error("failed to finish sso", logger.Err(err))
+			h.redirect(w, r, url.Values{"error": {"server_error"}})
+		}
+		return
+	}
+
+	h.redirect(w, r, url.Values{"session_token": {token}})
+}
+
+func (h *handler) redirect(w http.ResponseWriter, r *http.Request, fragment url.Values) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, h.frontendURL+"#"+fragment.Encode(), http.StatusFound)
+}
@@ -4,15 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	userv1 "github.com/ARUMANDESU/uniclubs-protos/gen/go/user"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain/dtos"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
 	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
 	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/activate"
 	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/session"
-	"golang.org/x/crypto/bcrypt"
+	validation "github.com/go-ozzo/ozzo-validation"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,7 +24,22 @@ type Auth struct {
 	usrStorage             UserStorage
 	sessionStorage         TokenStorage
 	activationTokenStorage TokenStorage
+	emailChangeStorage     EmailChangeStorage
+	phoneOTPStorage        PhoneOTPStorage
+	authenticators         []Authenticator
+	mfa                    MFA
+	mfaChallengeStorage    ChallengeStorage
+	magicLinkStorage       MagicLinkStorage
+	loginAttempts          AttemptLimiter
+	magicLinkRequests      AttemptLimiter
+	registration           RegistrationPolicy
+	passwords              PasswordPolicy
+	hasher                 PasswordHasher
+	invitations            Invitations
 	amqp                   Amqp
+	phoneCfg               config.Phone
+	mfaCfg                 config.MFA
+	loginCfg               config.Login
 }
 
 type Amqp interface {
@@ -32,8 +50,16 @@ type UserStorage interface {
 	SaveUser(ctx context.Context, user *domain.User) error
 	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
 	GetUserByEmail(ctx context.Context, email string) (user *domain.User, err error)
-	GetUserRoleByID(ctx context.Context, userID int64) (role string, err error)
+	GetUserRoleByID(ctx context.Context, userID int64) (role domain.Role, err error)
 	ActivateUser(ctx context.Context, userID int64) error
+	EmailExists(ctx context.Context, email string) (bool, error)
+	GetUserByIDForUpdate(ctx context.Context, userID int64) (user *domain.User, err error)
+	UpdateUser(ctx context.Context, user *domain.User, fields []string) error
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+	SetPhoneVerified(ctx context.Context, userID int64, phoneNumber string) error
+	GetScopedRoles(ctx context.Context, userID int64, scope domain.RoleScope) ([]domain.Role, error)
+	SetUserRole(ctx context.Context, userID int64, role domain.Role) error
+	RehashPassword(ctx context.Context, userID int64, oldHash []byte, newHash []byte) error
 }
 
 type TokenStorage interface {
@@ -42,12 +68,53 @@ type TokenStorage interface {
 	Delete(ctx context.Context, sessionToken string) error
 }
 
+// ChallengeStorage is a TokenStorage that limits how often a token may be tried.
+type ChallengeStorage interface {
+	TokenStorage
+	IncrAttempts(ctx context.Context, token string, duration time.Duration) (int, error)
+}
+
+// AttemptLimiter counts failed attempts per key, e.g. to lock out an email after
+// too many failed logins.
+type AttemptLimiter interface {
+	Attempts(ctx context.Context, key string) (int, error)
+	IncrAttempts(ctx context.Context, key string, duration time.Duration) (int, error)
+	ResetAttempts(ctx context.Context, key string) error
+}
+
+// RegistrationPolicy decides which emails and barcodes users can register with.
+type RegistrationPolicy interface {
+	Check(email string, barcode string) error
+	InviteOnly() bool
+}
+
+// PasswordPolicy decides which passwords users can set.
+type PasswordPolicy interface {
+	Check(password string, personal ...string) error
+}
+
+// Invitations redeems the invitation codes users register with.
+type Invitations interface {
+	Redeem(ctx context.Context, code string, email string) (*domain.Invitation, error)
+}
+
+type MFA interface {
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+	Verify(ctx context.Context, userID int64, code string) error
+}
+
 var (
 	ErrInvalidCredentials       = errors.New("invalid credentials")
 	ErrUserExists               = errors.New("user already exists")
 	ErrUserNotExist             = errors.New("user does not exist")
 	ErrSessionNotExists         = errors.New("session does not exists")
 	ErrActivationTokenNotExists = errors.New("activation token does not exists")
+	ErrMFARequired              = errors.New("second factor required")
+	ErrMFAChallengeNotExists    = errors.New("mfa challenge does not exists")
+	ErrEmailChangeNotExists     = errors.New("email change token does not exists")
+	ErrEmailUnchanged           = errors.New("new email is the same as the current one")
+	ErrTooManyAttempts          = errors.New("too many failed login attempts")
+	ErrInvitationRequired       = errors.New("an invitation code is required to register")
 )
 
 func New(
@@ -55,46 +122,248 @@ func New(
 	usrStorage UserStorage,
 	sessionStorage TokenStorage,
 	activateTokenStorage TokenStorage,
+	emailChangeStorage EmailChangeStorage,
+	phoneOTPStorage PhoneOTPStorage,
+	authenticators []Authenticator,
+	mfa MFA,
+	mfaChallengeStorage ChallengeStorage,
+	magicLinkStorage MagicLinkStorage,
+	loginAttempts AttemptLimiter,
+	magicLinkRequests AttemptLimiter,
+	registration RegistrationPolicy,
+	passwords PasswordPolicy,
+	hasher PasswordHasher,
+	invitations Invitations,
 	amqp Amqp,
+	phoneCfg config.Phone,
+	mfaCfg config.MFA,
+	loginCfg config.Login,
 ) *Auth {
 	return &Auth{
 		log:                    log,
 		usrStorage:             usrStorage,
 		sessionStorage:         sessionStorage,
 		activationTokenStorage: activateTokenStorage,
+		emailChangeStorage:     emailChangeStorage,
+		phoneOTPStorage:        phoneOTPStorage,
+		authenticators:         authenticators,
+		mfa:                    mfa,
+		mfaChallengeStorage:    mfaChallengeStorage,
+		magicLinkStorage:       magicLinkStorage,
+		loginAttempts:          loginAttempts,
+		magicLinkRequests:      magicLinkRequests,
+		registration:           registration,
+		passwords:              passwords,
+		hasher:                 hasher,
+		invitations:            invitations,
 		amqp:                   amqp,
+		phoneCfg:               phoneCfg,
+		mfaCfg:                 mfaCfg,
+		loginCfg:               loginCfg,
 	}
 }
 
+// Login checks the credentials of the user and returns a new session token. If the
+// user has two-factor authentication enabled, the returned token is an MFA challenge
+// instead and the error wraps ErrMFARequired; the session is then issued by VerifyMFA.
+// After too many failed attempts the email is locked out and ErrTooManyAttempts is
+// returned until the lockout expires.
 func (a Auth) Login(ctx context.Context, email string, password string) (*domain.User, string, error) {
 	const op = "authService.Login"
 	log := a.log.With(slog.String("op", op))
 
-	user, err := a.usrStorage.GetUserByEmail(ctx, email)
+	err := a.checkLockout(ctx, email)
 	if err != nil {
+		log.Info("login is locked out", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
 
+	user, err := a.verifyPassword(ctx, email, password)
+	if err != nil {
 		switch {
-		case errors.Is(err, storage.ErrUserNotExists):
-			log.Error("user does not exists", logger.Err(err))
+		case errors.Is(err, ErrUserNotExist):
+			log.Info("user does not exists", logger.Err(err))
+			a.recordFailedLogin(ctx, log, email)
 			return nil, "", fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		case errors.Is(err, ErrInvalidCredentials):
+			log.Info("invalid credentials", logger.Err(err))
+			a.recordFailedLogin(ctx, log, email)
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		default:
-			log.Error("failed to get user", logger.Err(err))
+			log.Error("failed to verify password", logger.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	a.resetLockout(ctx, log, email)
+
+	token, err := a.startSession(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMFARequired):
+			return user, token, fmt.Errorf("%s: %w", op, err)
+		case errors.Is(err, ErrTooManyAttempts):
+			log.Info("mfa is locked out", slog.Int64("user_id", user.ID))
 			return nil, "", fmt.Errorf("%s: %w", op, err)
 		}
+		log.Error("can not start session", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, token, nil
+}
 
+// startSession issues a session for a user who has proven the first factor. For
+// users with two-factor authentication it returns an MFA challenge and
+// ErrMFARequired instead, or ErrTooManyAttempts while the user is locked out of
+// MFA.
+func (a Auth) startSession(ctx context.Context, user *domain.User) (string, error) {
+	mfaEnabled, err := a.mfa.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check mfa: %w", err)
 	}
+	if mfaEnabled {
+		err = a.checkMFALockout(ctx, user.ID)
+		if err != nil {
+			return "", err
+		}
 
-	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
-		log.Info("invalid credentials", logger.Err(err))
-		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		challenge, err := session.GenerateToken()
+		if err != nil {
+			return "", err
+		}
+
+		err = a.mfaChallengeStorage.Create(ctx, challenge, user.ID, a.mfaCfg.ChallengeTTL)
+		if err != nil {
+			return "", fmt.Errorf("can not save mfa challenge: %w", err)
+		}
+
+		return challenge, ErrMFARequired
 	}
 
-	token, err := session.GenerateToken()
+	return a.createSession(ctx, user.ID)
+}
+
+// checkLockout returns ErrTooManyAttempts if the email has reached the limit of
+// failed login attempts.
+func (a Auth) checkLockout(ctx context.Context, email string) error {
+	attempts, err := a.loginAttempts.Attempts(ctx, lockoutKey(email))
 	if err != nil {
+		return err
+	}
+	if attempts >= a.loginCfg.MaxAttempts {
+		return ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+func (a Auth) recordFailedLogin(ctx context.Context, log *slog.Logger, email string) {
+	_, err := a.loginAttempts.IncrAttempts(ctx, lockoutKey(email), a.loginCfg.LockoutDuration)
+	if err != nil {
+		log.Error("failed to record login attempt", logger.Err(err))
+	}
+}
+
+func (a Auth) resetLockout(ctx context.Context, log *slog.Logger, email string) {
+	err := a.loginAttempts.ResetAttempts(ctx, lockoutKey(email))
+	if err != nil {
+		log.Error("failed to reset login attempts", logger.Err(err))
+	}
+}
+
+func lockoutKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// checkMFALockout returns ErrTooManyAttempts if the user has reached the limit of
+// invalid second factors. The failures are counted per user across challenges, so
+// that logging in again with the password does not allow more guesses.
+func (a Auth) checkMFALockout(ctx context.Context, userID int64) error {
+	attempts, err := a.loginAttempts.Attempts(ctx, mfaLockoutKey(userID))
+	if err != nil {
+		return err
+	}
+	if attempts >= a.loginCfg.MaxAttempts {
+		return ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+func mfaLockoutKey(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
+
+// VerifyMFA completes a login started by Login for a user with two-factor
+// authentication. code is a TOTP or recovery code; after too many invalid codes
+// the challenge is discarded and the login has to be started again. Invalid codes
+// also count towards a lockout of the user, which is only reset once a code is
+// accepted, and ErrTooManyAttempts is returned until it expires.
+func (a Auth) VerifyMFA(ctx context.Context, challenge string, code string) (*domain.User, string, error) {
+	const op = "authService.VerifyMFA"
+	log := a.log.With(slog.String("op", op))
+
+	userID, err := a.mfaChallengeStorage.Get(ctx, challenge)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrSessionNotExists):
+			return nil, "", fmt.Errorf("%s: %w", op, ErrMFAChallengeNotExists)
+		default:
+			log.Error("failed to get mfa challenge", logger.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = a.checkMFALockout(ctx, userID)
+	if err != nil {
+		log.Info("mfa is locked out", slog.Int64("user_id", userID), logger.Err(err))
+		a.deleteMFAChallenge(ctx, log, challenge)
 		return nil, "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = a.sessionStorage.Create(ctx, token, user.ID, time.Hour*24)
+	err = a.mfa.Verify(ctx, userID, code)
+	if err != nil {
+		log.Info("invalid second factor", logger.Err(err))
+
+		_, incrErr := a.loginAttempts.IncrAttempts(ctx, mfaLockoutKey(userID), a.loginCfg.LockoutDuration)
+		if incrErr != nil {
+			log.Error("failed to record mfa attempt", logger.Err(incrErr))
+			return nil, "", fmt.Errorf("%s: %w", op, incrErr)
+		}
+
+		attempts, incrErr := a.mfaChallengeStorage.IncrAttempts(ctx, challenge, a.mfaCfg.ChallengeTTL)
+		if incrErr != nil {
+			log.Error("failed to record mfa attempt", logger.Err(incrErr))
+			return nil, "", fmt.Errorf("%s: %w", op, incrErr)
+		}
+		if attempts >= a.mfaCfg.MaxAttempts {
+			a.deleteMFAChallenge(ctx, log, challenge)
+		}
+
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	a.deleteMFAChallenge(ctx, log, challenge)
+
+	err = a.loginAttempts.ResetAttempts(ctx, mfaLockoutKey(userID))
+	if err != nil {
+		log.Error("failed to reset mfa attempts", logger.Err(err))
+	}
+
+	user, err := a.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Error("user does not exists", logger.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	token, err := a.createSession(ctx, user.ID)
 	if err != nil {
 		log.Info("can not save session", logger.Err(err))
 		return nil, "", fmt.Errorf("%s: %w", op, err)
@@ -103,27 +372,93 @@ func (a Auth) Login(ctx context.Context, email string, password string) (*domain
 	return user, token, nil
 }
 
+func (a Auth) createSession(ctx context.Context, userID int64) (string, error) {
+	token, err := session.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.sessionStorage.Create(ctx, token, userID, time.Hour*24)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (a Auth) deleteMFAChallenge(ctx context.Context, log *slog.Logger, challenge string) {
+	err := a.mfaChallengeStorage.Delete(ctx, challenge)
+	if err != nil {
+		log.Error("failed to delete mfa challenge", logger.Err(err))
+	}
+}
+
 func (a Auth) Register(ctx context.Context, dto *dtos.UserRegisterDTO) (userID int64, err error) {
 	const op = "authService.Register"
 
 	log := a.log.With(slog.String("op", op))
 
+	err = a.registration.Check(dto.Email, dto.Barcode)
+	if err != nil {
+		log.Info("registration denied by policy", logger.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.passwords.Check(dto.Password, dto.FirstName, dto.LastName, dto.Email)
+	if err != nil {
+		var errs validation.Errors
+		if errors.As(err, &errs) {
+			log.Info("password denied by policy", logger.Err(err))
+		} else {
+			log.Error("failed to check password", logger.Err(err))
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	inviteCode := strings.TrimSpace(dto.InviteCode)
+	if inviteCode == "" && a.registration.InviteOnly() {
+		return 0, fmt.Errorf("%s: %w", op, validation.Errors{"invite_code": ErrInvitationRequired})
+	}
+
 	user := dto.ToDomain()
 
-	user.PasswordHash, err = bcrypt.GenerateFromPassword([]byte(dto.Password), bcrypt.DefaultCost)
+	user.PasswordHash, err = a.hasher.Hash(dto.Password)
 	if err != nil {
 		log.Error("failed to generate password hash", logger.Err(err))
 
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = a.usrStorage.SaveUser(ctx, user)
+	// the invitation is used only if the user is saved
+	err = a.usrStorage.WithTx(ctx, func(ctx context.Context) error {
+		err := a.usrStorage.SaveUser(ctx, user)
+		if err != nil || inviteCode == "" {
+			return err
+		}
+
+		invitation, err := a.invitations.Redeem(ctx, inviteCode, user.Email)
+		if err != nil {
+			return err
+		}
+		log.Info("invitation redeemed", slog.Int64("invitation_id", invitation.ID), slog.Int64("user_id", user.ID))
+
+		if invitation.Role == "" {
+			return nil
+		}
+		user.Role = invitation.Role
+		return a.usrStorage.SetUserRole(ctx, user.ID, invitation.Role)
+	})
 	if err != nil {
+		var errs validation.Errors
 		switch {
 		case errors.Is(err, storage.ErrUserExists):
 			log.Error("user already exists", logger.Err(err))
 			return 0, fmt.Errorf("%s: %w", op, ErrUserExists)
 
+		case errors.As(err, &errs):
+			log.Info("invitation code rejected", logger.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+
 		default:
 			log.Error("failed to save user", logger.Err(err))
 			return 0, fmt.Errorf("%s: %w", op, err)
@@ -178,6 +513,11 @@ func (a Auth) Authenticate(ctx context.Context, sessionToken string) (userID int
 	const op = "authService.Authenticate"
 	log := a.log.With(slog.String("op", op))
 
+	// other values could name keys that are not sessions
+	if !session.Valid(sessionToken) {
+		return 0, fmt.Errorf("%s: %w", op, ErrSessionNotExists)
+	}
+
 	userID, err = a.sessionStorage.Get(ctx, sessionToken)
 	if err != nil {
 		log.Error("failed to get session", logger.Err(err))
@@ -192,7 +532,35 @@ func (a Auth) Authenticate(ctx context.Context, sessionToken string) (userID int
 	return userID, nil
 }
 
-func (a Auth) CheckUserRole(ctx context.Context, userId int64, roles []userv1.Role) (bool, error) {
+// Principal returns the user a session belongs to, with the role used to authorize
+// their calls.
+func (a Auth) Principal(ctx context.Context, sessionToken string) (*domain.Principal, error) {
+	const op = "authService.Principal"
+	log := a.log.With(slog.String("op", op))
+
+	userID, err := a.Authenticate(ctx, sessionToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return &domain.Principal{UserID: user.ID, Role: user.Role}, nil
+}
+
+// CheckUserRole reports whether the user has one of roles. When scope is not nil,
+// roles held within the scope count as well, the global role still counts in any
+// scope.
+func (a Auth) CheckUserRole(ctx context.Context, userId int64, roles []domain.Role, scope *domain.RoleScope) (bool, error) {
 	const op = "authService.CheckUserRole"
 	log := a.log.With(slog.String("op", op))
 
@@ -208,8 +576,22 @@ func (a Auth) CheckUserRole(ctx context.Context, userId int64, roles []userv1.Ro
 		}
 	}
 
+	if slices.Contains(roles, role) {
+		return true, nil
+	}
+
+	if scope == nil {
+		return false, nil
+	}
+
+	scopedRoles, err := a.usrStorage.GetScopedRoles(ctx, userId, *scope)
+	if err != nil {
+		log.Error("failed to get scoped roles", logger.Err(err))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
 	for _, r := range roles {
-		if r.String() == role {
+		if slices.Contains(scopedRoles, r) {
 			return true, nil
 		}
 	}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestCheckUserRole_Scope(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	club := domain.RoleScope{Type: domain.RoleScopeClub, ID: 42}
+	otherClub := domain.RoleScope{Type: domain.RoleScopeClub, ID: 7}
+
+	users := &fakeUserStorage{
+		users: map[int64]*domain.User{
+			1: {ID: 1, Role: "USER", Activated: true},
+			2: {ID: 2, Role: "MODER", Activated: true},
+		},
+		scopedRoles: map[int64][]*domain.ScopedRole{
+			1: {{UserID: 1, Scope: club, Role: "MODER"}},
+		},
+	}
+	a := New(log, users, nil, nil, nil, nil, nil, fakeMFA{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, config.Phone{}, config.MFA{}, config.Login{})
+	moder := []domain.Role{domain.RoleModer}
+
+	tests := []struct {
+		name   string
+		userID int64
+		scope  *domain.RoleScope
+		want   bool
+	}{
+		{name: "scoped role without scope", userID: 1, want: false},
+		{name: "scoped role in its scope", userID: 1, scope: &club, want: true},
+		{name: "scoped role in another scope", userID: 1, scope: &otherClub, want: false},
+		{name: "global role without scope", userID: 2, want: true},
+		{name: "global role overrides scope", userID: 2, scope: &otherClub, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasRole, err := a.CheckUserRole(ctx, tt.userID, moder, tt.scope)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, hasRole)
+		})
+	}
+
+	_, err := a.CheckUserRole(ctx, 3, moder, nil)
+	assert.ErrorIs(t, err, ErrUserNotExist)
+}
+
+func (s *fakeUserStorage) GetUserRoleByID(_ context.Context, userID int64) (domain.Role, error) {
+	user, ok := s.users[userID]
+	if !ok || !user.Activated {
+		return "", storage.ErrUserNotExists
+	}
+	return user.Role, nil
+}
+
+func (s *fakeUserStorage) GetScopedRoles(_ context.Context, userID int64, scope domain.RoleScope) ([]domain.Role, error) {
+	var roles []domain.Role
+	for _, scopedRole := range s.scopedRoles[userID] {
+		if scopedRole.Scope == scope {
+			roles = append(roles, scopedRole.Role)
+		}
+	}
+	return roles, nil
+}
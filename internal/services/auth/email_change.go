@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/activate"
+	"log/slog"
+	"time"
+)
+
+const emailChangeTTL = time.Hour * 24
+
+type EmailChangeStorage interface {
+	CreateEmailChange(ctx context.Context, token string, userID int64, newEmail string, duration time.Duration) error
+	TakeEmailChange(ctx context.Context, token string) (userID int64, newEmail string, err error)
+}
+
+// RequestEmailChange sends a confirmation token to newEmail. The current email
+// stays in use until the change is confirmed with ConfirmEmailChange.
+func (a Auth) RequestEmailChange(ctx context.Context, userID int64, newEmail string) error {
+	const op = "authService.RequestEmailChange"
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Error("user does not exists", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if user.Email == newEmail {
+		return fmt.Errorf("%s: %w", op, ErrEmailUnchanged)
+	}
+
+	taken, err := a.usrStorage.EmailExists(ctx, newEmail)
+	if err != nil {
+		log.Error("failed to check email", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if taken {
+		return fmt.Errorf("%s: %w", op, ErrUserExists)
+	}
+
+	token, err := activate.GenerateToken()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.emailChangeStorage.CreateEmailChange(ctx, token, user.ID, newEmail, emailChangeTTL)
+	if err != nil {
+		log.Error("can not save email change token", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	msg := struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Email     string `json:"email"`
+		Token     string `json:"token"`
+	}{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     newEmail,
+		Token:     token,
+	}
+
+	err = a.amqp.Publish(ctx, "user.notification.email_change", msg)
+	if err != nil {
+		log.Error("failed to publish", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange switches the user to the email the token was issued for and
+// notifies the previous address. ErrUserExists is returned if the email was taken
+// by another user in the meantime. The token is taken before the change is applied,
+// so it can not be replayed, even if the change then fails.
+func (a Auth) ConfirmEmailChange(ctx context.Context, token string) error {
+	const op = "authService.ConfirmEmailChange"
+	log := a.log.With(slog.String("op", op))
+
+	userID, newEmail, err := a.emailChangeStorage.TakeEmailChange(ctx, token)
+	if err != nil {
+		log.Error("failed to take email change token", logger.Err(err))
+		switch {
+		case errors.Is(err, storage.ErrTokenNotExists):
+			return fmt.Errorf("%s: %w", op, ErrEmailChangeNotExists)
+		default:
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var (
+		user     *domain.User
+		oldEmail string
+	)
+	err = a.usrStorage.WithTx(ctx, func(ctx context.Context) error {
+		user, err = a.usrStorage.GetUserByIDForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		oldEmail = user.Email
+		user.Email = newEmail
+
+		return a.usrStorage.UpdateUser(ctx, user, []string{domain.FieldEmail})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Error("user does not exists", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		case errors.Is(err, storage.ErrUserExists):
+			log.Info("email already taken", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrUserExists)
+		default:
+			log.Error("failed to update email", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	updatedMsg := struct {
+		ID    int64  `json:"id"`
+		Email string `json:"email"`
+	}{
+		ID:    user.ID,
+		Email: user.Email,
+	}
+
+	err = a.amqp.Publish(ctx, "user.club.updated", updatedMsg)
+	if err != nil {
+		log.Error("failed to publish user updated event", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	notificationMsg := struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Email     string `json:"email"`
+		NewEmail  string `json:"new_email"`
+	}{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     oldEmail,
+		NewEmail:  user.Email,
+	}
+
+	err = a.amqp.Publish(ctx, "user.notification.email_changed", notificationMsg)
+	if err != nil {
+		log.Error("failed to publish", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
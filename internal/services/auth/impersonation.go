@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/session"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+var ErrImpersonationNotAllowed = errors.New("user can not be impersonated")
+
+// privilegedRoles can not be impersonated, so that an impersonation never grants
+// more than the impersonated user could do.
+var privilegedRoles = []domain.Role{domain.RoleAdmin, domain.RoleDSVR}
+
+// Impersonations lets staff act as another user. Impersonation sessions are regular
+// sessions of the user issued by the wrapped Auth, flagged with the impersonation
+// they belong to. The start and the end of every impersonation are recorded, logged
+// and published.
+type Impersonations struct {
+	log      *slog.Logger
+	auth     *Auth
+	storage  ImpersonationStorage
+	sessions TokenStorage
+	cfg      config.Impersonation
+}
+
+type ImpersonationStorage interface {
+	SaveImpersonation(ctx context.Context, impersonation *domain.Impersonation, ttl time.Duration) error
+	GetImpersonation(ctx context.Context, id int64) (*domain.Impersonation, error)
+	EndImpersonation(ctx context.Context, id int64, reason string) (*domain.Impersonation, error)
+	EndExpiredImpersonations(ctx context.Context) ([]*domain.Impersonation, error)
+}
+
+// NewImpersonations creates the impersonations, sessions maps impersonation session
+// tokens to the ID of their impersonation.
+func NewImpersonations(
+	log *slog.Logger,
+	auth *Auth,
+	storage ImpersonationStorage,
+	sessions TokenStorage,
+	cfg config.Impersonation,
+) *Impersonations {
+	return &Impersonations{
+		log:      log,
+		auth:     auth,
+		storage:  storage,
+		sessions: sessions,
+		cfg:      cfg,
+	}
+}
+
+// impersonationEvent is the message published on user.impersonation.started and
+// user.impersonation.ended.
+type impersonationEvent struct {
+	ImpersonationID int64      `json:"impersonation_id"`
+	ImpersonatorID  int64      `json:"impersonator_id"`
+	UserID          int64      `json:"user_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	EndReason       string     `json:"end_reason,omitempty"`
+}
+
+// Impersonate starts a session of the user for the impersonator, which expires after
+// the configured TTL. Users with a privileged role can not be impersonated, nor can
+// impersonators impersonate themselves.
+func (i Impersonations) Impersonate(ctx context.Context, impersonatorID int64, userID int64) (string, *domain.Impersonation, error) {
+	const op = "authService.Impersonations.Impersonate"
+	log := i.log.With(slog.String("op", op), slog.Int64("impersonator_id", impersonatorID), slog.Int64("user_id", userID))
+
+	if impersonatorID == userID {
+		return "", nil, fmt.Errorf("%s: %w", op, ErrImpersonationNotAllowed)
+	}
+
+	user, err := i.auth.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			return "", nil, fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return "", nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if slices.Contains(privilegedRoles, user.Role) {
+		log.Warn("impersonation of a privileged user denied", slog.String("role", user.Role.String()))
+		return "", nil, fmt.Errorf("%s: %w", op, ErrImpersonationNotAllowed)
+	}
+
+	token, err := session.GenerateToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	impersonation := &domain.Impersonation{ImpersonatorID: impersonatorID, UserID: userID}
+	err = i.storage.SaveImpersonation(ctx, impersonation, i.cfg.SessionTTL)
+	if err != nil {
+		log.Error("failed to save impersonation", logger.Err(err))
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the flag is saved before the session, so that the session is never usable
+	// without it
+	err = i.sessions.Create(ctx, token, impersonation.ID, i.cfg.SessionTTL)
+	if err != nil {
+		log.Error("failed to save impersonation session", logger.Err(err))
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+	err = i.auth.sessionStorage.Create(ctx, token, userID, i.cfg.SessionTTL)
+	if err != nil {
+		log.Error("failed to create session", logger.Err(err))
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("impersonation started", slog.Int64("impersonation_id", impersonation.ID))
+
+	err = i.auth.amqp.Publish(ctx, "user.impersonation.started", newImpersonationEvent(impersonation))
+	if err != nil {
+		log.Error("failed to publish impersonation started event", logger.Err(err))
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, impersonation, nil
+}
+
+// Impersonation returns the impersonation the session belongs to, or nil if the
+// session is not an impersonation.
+func (i Impersonations) Impersonation(ctx context.Context, sessionToken string) (*domain.Impersonation, error) {
+	const op = "authService.Impersonations.Impersonation"
+
+	id, err := i.sessions.Get(ctx, sessionToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotExists) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	impersonation, err := i.storage.GetImpersonation(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return impersonation, nil
+}
+
+// Principal returns the user a session belongs to, with the impersonator for
+// impersonation sessions.
+func (i Impersonations) Principal(ctx context.Context, sessionToken string) (*domain.Principal, error) {
+	const op = "authService.Impersonations.Principal"
+	log := i.log.With(slog.String("op", op))
+
+	principal, err := i.auth.Principal(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonation, err := i.Impersonation(ctx, sessionToken)
+	if err != nil {
+		log.Error("failed to get impersonation", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if impersonation != nil {
+		principal.ImpersonatorID = impersonation.ImpersonatorID
+	}
+
+	return principal, nil
+}
+
+// Logout deletes the session, ending the impersonation if the session is one.
+func (i Impersonations) Logout(ctx context.Context, sessionToken string) error {
+	const op = "authService.Impersonations.Logout"
+	log := i.log.With(slog.String("op", op))
+
+	impersonation, err := i.Impersonation(ctx, sessionToken)
+	if err != nil {
+		log.Error("failed to get impersonation", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = i.auth.Logout(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	if impersonation == nil {
+		return nil
+	}
+
+	err = i.sessions.Delete(ctx, sessionToken)
+	if err != nil {
+		log.Error("failed to delete impersonation session", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	impersonation, err = i.storage.EndImpersonation(ctx, impersonation.ID, domain.ImpersonationStopped)
+	if err != nil {
+		if errors.Is(err, storage.ErrImpersonationNotExists) {
+			// the impersonation has already expired
+			return nil
+		}
+		log.Error("failed to end impersonation", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	i.ended(ctx, log, impersonation)
+
+	return nil
+}
+
+// ExpireImpersonations records the end of the expired impersonations and returns how
+// many have ended.
+func (i Impersonations) ExpireImpersonations(ctx context.Context) (int, error) {
+	const op = "authService.Impersonations.ExpireImpersonations"
+	log := i.log.With(slog.String("op", op))
+
+	impersonations, err := i.storage.EndExpiredImpersonations(ctx)
+	if err != nil {
+		log.Error("failed to end expired impersonations", logger.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, impersonation := range impersonations {
+		i.ended(ctx, log, impersonation)
+	}
+
+	return len(impersonations), nil
+}
+
+// RunExpiry calls ExpireImpersonations periodically until ctx is done.
+func (i Impersonations) RunExpiry(ctx context.Context) {
+	const op = "authService.Impersonations.RunExpiry"
+	log := i.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(i.cfg.ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := i.ExpireImpersonations(ctx); err != nil {
+				log.Error("failed to expire impersonations", logger.Err(err))
+			}
+		}
+	}
+}
+
+func (i Impersonations) ended(ctx context.Context, log *slog.Logger, impersonation *domain.Impersonation) {
+	log.Info("impersonation ended",
+		slog.Int64("impersonation_id", impersonation.ID),
+		slog.Int64("impersonator_id", impersonation.ImpersonatorID),
+		slog.Int64("user_id", impersonation.UserID),
+		slog.String("reason", impersonation.EndReason),
+	)
+
+	err := i.auth.amqp.Publish(ctx, "user.impersonation.ended", newImpersonationEvent(impersonation))
+	if err != nil {
+		log.Error("failed to publish impersonation ended event", logger.Err(err))
+	}
+}
+
+func newImpersonationEvent(impersonation *domain.Impersonation) impersonationEvent {
+	return impersonationEvent{
+		ImpersonationID: impersonation.ID,
+		ImpersonatorID:  impersonation.ImpersonatorID,
+		UserID:          impersonation.UserID,
+		StartedAt:       impersonation.StartedAt,
+		ExpiresAt:       impersonation.ExpiresAt,
+		EndedAt:         impersonation.EndedAt,
+		EndReason:       impersonation.EndReason,
+	}
+}
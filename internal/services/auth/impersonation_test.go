@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestImpersonations(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := &fakeUserStorage{users: map[int64]*domain.User{
+		1: {ID: 1, Role: domain.RoleAdmin, Activated: true},
+		2: {ID: 2, Role: domain.RoleUser, Activated: true},
+		3: {ID: 3, Role: domain.RoleDSVR, Activated: true},
+	}}
+	sessions := &fakeTokenStorage{tokens: map[string]int64{}}
+	amqp := &fakeAmqp{}
+	impersonationStorage := &fakeImpersonationStorage{impersonations: map[int64]*domain.Impersonation{}}
+
+	a := New(log, users, sessions, nil, nil, nil, nil, fakeMFA{}, nil, nil, nil, nil, nil, nil, nil, nil, amqp, config.Phone{}, config.MFA{}, config.Login{})
+	i := NewImpersonations(
+		log,
+		a,
+		impersonationStorage,
+		&fakeTokenStorage{tokens: map[string]int64{}},
+		config.Impersonation{SessionTTL: time.Minute},
+	)
+
+	_, _, err := i.Impersonate(ctx, 1, 1)
+	assert.ErrorIs(t, err, ErrImpersonationNotAllowed, "impersonating yourself")
+	_, _, err = i.Impersonate(ctx, 1, 3)
+	assert.ErrorIs(t, err, ErrImpersonationNotAllowed, "impersonating a privileged user")
+	_, _, err = i.Impersonate(ctx, 1, 4)
+	assert.ErrorIs(t, err, ErrUserNotExist)
+
+	token, impersonation, err := i.Impersonate(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), impersonation.ImpersonatorID)
+
+	principal, err := i.Principal(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), principal.UserID)
+	assert.Equal(t, domain.RoleUser, principal.Role)
+	assert.Equal(t, int64(1), principal.ImpersonatorID)
+	assert.True(t, principal.Impersonated())
+
+	require.NoError(t, i.Logout(ctx, token))
+	_, err = i.Principal(ctx, token)
+	assert.ErrorIs(t, err, ErrSessionNotExists)
+	assert.Equal(t, domain.ImpersonationStopped, impersonationStorage.impersonations[impersonation.ID].EndReason)
+
+	_, expiring, err := i.Impersonate(ctx, 1, 2)
+	require.NoError(t, err)
+	expiring.ExpiresAt = time.Now().Add(-time.Second)
+	n, err := i.ExpireImpersonations(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, []string{
+		"user.impersonation.started",
+		"user.impersonation.ended",
+		"user.impersonation.started",
+		"user.impersonation.ended",
+	}, amqp.routingKeys)
+
+	token, err = a.createSession(ctx, 2)
+	require.NoError(t, err)
+	principal, err = i.Principal(ctx, token)
+	require.NoError(t, err)
+	assert.False(t, principal.Impersonated(), "regular sessions are not impersonations")
+}
+
+type fakeImpersonationStorage struct {
+	impersonations map[int64]*domain.Impersonation
+}
+
+func (s *fakeImpersonationStorage) SaveImpersonation(_ context.Context, impersonation *domain.Impersonation, ttl time.Duration) error {
+	impersonation.ID = int64(len(s.impersonations) + 1)
+	impersonation.StartedAt = time.Now()
+	impersonation.ExpiresAt = impersonation.StartedAt.Add(ttl)
+	s.impersonations[impersonation.ID] = impersonation
+	return nil
+}
+
+func (s *fakeImpersonationStorage) GetImpersonation(_ context.Context, id int64) (*domain.Impersonation, error) {
+	impersonation, ok := s.impersonations[id]
+	if !ok {
+		return nil, storage.ErrImpersonationNotExists
+	}
+	return impersonation, nil
+}
+
+func (s *fakeImpersonationStorage) EndImpersonation(_ context.Context, id int64, reason string) (*domain.Impersonation, error) {
+	impersonation, ok := s.impersonations[id]
+	if !ok || impersonation.EndedAt != nil {
+		return nil, storage.ErrImpersonationNotExists
+	}
+	now := time.Now()
+	impersonation.EndedAt = &now
+	impersonation.EndReason = reason
+	return impersonation, nil
+}
+
+func (s *fakeImpersonationStorage) EndExpiredImpersonations(_ context.Context) ([]*domain.Impersonation, error) {
+	var ended []*domain.Impersonation
+	for _, impersonation := range s.impersonations {
+		if impersonation.EndedAt == nil && !impersonation.ExpiresAt.After(time.Now()) {
+			impersonation.EndedAt = &impersonation.ExpiresAt
+			impersonation.EndReason = domain.ImpersonationExpired
+			ended = append(ended, impersonation)
+		}
+	}
+	return ended, nil
+}
+
+type fakeAmqp struct {
+	routingKeys []string
+}
+
+func (a *fakeAmqp) Publish(_ context.Context, routingKey string, _ any) error {
+	a.routingKeys = append(a.routingKeys, routingKey)
+	return nil
+}
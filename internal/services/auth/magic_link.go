@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/session"
+	"log/slog"
+	"time"
+)
+
+// MagicLinkStorage keeps single-use magic link tokens.
+type MagicLinkStorage interface {
+	Create(ctx context.Context, token string, userID int64, duration time.Duration) error
+	Take(ctx context.Context, token string) (userID int64, err error)
+}
+
+var ErrMagicLinkNotExists = errors.New("magic link does not exists or has expired")
+
+// RequestMagicLink sends a single-use login link to email through the
+// user.notification.magic_link event. While the email is locked out after failed
+// logins ErrTooManyAttempts is returned, so that a link can not be used to get
+// around the lockout. Requests are also throttled per email by their own counter,
+// so that the link cannot be used to flood a mailbox, and do not count as failed
+// logins so that nobody can lock an account out by requesting links for it. To
+// avoid revealing which emails are registered, no error is returned for an unknown
+// email.
+func (a Auth) RequestMagicLink(ctx context.Context, email string) error {
+	const op = "authService.RequestMagicLink"
+	log := a.log.With(slog.String("op", op))
+
+	err := a.checkLockout(ctx, email)
+	if err != nil {
+		log.Info("login is locked out", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	requests, err := a.magicLinkRequests.Attempts(ctx, lockoutKey(email))
+	if err != nil {
+		log.Error("failed to get magic link requests", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if requests >= a.loginCfg.MagicLinkMaxRequests {
+		log.Info("magic links requested too often")
+		return fmt.Errorf("%s: %w", op, ErrTooManyRequests)
+	}
+
+	_, err = a.magicLinkRequests.IncrAttempts(ctx, lockoutKey(email), a.loginCfg.MagicLinkRequestWindow)
+	if err != nil {
+		log.Error("failed to record magic link request", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrStorage.GetUserByEmail(ctx, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Info("magic link requested for unknown email")
+			return nil
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	token, err := session.GenerateToken()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.magicLinkStorage.Create(ctx, token, user.ID, a.loginCfg.MagicLinkTTL)
+	if err != nil {
+		log.Error("can not save magic link token", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	msg := struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Email     string `json:"email"`
+		Token     string `json:"token"`
+	}{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Token:     token,
+	}
+
+	err = a.amqp.Publish(ctx, "user.notification.magic_link", msg)
+	if err != nil {
+		log.Error("failed to publish", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RedeemMagicLink exchanges a magic link token for a session. The token can be
+// redeemed only once. Like Login, users with two-factor authentication get an MFA
+// challenge and an error wrapping ErrMFARequired instead of a session. Redeeming a
+// link does not reset the lockout of failed password logins.
+func (a Auth) RedeemMagicLink(ctx context.Context, token string) (*domain.User, string, error) {
+	const op = "authService.RedeemMagicLink"
+	log := a.log.With(slog.String("op", op))
+
+	userID, err := a.magicLinkStorage.Take(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTokenNotExists):
+			return nil, "", fmt.Errorf("%s: %w", op, ErrMagicLinkNotExists)
+		default:
+			log.Error("failed to get magic link token", logger.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	user, err := a.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Error("user does not exists", logger.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	sessionToken, err := a.startSession(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMFARequired):
+			return user, sessionToken, fmt.Errorf("%s: %w", op, err)
+		case errors.Is(err, ErrTooManyAttempts):
+			log.Info("mfa is locked out", slog.Int64("user_id", user.ID))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		log.Error("can not start session", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, sessionToken, nil
+}
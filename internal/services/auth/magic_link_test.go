@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestRequestMagicLink_ThrottledApartFromLogin(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	users := &fakeUserStorage{users: map[int64]*domain.User{
+		1: {ID: 1, Email: "student@astanait.edu.kz", Activated: true},
+	}}
+	links := &fakeMagicLinkStorage{tokens: map[string]int64{}}
+	loginAttempts := &fakeAttemptLimiter{attempts: map[string]int{}}
+	linkRequests := &fakeAttemptLimiter{attempts: map[string]int{}}
+	amqp := &fakeAmqp{}
+	loginCfg := config.Login{MaxAttempts: 1, MagicLinkMaxRequests: 3, MagicLinkRequestWindow: time.Minute}
+	a := New(log, users, nil, nil, nil, nil, nil, fakeMFA{}, nil, links, loginAttempts, linkRequests, nil, nil, nil, nil, amqp, config.Phone{}, config.MFA{}, loginCfg)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, a.RequestMagicLink(ctx, "student@astanait.edu.kz"))
+	}
+	assert.ErrorIs(t, a.RequestMagicLink(ctx, "student@astanait.edu.kz"), ErrTooManyRequests)
+	assert.Len(t, amqp.routingKeys, 3)
+
+	// requesting links does not lock the account out of password logins
+	assert.Empty(t, loginAttempts.attempts)
+	require.NoError(t, a.checkLockout(ctx, "student@astanait.edu.kz"))
+
+	// unknown emails are throttled the same, without revealing that they are unknown
+	for i := 0; i < 3; i++ {
+		require.NoError(t, a.RequestMagicLink(ctx, "nobody@astanait.edu.kz"))
+	}
+	assert.ErrorIs(t, a.RequestMagicLink(ctx, "nobody@astanait.edu.kz"), ErrTooManyRequests)
+
+	// rejected requests are not counted
+	assert.Equal(t, 3, linkRequests.attempts[lockoutKey("nobody@astanait.edu.kz")])
+}
+
+func TestMagicLink_RespectsLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	users := &fakeUserStorage{users: map[int64]*domain.User{
+		1: {ID: 1, Email: "student@astanait.edu.kz", Activated: true},
+	}}
+	links := &fakeMagicLinkStorage{tokens: map[string]int64{}}
+	loginAttempts := &fakeAttemptLimiter{attempts: map[string]int{}}
+	linkRequests := &fakeAttemptLimiter{attempts: map[string]int{}}
+	loginCfg := config.Login{MaxAttempts: 1, MagicLinkMaxRequests: 3, MagicLinkRequestWindow: time.Minute}
+	a := New(log, users, &fakeTokenStorage{tokens: map[string]int64{}}, nil, nil, nil, nil, fakeMFA{}, nil, links, loginAttempts, linkRequests, nil, nil, nil, nil, &fakeAmqp{}, config.Phone{}, config.MFA{}, loginCfg)
+
+	require.NoError(t, a.RequestMagicLink(ctx, "student@astanait.edu.kz"))
+	require.Len(t, links.tokens, 1)
+
+	// a failed password login locks the email out
+	loginAttempts.attempts[lockoutKey("student@astanait.edu.kz")] = 1
+
+	assert.ErrorIs(t, a.RequestMagicLink(ctx, "student@astanait.edu.kz"), ErrTooManyAttempts)
+	assert.Len(t, links.tokens, 1)
+
+	// a link sent before the lockout still logs in, but does not lift the lockout
+	for token := range links.tokens {
+		_, _, err := a.RedeemMagicLink(ctx, token)
+		require.NoError(t, err)
+	}
+	assert.ErrorIs(t, a.checkLockout(ctx, "student@astanait.edu.kz"), ErrTooManyAttempts)
+}
+
+type fakeMagicLinkStorage struct {
+	tokens map[string]int64
+}
+
+func (s *fakeMagicLinkStorage) Create(_ context.Context, token string, userID int64, _ time.Duration) error {
+	s.tokens[token] = userID
+	return nil
+}
+
+func (s *fakeMagicLinkStorage) Take(_ context.Context, token string) (int64, error) {
+	userID, ok := s.tokens[token]
+	if !ok {
+		return 0, storage.ErrTokenNotExists
+	}
+	delete(s.tokens, token)
+	return userID, nil
+}
+
+type fakeAttemptLimiter struct {
+	attempts map[string]int
+}
+
+func (l *fakeAttemptLimiter) Attempts(_ context.Context, key string) (int, error) {
+	return l.attempts[key], nil
+}
+
+func (l *fakeAttemptLimiter) IncrAttempts(_ context.Context, key string, _ time.Duration) (int, error) {
+	l.attempts[key]++
+	return l.attempts[key], nil
+}
+
+func (l *fakeAttemptLimiter) ResetAttempts(_ context.Context, key string) error {
+	delete(l.attempts, key)
+	return nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+const testMFACode = "123456"
+
+func TestVerifyMFA_LockoutAcrossChallenges(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	user := &domain.User{ID: 1, Email: "student@astanait.edu.kz", Activated: true}
+	users := &fakeUserStorage{users: map[int64]*domain.User{user.ID: user}}
+	sessions := &fakeTokenStorage{tokens: map[string]int64{}}
+	challenges := &fakeChallengeStorage{fakeTokenStorage: &fakeTokenStorage{tokens: map[string]int64{}}, attempts: map[string]int{}}
+	loginAttempts := &fakeAttemptLimiter{attempts: map[string]int{}}
+	mfaCfg := config.MFA{ChallengeTTL: time.Minute, MaxAttempts: 3}
+	loginCfg := config.Login{MaxAttempts: 5, LockoutDuration: time.Minute}
+	a := New(log, users, sessions, nil, nil, nil, nil, fakeEnabledMFA{}, challenges, nil, loginAttempts, nil, nil, nil, nil, nil, nil, config.Phone{}, mfaCfg, loginCfg)
+
+	// a correct password issues a fresh challenge, but failures keep counting
+	for i := 0; i < loginCfg.MaxAttempts; i++ {
+		challenge, err := a.startSession(ctx, user)
+		require.ErrorIs(t, err, ErrMFARequired)
+
+		_, _, err = a.VerifyMFA(ctx, challenge, "000000")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, err := a.startSession(ctx, user)
+	assert.ErrorIs(t, err, ErrTooManyAttempts, "no challenge is issued while locked out")
+
+	// a challenge issued before the lockout can not be used either, even with a valid code
+	challenge := "issued-before-lockout"
+	require.NoError(t, challenges.Create(ctx, challenge, user.ID, time.Minute))
+	_, _, err = a.VerifyMFA(ctx, challenge, testMFACode)
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Empty(t, sessions.tokens)
+
+	// once the lockout expires, a valid code logs in and resets the count
+	delete(loginAttempts.attempts, mfaLockoutKey(user.ID))
+	challenge, err = a.startSession(ctx, user)
+	require.ErrorIs(t, err, ErrMFARequired)
+	_, _, err = a.VerifyMFA(ctx, challenge, "000000")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, token, err := a.VerifyMFA(ctx, challenge, testMFACode)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, sessions.tokens[token])
+	assert.Zero(t, loginAttempts.attempts[mfaLockoutKey(user.ID)])
+}
+
+func TestVerifyMFA_ChallengeDiscardedAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	user := &domain.User{ID: 1, Email: "student@astanait.edu.kz", Activated: true}
+	users := &fakeUserStorage{users: map[int64]*domain.User{user.ID: user}}
+	challenges := &fakeChallengeStorage{fakeTokenStorage: &fakeTokenStorage{tokens: map[string]int64{}}, attempts: map[string]int{}}
+	loginAttempts := &fakeAttemptLimiter{attempts: map[string]int{}}
+	mfaCfg := config.MFA{ChallengeTTL: time.Minute, MaxAttempts: 2}
+	loginCfg := config.Login{MaxAttempts: 5, LockoutDuration: time.Minute}
+	a := New(log, users, &fakeTokenStorage{tokens: map[string]int64{}}, nil, nil, nil, nil, fakeEnabledMFA{}, challenges, nil, loginAttempts, nil, nil, nil, nil, nil, nil, config.Phone{}, mfaCfg, loginCfg)
+
+	challenge, err := a.startSession(ctx, user)
+	require.ErrorIs(t, err, ErrMFARequired)
+
+	for i := 0; i < mfaCfg.MaxAttempts; i++ {
+		_, _, err = a.VerifyMFA(ctx, challenge, "000000")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, _, err = a.VerifyMFA(ctx, challenge, testMFACode)
+	assert.ErrorIs(t, err, ErrMFAChallengeNotExists)
+}
+
+type fakeChallengeStorage struct {
+	*fakeTokenStorage
+	attempts map[string]int
+}
+
+func (s *fakeChallengeStorage) IncrAttempts(_ context.Context, token string, _ time.Duration) (int, error) {
+	s.attempts[token]++
+	return s.attempts[token], nil
+}
+
+// fakeEnabledMFA is a user with two-factor authentication accepting testMFACode.
+type fakeEnabledMFA struct{}
+
+func (fakeEnabledMFA) IsEnabled(context.Context, int64) (bool, error) { return true, nil }
+
+func (fakeEnabledMFA) Verify(_ context.Context, _ int64, code string) error {
+	if code != testMFACode {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
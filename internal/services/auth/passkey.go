@@ -0,0 +1,366 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrPasskeyCeremonyNotExists = errors.New("passkey ceremony does not exists or has expired")
+	ErrInvalidPasskey           = errors.New("invalid passkey response")
+	ErrPasskeyExists            = errors.New("passkey already registered")
+)
+
+// Passkeys implements WebAuthn registration and passwordless login. Sessions are
+// issued by the wrapped Auth, so a passkey login is indistinguishable from a
+// password login for the rest of the system.
+type Passkeys struct {
+	log         *slog.Logger
+	auth        *Auth
+	webAuthn    *webauthn.WebAuthn
+	credentials CredentialStorage
+	ceremonies  CeremonyStorage
+	ceremonyTTL time.Duration
+}
+
+type CredentialStorage interface {
+	SaveWebAuthnCredential(ctx context.Context, cred *domain.WebAuthnCredential) error
+	GetWebAuthnCredentialsByUserID(ctx context.Context, userID int64) ([]*domain.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error
+}
+
+type CeremonyStorage interface {
+	SaveCeremony(ctx context.Context, key string, data []byte, duration time.Duration) error
+	TakeCeremony(ctx context.Context, key string) ([]byte, error)
+}
+
+func NewPasskeys(
+	log *slog.Logger,
+	auth *Auth,
+	webAuthn *webauthn.WebAuthn,
+	credentials CredentialStorage,
+	ceremonies CeremonyStorage,
+	ceremonyTTL time.Duration,
+) *Passkeys {
+	return &Passkeys{
+		log:         log,
+		auth:        auth,
+		webAuthn:    webAuthn,
+		credentials: credentials,
+		ceremonies:  ceremonies,
+		ceremonyTTL: ceremonyTTL,
+	}
+}
+
+// BeginRegistration starts the registration of a new passkey for the user and
+// returns the JSON encoded PublicKeyCredentialCreationOptions for the client.
+func (p Passkeys) BeginRegistration(ctx context.Context, userID int64) (options []byte, err error) {
+	const op = "authService.Passkeys.BeginRegistration"
+	log := p.log.With(slog.String("op", op))
+
+	user, err := p.webAuthnUser(ctx, userID)
+	if err != nil {
+		log.Error("failed to get user", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, len(user.credentials))
+	for i, cred := range user.credentials {
+		exclusions[i] = cred.Descriptor()
+	}
+
+	creation, session, err := p.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		log.Error("failed to begin registration", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = p.saveCeremony(ctx, registrationKey(userID), session)
+	if err != nil {
+		log.Error("failed to save registration ceremony", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	options, err = json.Marshal(creation)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return options, nil
+}
+
+// FinishRegistration verifies the JSON encoded attestation returned by the client
+// and stores the new passkey.
+func (p Passkeys) FinishRegistration(ctx context.Context, userID int64, response []byte) error {
+	const op = "authService.Passkeys.FinishRegistration"
+	log := p.log.With(slog.String("op", op))
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Info("failed to parse attestation", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+
+	session, err := p.takeCeremony(ctx, registrationKey(userID))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := p.webAuthnUser(ctx, userID)
+	if err != nil {
+		log.Error("failed to get user", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	cred, err := p.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		log.Info("invalid attestation", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+
+	transports := make([]string, len(cred.Transport))
+	for i, transport := range cred.Transport {
+		transports[i] = string(transport)
+	}
+
+	err = p.credentials.SaveWebAuthnCredential(ctx, &domain.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrCredentialExists):
+			return fmt.Errorf("%s: %w", op, ErrPasskeyExists)
+		default:
+			log.Error("failed to save credential", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// BeginLogin starts a passkey login and returns the JSON encoded
+// PublicKeyCredentialRequestOptions for the client. The user is not known yet,
+// it is identified by the discoverable credential the client picks.
+func (p Passkeys) BeginLogin(ctx context.Context) (options []byte, err error) {
+	const op = "authService.Passkeys.BeginLogin"
+	log := p.log.With(slog.String("op", op))
+
+	assertion, session, err := p.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		log.Error("failed to begin login", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = p.saveCeremony(ctx, loginKey(session.Challenge), session)
+	if err != nil {
+		log.Error("failed to save login ceremony", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	options, err = json.Marshal(assertion)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return options, nil
+}
+
+// PasskeyLogin verifies the JSON encoded assertion returned by the client and
+// issues the same session token as Auth.Login.
+//
+// Unlike Login it deliberately skips the TOTP of users with two-factor
+// authentication: BeginLogin requires user verification, so the assertion already
+// proves two factors, the authenticator and the PIN or biometric that unlocked it.
+func (p Passkeys) PasskeyLogin(ctx context.Context, response []byte) (*domain.User, string, error) {
+	const op = "authService.Passkeys.PasskeyLogin"
+	log := p.log.With(slog.String("op", op))
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Info("failed to parse assertion", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+
+	session, err := p.takeCeremony(ctx, loginKey(parsed.Response.CollectedClientData.Challenge))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var user *webAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != 8 {
+			return nil, ErrUserNotExist
+		}
+		u, err := p.webAuthnUser(ctx, int64(binary.BigEndian.Uint64(userHandle)))
+		if err != nil {
+			return nil, err
+		}
+		user = u
+		return u, nil
+	}
+
+	cred, err := p.webAuthn.ValidateDiscoverableLogin(handler, *session, parsed)
+	if err != nil {
+		log.Info("invalid assertion", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if cred.Authenticator.CloneWarning {
+		log.Warn("passkey signature counter did not increase, authenticator may be cloned",
+			slog.Int64("user_id", user.ID),
+			slog.String("credential_id", base64.RawURLEncoding.EncodeToString(cred.ID)),
+		)
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	err = p.credentials.UpdateWebAuthnCredentialUsage(ctx, cred.ID, cred.Authenticator.SignCount, cred.Flags.BackupState)
+	if err != nil {
+		log.Error("failed to update credential", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// not startSession, the passkey is the second factor
+	token, err := p.auth.createSession(ctx, user.ID)
+	if err != nil {
+		log.Info("can not save session", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user.User, token, nil
+}
+
+func (p Passkeys) saveCeremony(ctx context.Context, key string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return p.ceremonies.SaveCeremony(ctx, key, data, p.ceremonyTTL)
+}
+
+func (p Passkeys) takeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	data, err := p.ceremonies.TakeCeremony(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotExists) {
+			return nil, ErrPasskeyCeremonyNotExists
+		}
+		p.log.Error("failed to get ceremony", logger.Err(err))
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (p Passkeys) webAuthnUser(ctx context.Context, userID int64) (*webAuthnUser, error) {
+	user, err := p.auth.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotExists) {
+			return nil, ErrUserNotExist
+		}
+		return nil, err
+	}
+
+	creds, err := p.credentials.GetWebAuthnCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWebAuthnUser(user, creds), nil
+}
+
+func registrationKey(userID int64) string {
+	return "registration:" + strconv.FormatInt(userID, 10)
+}
+
+func loginKey(challenge string) string {
+	return "login:" + challenge
+}
+
+// webAuthnUser adapts a domain.User and its passkeys to webauthn.User. The user
+// handle is the big-endian encoded user id.
+type webAuthnUser struct {
+	*domain.User
+	credentials []webauthn.Credential
+}
+
+func newWebAuthnUser(user *domain.User, creds []*domain.WebAuthnCredential) *webAuthnUser {
+	credentials := make([]webauthn.Credential, len(creds))
+	for i, cred := range creds {
+		transports := make([]protocol.AuthenticatorTransport, len(cred.Transports))
+		for j, transport := range cred.Transports {
+			transports[j] = protocol.AuthenticatorTransport(transport)
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              cred.CredentialID,
+			PublicKey:       cred.PublicKey,
+			AttestationType: cred.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: cred.BackupEligible,
+				BackupState:    cred.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    cred.AAGUID,
+				SignCount: cred.SignCount,
+			},
+		}
+	}
+
+	return &webAuthnUser{User: user, credentials: credentials}
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, uint64(u.ID))
+	return id
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.FirstName + " " + u.LastName
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
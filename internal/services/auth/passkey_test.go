@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+func TestPasskeys_RegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	p, sessions := newTestPasskeys(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	registerPasskey(t, p, authenticator, 1)
+
+	user, token := loginWithPasskey(t, p, authenticator, 1)
+	assert.Equal(t, int64(1), user.ID)
+	assert.Equal(t, int64(1), sessions.tokens[token], "session must be issued for the user")
+
+	cred := p.credentials.(*fakeCredentialStorage).creds[0]
+	assert.Equal(t, uint32(1), cred.SignCount, "sign counter must be updated")
+
+	_, _, err := p.PasskeyLogin(ctx, authenticator.assert(t, "unknown-challenge", 1))
+	assert.ErrorIs(t, err, ErrPasskeyCeremonyNotExists)
+}
+
+func TestPasskeys_RejectsReplayedCounter(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestPasskeys(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	registerPasskey(t, p, authenticator, 1)
+	loginWithPasskey(t, p, authenticator, 1)
+
+	// a cloned authenticator reuses the counter of the original
+	authenticator.signCount--
+
+	options, err := p.BeginLogin(ctx)
+	require.NoError(t, err)
+
+	_, _, err = p.PasskeyLogin(ctx, authenticator.assert(t, challengeFrom(t, options), 1))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestPasskeys_RejectsWrongOrigin(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestPasskeys(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	registerPasskey(t, p, authenticator, 1)
+
+	options, err := p.BeginLogin(ctx)
+	require.NoError(t, err)
+
+	authenticator.origin = "https://evil.example"
+	_, _, err = p.PasskeyLogin(ctx, authenticator.assert(t, challengeFrom(t, options), 1))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func registerPasskey(t *testing.T, p *Passkeys, a *softwareAuthenticator, userID int64) {
+	ctx := context.Background()
+
+	options, err := p.BeginRegistration(ctx, userID)
+	require.NoError(t, err)
+
+	err = p.FinishRegistration(ctx, userID, a.create(t, challengeFrom(t, options)))
+	require.NoError(t, err)
+}
+
+func loginWithPasskey(t *testing.T, p *Passkeys, a *softwareAuthenticator, userID int64) (*domain.User, string) {
+	ctx := context.Background()
+
+	options, err := p.BeginLogin(ctx)
+	require.NoError(t, err)
+
+	user, token, err := p.PasskeyLogin(ctx, a.assert(t, challengeFrom(t, options), userID))
+	require.NoError(t, err)
+
+	return user, token
+}
+
+func challengeFrom(t *testing.T, options []byte) string {
+	var o struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	require.NoError(t, json.Unmarshal(options, &o))
+
+	return o.PublicKey.Challenge
+}
+
+func newTestPasskeys(t *testing.T) (*Passkeys, *fakeTokenStorage) {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "UniClubs",
+		RPOrigins:     []string{testOrigin},
+	})
+	require.NoError(t, err)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessions := &fakeTokenStorage{tokens: map[string]int64{}}
+	users := &fakeUserStorage{users: map[int64]*domain.User{
+		1: {ID: 1, Email: "student@astanait.edu.kz", FirstName: "Aru", LastName: "Student"},
+	}}
+
+	a := New(log, users, sessions, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, config.Phone{}, config.MFA{}, config.Login{})
+
+	return NewPasskeys(log, a, w, &fakeCredentialStorage{}, &fakeCeremonyStorage{data: map[string][]byte{}}, time.Minute), sessions
+}
+
+// softwareAuthenticator is a minimal WebAuthn authenticator using an ES256 key and
+// "none" attestation.
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+
+	return &softwareAuthenticator{key: key, credentialID: credentialID, origin: testOrigin}
+}
+
+func (a *softwareAuthenticator) create(t *testing.T, challenge string) []byte {
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	// flags: user present, user verified, attested credential data included
+	authData := a.authData(0x01 | 0x04 | 0x40)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    b64(a.clientData(t, "webauthn.create", challenge)),
+		"attestationObject": b64(attestationObject),
+	})
+}
+
+func (a *softwareAuthenticator) assert(t *testing.T, challenge string, userID int64) []byte {
+	a.signCount++
+
+	// flags: user present, user verified
+	authData := a.authData(0x01 | 0x04)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	userHandle := make([]byte, 8)
+	binary.BigEndian.PutUint64(userHandle, uint64(userID))
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(userHandle),
+	})
+}
+
+func (a *softwareAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, a.signCount)
+}
+
+func (a *softwareAuthenticator) clientData(t *testing.T, typ, challenge string) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    a.origin,
+	})
+	require.NoError(t, err)
+
+	return clientData
+}
+
+func (a *softwareAuthenticator) response(t *testing.T, response map[string]string) []byte {
+	body, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	require.NoError(t, err)
+
+	return body
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type fakeUserStorage struct {
+	UserStorage
+	users       map[int64]*domain.User
+	scopedRoles map[int64][]*domain.ScopedRole
+}
+
+func (s *fakeUserStorage) GetUserByID(_ context.Context, userID int64) (*domain.User, error) {
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, storage.ErrUserNotExists
+	}
+	copied := *user
+	return &copied, nil
+}
+
+type fakeTokenStorage struct {
+	tokens map[string]int64
+}
+
+func (s *fakeTokenStorage) Create(_ context.Context, token string, userID int64, _ time.Duration) error {
+	s.tokens[token] = userID
+	return nil
+}
+
+func (s *fakeTokenStorage) Get(_ context.Context, token string) (int64, error) {
+	userID, ok := s.tokens[token]
+	if !ok {
+		return 0, storage.ErrSessionNotExists
+	}
+	return userID, nil
+}
+
+func (s *fakeTokenStorage) Delete(_ context.Context, token string) error {
+	delete(s.tokens, token)
+	return nil
+}
+
+type fakeCredentialStorage struct {
+	creds []*domain.WebAuthnCredential
+}
+
+func (s *fakeCredentialStorage) SaveWebAuthnCredential(_ context.Context, cred *domain.WebAuthnCredential) error {
+	s.creds = append(s.creds, cred)
+	return nil
+}
+
+func (s *fakeCredentialStorage) GetWebAuthnCredentialsByUserID(_ context.Context, userID int64) ([]*domain.WebAuthnCredential, error) {
+	var creds []*domain.WebAuthnCredential
+	for _, cred := range s.creds {
+		if cred.UserID == userID {
+			creds = append(creds, cred)
+		}
+	}
+	return creds, nil
+}
+
+func (s *fakeCredentialStorage) UpdateWebAuthnCredentialUsage(_ context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	for _, cred := range s.creds {
+		if string(cred.CredentialID) == string(credentialID) {
+			cred.SignCount = signCount
+			cred.BackupState = backupState
+			return nil
+		}
+	}
+	return storage.ErrTokenNotExists
+}
+
+type fakeCeremonyStorage struct {
+	data map[string][]byte
+}
+
+func (s *fakeCeremonyStorage) SaveCeremony(_ context.Context, key string, data []byte, _ time.Duration) error {
+	s.data[key] = data
+	return nil
+}
+
+func (s *fakeCeremonyStorage) TakeCeremony(_ context.Context, key string) ([]byte, error) {
+	data, ok := s.data[key]
+	if !ok {
+		return nil, storage.ErrTokenNotExists
+	}
+	delete(s.data, key)
+	return data, nil
+}
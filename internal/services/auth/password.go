@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"log/slog"
+)
+
+// Authenticator verifies the password of a user. It returns ErrUserNotExist if it
+// does not know the user and ErrInvalidCredentials if the password is wrong, so
+// that Login can fall through to the next authenticator.
+type Authenticator interface {
+	VerifyPassword(ctx context.Context, email string, password string) (*domain.User, error)
+}
+
+// PasswordHasher hashes passwords and verifies them against stored hashes. Verify
+// reports whether a matching hash is outdated and should be replaced.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (ok bool, rehash bool, err error)
+}
+
+// PasswordAuthenticator checks passwords against the password hashes of the users
+// table. Outdated hashes are replaced once their password is verified.
+type PasswordAuthenticator struct {
+	log        *slog.Logger
+	usrStorage UserStorage
+	hasher     PasswordHasher
+}
+
+func NewPasswordAuthenticator(log *slog.Logger, usrStorage UserStorage, hasher PasswordHasher) *PasswordAuthenticator {
+	return &PasswordAuthenticator{
+		log:        log,
+		usrStorage: usrStorage,
+		hasher:     hasher,
+	}
+}
+
+func (p PasswordAuthenticator) VerifyPassword(ctx context.Context, email string, password string) (*domain.User, error) {
+	const op = "authService.PasswordAuthenticator.VerifyPassword"
+	log := p.log.With(slog.String("op", op))
+
+	user, err := p.usrStorage.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotExists) {
+			return nil, ErrUserNotExist
+		}
+		return nil, err
+	}
+
+	ok, rehash, err := p.hasher.Verify(user.PasswordHash, password)
+	if err != nil {
+		log.Error("failed to verify password hash", slog.Int64("user_id", user.ID), logger.Err(err))
+		return nil, ErrInvalidCredentials
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if rehash {
+		p.rehash(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+// rehash replaces the outdated password hash of the user. Failures are only logged,
+// the hash is replaced on a later login.
+func (p PasswordAuthenticator) rehash(ctx context.Context, user *domain.User, password string) {
+	const op = "authService.PasswordAuthenticator.rehash"
+	log := p.log.With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	hash, err := p.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to hash password", logger.Err(err))
+		return
+	}
+
+	err = p.usrStorage.RehashPassword(ctx, user.ID, user.PasswordHash, hash)
+	if err != nil {
+		log.Error("failed to save password hash", logger.Err(err))
+		return
+	}
+	user.PasswordHash = hash
+
+	log.Info("password hash upgraded")
+}
+
+// verifyPassword asks the authenticators in order and returns the user from the
+// first one that accepts the password. If none does, ErrInvalidCredentials is
+// returned when any of them knows the user, ErrUserNotExist otherwise.
+func (a Auth) verifyPassword(ctx context.Context, email string, password string) (*domain.User, error) {
+	result := ErrUserNotExist
+	for _, authenticator := range a.authenticators {
+		user, err := authenticator.VerifyPassword(ctx, email, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrInvalidCredentials):
+			result = ErrInvalidCredentials
+		case !errors.Is(err, ErrUserNotExist):
+			return nil, err
+		}
+	}
+
+	return nil, result
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPasswordAuthenticator_RehashesOutdatedHashes(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users := &fakePasswordStorage{users: map[string]*domain.User{
+		"student@astanait.edu.kz": {ID: 1, Email: "student@astanait.edu.kz", PasswordHash: legacy},
+	}}
+
+	h, err := hasher.New(hasher.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, nil)
+	require.NoError(t, err)
+	p := NewPasswordAuthenticator(log, users, h)
+
+	_, err = p.VerifyPassword(ctx, "student@astanait.edu.kz", "wrong-password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, legacy, users.users["student@astanait.edu.kz"].PasswordHash, "wrong passwords do not rehash")
+
+	user, err := p.VerifyPassword(ctx, "student@astanait.edu.kz", "secret-password")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), user.ID)
+	rehashed := users.users["student@astanait.edu.kz"].PasswordHash
+	assert.True(t, strings.HasPrefix(string(rehashed), "$argon2id$"), "bcrypt hashes are upgraded")
+
+	_, err = p.VerifyPassword(ctx, "student@astanait.edu.kz", "secret-password")
+	require.NoError(t, err)
+	assert.Equal(t, rehashed, users.users["student@astanait.edu.kz"].PasswordHash, "current hashes are kept")
+
+	_, err = p.VerifyPassword(ctx, "nobody@astanait.edu.kz", "secret-password")
+	assert.ErrorIs(t, err, ErrUserNotExist)
+}
+
+type fakePasswordStorage struct {
+	UserStorage
+	users map[string]*domain.User
+}
+
+func (s *fakePasswordStorage) GetUserByEmail(_ context.Context, email string) (*domain.User, error) {
+	user, ok := s.users[email]
+	if !ok {
+		return nil, storage.ErrUserNotExists
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *fakePasswordStorage) RehashPassword(_ context.Context, userID int64, oldHash []byte, newHash []byte) error {
+	for _, user := range s.users {
+		if user.ID == userID && string(user.PasswordHash) == string(oldHash) {
+			user.PasswordHash = newHash
+			return nil
+		}
+	}
+	return storage.ErrUserNotExists
+}
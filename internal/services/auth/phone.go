@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/phone"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/otp"
+	"log/slog"
+	"time"
+)
+
+const phoneOTPDigits = 6
+
+var (
+	ErrInvalidPhoneNumber       = errors.New("invalid phone number")
+	ErrPhoneOTPNotExists        = errors.New("phone verification code does not exists")
+	ErrInvalidPhoneOTP          = errors.New("invalid phone verification code")
+	ErrPhoneOTPAttemptsExceeded = errors.New("too many invalid phone verification attempts")
+	ErrTooManyRequests          = errors.New("too many requests")
+	ErrPhoneUnavailable         = errors.New("phone verification is not configured")
+)
+
+type PhoneOTPStorage interface {
+	CreatePhoneOTP(
+		ctx context.Context,
+		userID int64,
+		phoneNumber string,
+		codeHash string,
+		duration time.Duration,
+		resendInterval time.Duration,
+	) error
+	GetPhoneOTP(ctx context.Context, userID int64) (phoneNumber string, codeHash string, attempts int, err error)
+	IncrPhoneOTPAttempts(ctx context.Context, userID int64) (int, error)
+	DeletePhoneOTP(ctx context.Context, userID int64) error
+}
+
+// RequestPhoneVerification normalises phoneNumber to E.164 and sends a one-time code
+// to it. The number is stored on the user only after ConfirmPhoneVerification.
+// ErrPhoneUnavailable is returned while no OTP key is configured.
+func (a Auth) RequestPhoneVerification(ctx context.Context, userID int64, phoneNumber string) error {
+	const op = "authService.RequestPhoneVerification"
+	log := a.log.With(slog.String("op", op))
+
+	if a.phoneCfg.OTPKey == "" {
+		return fmt.Errorf("%s: %w", op, ErrPhoneUnavailable)
+	}
+
+	number, err := phone.Normalize(phoneNumber, a.phoneCfg.DefaultCountryCode, a.phoneCfg.TrunkPrefix)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, ErrInvalidPhoneNumber)
+	}
+
+	user, err := a.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Error("user does not exists", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	code, err := otp.GenerateCode(phoneOTPDigits)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.phoneOTPStorage.CreatePhoneOTP(ctx, user.ID, number, a.hashOTP(code), a.phoneCfg.OTPTTL, a.phoneCfg.OTPResendInterval)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTooManyRequests):
+			log.Info("verification code requested too often", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrTooManyRequests)
+		default:
+			log.Error("can not save verification code", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	msg := struct {
+		FirstName   string `json:"first_name"`
+		PhoneNumber string `json:"phone_number"`
+		Code        string `json:"code"`
+	}{
+		FirstName:   user.FirstName,
+		PhoneNumber: number,
+		Code:        code,
+	}
+
+	err = a.amqp.Publish(ctx, "user.notification.phone_otp", msg)
+	if err != nil {
+		log.Error("failed to publish", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConfirmPhoneVerification checks the code sent by RequestPhoneVerification and, if it
+// matches, stores the phone number as verified. The pending code is discarded after
+// the configured number of invalid attempts.
+func (a Auth) ConfirmPhoneVerification(ctx context.Context, userID int64, code string) error {
+	const op = "authService.ConfirmPhoneVerification"
+	log := a.log.With(slog.String("op", op))
+
+	if a.phoneCfg.OTPKey == "" {
+		return fmt.Errorf("%s: %w", op, ErrPhoneUnavailable)
+	}
+
+	number, codeHash, attempts, err := a.phoneOTPStorage.GetPhoneOTP(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTokenNotExists):
+			return fmt.Errorf("%s: %w", op, ErrPhoneOTPNotExists)
+		default:
+			log.Error("failed to get verification code", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if attempts >= a.phoneCfg.OTPMaxAttempts {
+		a.deletePhoneOTP(ctx, log, userID)
+		return fmt.Errorf("%s: %w", op, ErrPhoneOTPAttemptsExceeded)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(a.hashOTP(code)), []byte(codeHash)) != 1 {
+		attempts, err = a.phoneOTPStorage.IncrPhoneOTPAttempts(ctx, userID)
+		if err != nil {
+			log.Error("failed to record verification attempt", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if attempts >= a.phoneCfg.OTPMaxAttempts {
+			a.deletePhoneOTP(ctx, log, userID)
+			return fmt.Errorf("%s: %w", op, ErrPhoneOTPAttemptsExceeded)
+		}
+		return fmt.Errorf("%s: %w", op, ErrInvalidPhoneOTP)
+	}
+
+	err = a.usrStorage.SetPhoneVerified(ctx, userID, number)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Error("user does not exists", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to set phone number", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	a.deletePhoneOTP(ctx, log, userID)
+
+	return nil
+}
+
+func (a Auth) deletePhoneOTP(ctx context.Context, log *slog.Logger, userID int64) {
+	err := a.phoneOTPStorage.DeletePhoneOTP(ctx, userID)
+	if err != nil {
+		log.Error("failed to delete verification code", logger.Err(err))
+	}
+}
+
+// hashOTP returns the HMAC-SHA256 of the code keyed with the OTP key. A plain hash
+// of a 6 digit code is reversed by trying all of them, the key keeps the codes
+// secret from anyone reading redis without it.
+func (a Auth) hashOTP(code string) string {
+	mac := hmac.New(sha256.New, []byte(a.phoneCfg.OTPKey))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/session"
+	"github.com/coreos/go-oidc/v3/oidc"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"golang.org/x/oauth2"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSSOStateNotExists   = errors.New("sso login does not exists or has expired")
+	ErrSSOFailed           = errors.New("identity provider rejected the login")
+	ErrSSOMissingClaims    = errors.New("identity provider did not return the required claims")
+	ErrSSOEmailNotVerified = errors.New("the identity provider did not verify the email")
+	// ErrSSORegistrationDenied is returned when a user without an account is not
+	// allowed to register by the registration policy.
+	ErrSSORegistrationDenied = errors.New("registration is not allowed for this account")
+)
+
+// SSO implements login through an external OpenID Connect identity provider with
+// the authorization code flow and PKCE. Users are matched by their linked identity,
+// then by a verified email; unknown users are provisioned as activated users.
+// Sessions are issued by the wrapped Auth, so two-factor authentication still
+// applies.
+type SSO struct {
+	log        *slog.Logger
+	auth       *Auth
+	oauth2     oauth2.Config
+	verifier   *oidc.IDTokenVerifier
+	identities IdentityStorage
+	ceremonies CeremonyStorage
+	cfg        config.SSO
+}
+
+type IdentityStorage interface {
+	SaveIdentity(ctx context.Context, identity *domain.Identity) error
+	GetUserIDByIdentity(ctx context.Context, issuer string, subject string) (int64, error)
+}
+
+// ssoState is kept between the redirect to the identity provider and the callback.
+type ssoState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// ssoClaims are the ID token claims mapped onto a user.
+type ssoClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+// NewSSO discovers the configuration of the identity provider at cfg.IssuerURL. The
+// keys of the provider are fetched with ctx later on, so it must not be canceled
+// while the service is in use.
+func NewSSO(
+	ctx context.Context,
+	log *slog.Logger,
+	auth *Auth,
+	identities IdentityStorage,
+	ceremonies CeremonyStorage,
+	cfg config.SSO,
+) (*SSO, error) {
+	const op = "authService.NewSSO"
+
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &SSO{
+		log:  log,
+		auth: auth,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		},
+		verifier:   provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		identities: identities,
+		ceremonies: ceremonies,
+		cfg:        cfg,
+	}, nil
+}
+
+// BeginSSO starts a login and returns the URL of the identity provider to redirect
+// the user to, and the state the callback must present.
+func (s SSO) BeginSSO(ctx context.Context) (authURL string, state string, err error) {
+	const op = "authService.SSO.BeginSSO"
+	log := s.log.With(slog.String("op", op))
+
+	state, err = session.GenerateToken()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	nonce, err := session.GenerateToken()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	data, err := json.Marshal(ssoState{Nonce: nonce, Verifier: verifier})
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.ceremonies.SaveCeremony(ctx, state, data, s.cfg.StateTTL)
+	if err != nil {
+		log.Error("can not save sso state", logger.Err(err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), state, nil
+}
+
+// FinishSSO exchanges the code returned by the identity provider, validates the ID
+// token and returns the user with a new session token. Like Login, users with
+// two-factor authentication get an MFA challenge and an error wrapping
+// ErrMFARequired instead of a session.
+func (s SSO) FinishSSO(ctx context.Context, state string, code string) (*domain.User, string, error) {
+	const op = "authService.SSO.FinishSSO"
+	log := s.log.With(slog.String("op", op))
+
+	st, err := s.takeState(ctx, state)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	oauth2Token, err := s.oauth2.Exchange(ctx, code, oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		log.Warn("failed to exchange code", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, ErrSSOFailed)
+	}
+
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		log.Warn("token response has no id token")
+		return nil, "", fmt.Errorf("%s: %w", op, ErrSSOFailed)
+	}
+
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Warn("invalid id token", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, ErrSSOFailed)
+	}
+	if idToken.Nonce != st.Nonce {
+		log.Warn("id token nonce mismatch")
+		return nil, "", fmt.Errorf("%s: %w", op, ErrSSOFailed)
+	}
+
+	user, err := s.resolveUser(ctx, log, idToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessionToken, err := s.auth.startSession(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMFARequired):
+			return user, sessionToken, fmt.Errorf("%s: %w", op, err)
+		case errors.Is(err, ErrTooManyAttempts):
+			log.Info("mfa is locked out", slog.Int64("user_id", user.ID))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		log.Error("can not start session", logger.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, sessionToken, nil
+}
+
+// resolveUser returns the user linked to the external account, linking an existing
+// user with the same verified email or provisioning a new one if there is none.
+// Users are only provisioned with a verified email the registration policy allows.
+func (s SSO) resolveUser(ctx context.Context, log *slog.Logger, idToken *oidc.IDToken) (*domain.User, error) {
+	var claims ssoClaims
+	var raw map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if err := idToken.Claims(&raw); err != nil {
+		return nil, err
+	}
+
+	var user *domain.User
+	err := s.auth.usrStorage.WithTx(ctx, func(ctx context.Context) error {
+		userID, err := s.identities.GetUserIDByIdentity(ctx, idToken.Issuer, idToken.Subject)
+		switch {
+		case err == nil:
+			user, err = s.auth.usrStorage.GetUserByID(ctx, userID)
+			return err
+		case !errors.Is(err, storage.ErrIdentityNotExists):
+			return err
+		}
+
+		if claims.Email == "" {
+			return ErrSSOMissingClaims
+		}
+
+		if !claims.EmailVerified {
+			return ErrSSOEmailNotVerified
+		}
+
+		user, err = s.auth.usrStorage.GetUserByEmail(ctx, claims.Email)
+		switch {
+		case err == nil:
+			log.Info("linking identity to existing user", slog.Int64("user_id", user.ID))
+		case errors.Is(err, storage.ErrUserNotExists):
+			user, err = s.provisionUser(ctx, claims, raw)
+			if err != nil {
+				return err
+			}
+			log.Info("provisioned user", slog.Int64("user_id", user.ID))
+		default:
+			return err
+		}
+
+		return s.identities.SaveIdentity(ctx, &domain.Identity{
+			UserID:  user.ID,
+			Issuer:  idToken.Issuer,
+			Subject: idToken.Subject,
+			Email:   claims.Email,
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSSOMissingClaims), errors.Is(err, ErrSSOEmailNotVerified):
+			return nil, err
+		case errors.Is(err, ErrSSORegistrationDenied):
+			log.Info("registration denied by policy", logger.Err(err))
+			return nil, err
+		case errors.Is(err, storage.ErrUserExists):
+			return nil, ErrUserExists
+		default:
+			log.Error("failed to resolve user", logger.Err(err))
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// provisionUser creates an activated user from the ID token claims. The user has
+// no password and can only log in through the identity provider until one is set.
+// The registration policy applies as it does to Register, and since there is no
+// invitation code to redeem, nobody is provisioned in invite only mode.
+func (s SSO) provisionUser(ctx context.Context, claims ssoClaims, raw map[string]any) (*domain.User, error) {
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+
+	barcode := claimString(raw[s.cfg.BarcodeClaim])
+	if barcode == "" || firstName == "" {
+		return nil, ErrSSOMissingClaims
+	}
+
+	if s.auth.registration.InviteOnly() {
+		return nil, fmt.Errorf("%w: %w", ErrSSORegistrationDenied, ErrInvitationRequired)
+	}
+	err := s.auth.registration.Check(claims.Email, barcode)
+	if err != nil {
+		var errs validation.Errors
+		if errors.As(err, &errs) {
+			return nil, fmt.Errorf("%w: %w", ErrSSORegistrationDenied, err)
+		}
+		return nil, err
+	}
+
+	user := &domain.User{
+		Email:        claims.Email,
+		PasswordHash: []byte{},
+		FirstName:    firstName,
+		LastName:     lastName,
+		Barcode:      barcode,
+		Activated:    true,
+	}
+
+	err = s.auth.usrStorage.SaveUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.auth.usrStorage.ActivateUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.auth.usrStorage.GetUserByID(ctx, user.ID)
+}
+
+func (s SSO) takeState(ctx context.Context, state string) (*ssoState, error) {
+	data, err := s.ceremonies.TakeCeremony(ctx, state)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotExists) {
+			return nil, ErrSSOStateNotExists
+		}
+		s.log.Error("failed to get sso state", logger.Err(err))
+		return nil, err
+	}
+
+	var st ssoState
+	err = json.Unmarshal(data, &st)
+	if err != nil {
+		return nil, err
+	}
+
+	return &st, nil
+}
+
+// claimString formats a string or numeric claim, identity providers differ in how
+// they encode identifiers.
+func claimString(claim any) string {
+	switch v := claim.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSSOClientID = "uniclubs"
+
+func TestSSO_ProvisionsAndLinksUser(t *testing.T) {
+	ctx := context.Background()
+	issuer := newMockIssuer(t)
+	sso, users, identities, sessions := newTestSSO(t, issuer)
+
+	claims := jwt.MapClaims{
+		"sub":            "s-100",
+		"email":          "new@astanait.edu.kz",
+		"email_verified": true,
+		"given_name":     "Dana",
+		"family_name":    "New",
+		"student_id":     float64(220100),
+	}
+
+	user, token, err := ssoLogin(t, sso, issuer, claims)
+	require.NoError(t, err)
+	assert.Equal(t, "new@astanait.edu.kz", user.Email)
+	assert.Equal(t, "Dana", user.FirstName)
+	assert.Equal(t, "New", user.LastName)
+	assert.Equal(t, "220100", user.Barcode)
+	assert.True(t, users.users[user.ID].Activated, "provisioned user must be activated")
+	assert.Equal(t, user.ID, sessions.tokens[token])
+	require.Len(t, identities.identities, 1)
+	assert.Equal(t, issuer.URL, identities.identities[0].Issuer)
+	assert.Equal(t, "s-100", identities.identities[0].Subject)
+
+	again, _, err := ssoLogin(t, sso, issuer, claims)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Len(t, users.users, 2, "linked user must not be provisioned again")
+	assert.Len(t, identities.identities, 1)
+
+	_, _, err = sso.FinishSSO(ctx, "unknown-state", "code")
+	assert.ErrorIs(t, err, ErrSSOStateNotExists)
+}
+
+func TestSSO_LinksExistingUserOnlyWithVerifiedEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	sso, users, identities, _ := newTestSSO(t, issuer)
+
+	claims := jwt.MapClaims{
+		"sub":        "s-1",
+		"email":      "student@astanait.edu.kz",
+		"given_name": "Aru",
+		"student_id": "210001",
+	}
+
+	_, _, err := ssoLogin(t, sso, issuer, claims)
+	assert.ErrorIs(t, err, ErrSSOEmailNotVerified)
+	assert.Empty(t, identities.identities)
+
+	claims["email_verified"] = true
+	user, _, err := ssoLogin(t, sso, issuer, claims)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), user.ID)
+	assert.Len(t, users.users, 1)
+	require.Len(t, identities.identities, 1)
+	assert.Equal(t, int64(1), identities.identities[0].UserID)
+}
+
+func TestSSO_ProvisionsOnlyVerifiedAllowedUsers(t *testing.T) {
+	issuer := newMockIssuer(t)
+	sso, users, identities, _ := newTestSSO(t, issuer)
+	policy := sso.auth.registration.(*fakeRegistrationPolicy)
+
+	claims := jwt.MapClaims{
+		"sub":        "s-200",
+		"email":      "new@astanait.edu.kz",
+		"given_name": "Dana",
+		"student_id": "220200",
+	}
+
+	_, _, err := ssoLogin(t, sso, issuer, claims)
+	assert.ErrorIs(t, err, ErrSSOEmailNotVerified)
+
+	claims["email_verified"] = true
+	policy.deniedDomain = "astanait.edu.kz"
+	_, _, err = ssoLogin(t, sso, issuer, claims)
+	assert.ErrorIs(t, err, ErrSSORegistrationDenied)
+
+	policy.deniedDomain = ""
+	policy.inviteOnly = true
+	_, _, err = ssoLogin(t, sso, issuer, claims)
+	assert.ErrorIs(t, err, ErrSSORegistrationDenied)
+	assert.Len(t, users.users, 1, "denied users must not be provisioned")
+	assert.Empty(t, identities.identities)
+
+	// existing users are linked in invite only mode too
+	claims["email"] = "student@astanait.edu.kz"
+	user, _, err := ssoLogin(t, sso, issuer, claims)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), user.ID)
+}
+
+func TestSSO_RejectsInvalidIDToken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	sso, _, _, _ := newTestSSO(t, issuer)
+
+	claims := jwt.MapClaims{"sub": "s-1", "email": "x@astanait.edu.kz", "student_id": "1", "given_name": "X"}
+
+	issuer.nonce = "another-nonce"
+	_, _, err := ssoLogin(t, sso, issuer, claims)
+	assert.ErrorIs(t, err, ErrSSOFailed)
+
+	issuer.nonce = ""
+	issuer.audience = "another-client"
+	_, _, err = ssoLogin(t, sso, issuer, claims)
+	assert.ErrorIs(t, err, ErrSSOFailed)
+}
+
+// ssoLogin runs the flow against the mock issuer: the user is redirected to the
+// issuer, authenticates as claims and comes back with a code.
+func ssoLogin(t *testing.T, sso *SSO, issuer *mockIssuer, claims jwt.MapClaims) (*domain.User, string, error) {
+	ctx := context.Background()
+
+	authURL, state, err := sso.BeginSSO(ctx)
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, state, u.Query().Get("state"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+
+	code := issuer.authorize(u.Query(), claims)
+
+	return sso.FinishSSO(ctx, state, code)
+}
+
+func newTestSSO(t *testing.T, issuer *mockIssuer) (*SSO, *fakeUserStorage, *fakeIdentityStorage, *fakeTokenStorage) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessions := &fakeTokenStorage{tokens: map[string]int64{}}
+	users := &fakeUserStorage{users: map[int64]*domain.User{
+		1: {ID: 1, Email: "student@astanait.edu.kz", FirstName: "Aru", LastName: "Student", Activated: true},
+	}}
+	identities := &fakeIdentityStorage{}
+
+	a := New(log, users, sessions, nil, nil, nil, nil, fakeMFA{}, nil, nil, nil, nil, &fakeRegistrationPolicy{}, nil, nil, nil, nil, config.Phone{}, config.MFA{}, config.Login{})
+
+	sso, err := NewSSO(context.Background(), log, a, identities, &fakeCeremonyStorage{data: map[string][]byte{}}, config.SSO{
+		IssuerURL:    issuer.URL,
+		ClientID:     testSSOClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/sso/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		BarcodeClaim: "student_id",
+		StateTTL:     time.Minute,
+	})
+	require.NoError(t, err)
+
+	return sso, users, identities, sessions
+}
+
+// mockIssuer is a minimal OpenID Connect identity provider signing ID tokens with
+// RS256.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// nonce and audience override the values put into ID tokens when set.
+	nonce    string
+	audience string
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockIssuer{key: key, codes: map[string]mockCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+func (m *mockIssuer) authorize(query url.Values, claims jwt.MapClaims) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	issued := jwt.MapClaims{}
+	for k, v := range claims {
+		issued[k] = v
+	}
+	issued["nonce"] = query.Get("nonce")
+
+	code := "code-" + query.Get("state")
+	m.codes[code] = mockCode{challenge: query.Get("code_challenge"), claims: issued}
+
+	return code
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	code, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := code.claims
+	claims["iss"] = m.URL
+	claims["aud"] = testSSOClientID
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	if m.nonce != "" {
+		claims["nonce"] = m.nonce
+	}
+	if m.audience != "" {
+		claims["aud"] = m.audience
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	})
+}
+
+func (s *fakeUserStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (s *fakeUserStorage) GetUserByEmail(_ context.Context, email string) (*domain.User, error) {
+	for _, user := range s.users {
+		if user.Email == email && user.Activated {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, storage.ErrUserNotExists
+}
+
+func (s *fakeUserStorage) SaveUser(_ context.Context, user *domain.User) error {
+	for _, u := range s.users {
+		if u.Email == user.Email || u.Barcode == user.Barcode {
+			return storage.ErrUserExists
+		}
+	}
+	user.ID = int64(len(s.users) + 1)
+	copied := *user
+	copied.Activated = false
+	s.users[user.ID] = &copied
+	return nil
+}
+
+func (s *fakeUserStorage) ActivateUser(_ context.Context, userID int64) error {
+	s.users[userID].Activated = true
+	return nil
+}
+
+type fakeIdentityStorage struct {
+	identities []*domain.Identity
+}
+
+func (s *fakeIdentityStorage) SaveIdentity(_ context.Context, identity *domain.Identity) error {
+	for _, i := range s.identities {
+		if i.Issuer == identity.Issuer && i.Subject == identity.Subject {
+			return storage.ErrIdentityExists
+		}
+	}
+	s.identities = append(s.identities, identity)
+	return nil
+}
+
+func (s *fakeIdentityStorage) GetUserIDByIdentity(_ context.Context, issuer string, subject string) (int64, error) {
+	for _, i := range s.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			return i.UserID, nil
+		}
+	}
+	return 0, storage.ErrIdentityNotExists
+}
+
+type fakeRegistrationPolicy struct {
+	deniedDomain string
+	inviteOnly   bool
+}
+
+func (p *fakeRegistrationPolicy) Check(email string, _ string) error {
+	if p.deniedDomain != "" && strings.HasSuffix(email, "@"+p.deniedDomain) {
+		return validation.Errors{"email": errors.New("email domain is not allowed")}
+	}
+	return nil
+}
+
+func (p *fakeRegistrationPolicy) InviteOnly() bool {
+	return p.inviteOnly
+}
+
+type fakeMFA struct{}
+
+func (fakeMFA) IsEnabled(context.Context, int64) (bool, error) { return false, nil }
+
+func (fakeMFA) Verify(context.Context, int64, string) error { return nil }
@@ -0,0 +1,183 @@
+package invitation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/invite"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvitationNotExists = errors.New("invitation does not exist")
+	ErrInvitationRevoked   = errors.New("invitation has been revoked")
+	ErrInvitationExpired   = errors.New("invitation has expired")
+	ErrInvitationUsedUp    = errors.New("invitation has been used up")
+	ErrEmailMismatch       = errors.New("invitation is for another email")
+)
+
+// Invitations manages the invitation codes people register with while
+// registration is invite only.
+type Invitations struct {
+	log     *slog.Logger
+	storage Storage
+}
+
+type Storage interface {
+	SaveInvitation(ctx context.Context, invitation *domain.Invitation) error
+	GetInvitationByCodeHash(ctx context.Context, codeHash []byte) (*domain.Invitation, error)
+	GetInvitations(ctx context.Context) ([]*domain.Invitation, error)
+	UseInvitation(ctx context.Context, invitationID int64) error
+	RevokeInvitation(ctx context.Context, invitationID int64) error
+}
+
+func New(log *slog.Logger, storage Storage) *Invitations {
+	return &Invitations{
+		log:     log,
+		storage: storage,
+	}
+}
+
+// CreateInvitation saves the invitation and returns its code. The code is not stored
+// and can not be shown again.
+func (i Invitations) CreateInvitation(ctx context.Context, invitation *domain.Invitation) (string, error) {
+	const op = "invitations.CreateInvitation"
+	log := i.log.With(slog.String("op", op))
+
+	invitation.Email = strings.ToLower(strings.TrimSpace(invitation.Email))
+	err := validation.Errors{
+		"email":      validation.Validate(invitation.Email, is.Email),
+		"role":       validation.Validate(invitation.Role, validation.In(toAny(domain.Roles)...)),
+		"max_uses":   validation.Validate(invitation.MaxUses, validation.Required, validation.Min(1)),
+		"expires_at": validation.Validate(invitation.ExpiresAt, validation.By(inFuture)),
+	}.Filter()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := invite.Generate()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	invitation.CodeHash = invite.Hash(code)
+
+	err = i.storage.SaveInvitation(ctx, invitation)
+	if err != nil {
+		log.Error("failed to save invitation", logger.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("invitation created",
+		slog.Int64("invitation_id", invitation.ID),
+		slog.Int64("created_by", invitation.CreatedBy),
+		slog.Int("max_uses", invitation.MaxUses),
+	)
+
+	return code, nil
+}
+
+// ListInvitations returns all the invitations, the most recent first.
+func (i Invitations) ListInvitations(ctx context.Context) ([]*domain.Invitation, error) {
+	const op = "invitations.ListInvitations"
+	log := i.log.With(slog.String("op", op))
+
+	invitations, err := i.storage.GetInvitations(ctx)
+	if err != nil {
+		log.Error("failed to get invitations", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return invitations, nil
+}
+
+func (i Invitations) RevokeInvitation(ctx context.Context, invitationID int64) error {
+	const op = "invitations.RevokeInvitation"
+	log := i.log.With(slog.String("op", op))
+
+	err := i.storage.RevokeInvitation(ctx, invitationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvitationNotExists):
+			return fmt.Errorf("%s: %w", op, ErrInvitationNotExists)
+		default:
+			log.Error("failed to revoke invitation", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("invitation revoked", slog.Int64("invitation_id", invitationID))
+
+	return nil
+}
+
+// Redeem counts a use of the invitation with the code for a registration with email
+// and returns the invitation. It should run in the transaction saving the user, so
+// that failed registrations do not use up the invitation. Codes that can not be used
+// are reported as validation.Errors for "invite_code".
+func (i Invitations) Redeem(ctx context.Context, code string, email string) (*domain.Invitation, error) {
+	const op = "invitations.Redeem"
+	log := i.log.With(slog.String("op", op))
+
+	invitation, err := i.storage.GetInvitationByCodeHash(ctx, invite.Hash(code))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvitationNotExists):
+			return nil, fmt.Errorf("%s: %w", op, invalidCode(ErrInvitationNotExists))
+		default:
+			log.Error("failed to get invitation", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	switch {
+	case invitation.RevokedAt != nil:
+		return nil, fmt.Errorf("%s: %w", op, invalidCode(ErrInvitationRevoked))
+	case invitation.Expired(time.Now()):
+		return nil, fmt.Errorf("%s: %w", op, invalidCode(ErrInvitationExpired))
+	case invitation.UsedUp():
+		return nil, fmt.Errorf("%s: %w", op, invalidCode(ErrInvitationUsedUp))
+	case invitation.Email != "" && !strings.EqualFold(invitation.Email, strings.TrimSpace(email)):
+		return nil, fmt.Errorf("%s: %w", op, invalidCode(ErrEmailMismatch))
+	}
+
+	err = i.storage.UseInvitation(ctx, invitation.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvitationUsedUp):
+			return nil, fmt.Errorf("%s: %w", op, invalidCode(ErrInvitationUsedUp))
+		default:
+			log.Error("failed to use invitation", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	invitation.Uses++
+
+	return invitation, nil
+}
+
+func invalidCode(err error) validation.Errors {
+	return validation.Errors{"invite_code": err}
+}
+
+func inFuture(value any) error {
+	expiresAt, _ := value.(*time.Time)
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errors.New("must be in the future")
+	}
+	return nil
+}
+
+func toAny[T any](values []T) []any {
+	res := make([]any, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
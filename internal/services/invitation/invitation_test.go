@@ -0,0 +1,122 @@
+package invitation
+
+import (
+	"bytes"
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvitations_Redeem(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeStorage{}
+	i := New(slog.New(slog.NewTextHandler(io.Discard, nil)), s)
+
+	single, err := i.CreateInvitation(ctx, &domain.Invitation{MaxUses: 1, Role: domain.RoleModer})
+	require.NoError(t, err)
+	bound, err := i.CreateInvitation(ctx, &domain.Invitation{MaxUses: 5, Email: " Student@Astanait.edu.kz"})
+	require.NoError(t, err)
+	revoked, err := i.CreateInvitation(ctx, &domain.Invitation{MaxUses: 5})
+	require.NoError(t, err)
+	require.NoError(t, i.RevokeInvitation(ctx, 3))
+	expired, err := i.CreateInvitation(ctx, &domain.Invitation{MaxUses: 5})
+	require.NoError(t, err)
+	s.invitations[3].ExpiresAt = &time.Time{}
+
+	invitation, err := i.Redeem(ctx, strings.ToLower(single), "someone@example.com")
+	require.NoError(t, err, "codes are case insensitive")
+	assert.Equal(t, domain.RoleModer, invitation.Role)
+
+	invitation, err = i.Redeem(ctx, bound, "student@astanait.edu.kz")
+	require.NoError(t, err)
+	assert.Equal(t, 1, invitation.Uses)
+
+	tests := []struct {
+		name    string
+		code    string
+		email   string
+		wantErr error
+	}{
+		{name: "used up", code: single, email: "other@example.com", wantErr: ErrInvitationUsedUp},
+		{name: "other email", code: bound, email: "other@astanait.edu.kz", wantErr: ErrEmailMismatch},
+		{name: "revoked", code: revoked, email: "someone@example.com", wantErr: ErrInvitationRevoked},
+		{name: "expired", code: expired, email: "someone@example.com", wantErr: ErrInvitationExpired},
+		{name: "unknown code", code: "AAAA-BBBB-CCCC", email: "someone@example.com", wantErr: ErrInvitationNotExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := i.Redeem(ctx, tt.code, tt.email)
+			var errs validation.Errors
+			require.ErrorAs(t, err, &errs)
+			assert.ErrorIs(t, errs["invite_code"], tt.wantErr)
+		})
+	}
+}
+
+func TestInvitations_CreateInvitation_Invalid(t *testing.T) {
+	i := New(slog.New(slog.NewTextHandler(io.Discard, nil)), &fakeStorage{})
+	past := time.Now().Add(-time.Hour)
+
+	_, err := i.CreateInvitation(context.Background(), &domain.Invitation{
+		MaxUses:   0,
+		Email:     "not an email",
+		Role:      "OWNER",
+		ExpiresAt: &past,
+	})
+
+	var errs validation.Errors
+	require.ErrorAs(t, err, &errs)
+	assert.Len(t, errs, 4)
+}
+
+type fakeStorage struct {
+	invitations []*domain.Invitation
+}
+
+func (s *fakeStorage) SaveInvitation(_ context.Context, invitation *domain.Invitation) error {
+	invitation.ID = int64(len(s.invitations) + 1)
+	invitation.CreatedAt = time.Now()
+	s.invitations = append(s.invitations, invitation)
+	return nil
+}
+
+func (s *fakeStorage) GetInvitationByCodeHash(_ context.Context, codeHash []byte) (*domain.Invitation, error) {
+	for _, invitation := range s.invitations {
+		if bytes.Equal(invitation.CodeHash, codeHash) {
+			copied := *invitation
+			return &copied, nil
+		}
+	}
+	return nil, storage.ErrInvitationNotExists
+}
+
+func (s *fakeStorage) GetInvitations(_ context.Context) ([]*domain.Invitation, error) {
+	return s.invitations, nil
+}
+
+func (s *fakeStorage) UseInvitation(_ context.Context, invitationID int64) error {
+	invitation := s.invitations[invitationID-1]
+	if invitation.UsedUp() {
+		return storage.ErrInvitationUsedUp
+	}
+	invitation.Uses++
+	return nil
+}
+
+func (s *fakeStorage) RevokeInvitation(_ context.Context, invitationID int64) error {
+	if invitationID > int64(len(s.invitations)) {
+		return storage.ErrInvitationNotExists
+	}
+	now := time.Now()
+	s.invitations[invitationID-1].RevokedAt = &now
+	return nil
+}
@@ -0,0 +1,310 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	ldapv3 "github.com/go-ldap/ldap/v3"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrMissingAttributes = errors.New("ldap entry is missing required attributes")
+
+// identityIssuer is the issuer of the identities linking directory entries to the
+// users provisioned for them. The subject is the DN of the entry.
+const identityIssuer = "ldap"
+
+// Authenticator verifies passwords with an LDAP bind. The user is looked up with
+// the service account, then bound to with the password. Users that log in for the
+// first time are provisioned as activated users and linked to their directory
+// entry, and the role of linked users is kept in sync with their groups on every
+// login. An entry is never linked to an existing local account.
+type Authenticator struct {
+	log         *slog.Logger
+	usrStorage  UserStorage
+	identities  IdentityStorage
+	dial        func() (Conn, error)
+	groupRoles  []groupRole
+	defaultRole domain.Role
+	cfg         config.LDAP
+}
+
+type groupRole struct {
+	group string
+	role  domain.Role
+}
+
+// Conn is the part of an LDAP connection used by the Authenticator.
+type Conn interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldapv3.SearchRequest) (*ldapv3.SearchResult, error)
+	Close() error
+}
+
+type UserStorage interface {
+	SaveUser(ctx context.Context, user *domain.User) error
+	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
+	ActivateUser(ctx context.Context, userID int64) error
+	SetUserRole(ctx context.Context, userID int64, role domain.Role) error
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type IdentityStorage interface {
+	SaveIdentity(ctx context.Context, identity *domain.Identity) error
+	GetUserIDByIdentity(ctx context.Context, issuer string, subject string) (int64, error)
+}
+
+// New returns an error if a role in the config is unknown.
+func New(log *slog.Logger, usrStorage UserStorage, identities IdentityStorage, cfg config.LDAP) (*Authenticator, error) {
+	defaultRole, err := domain.ParseRole(cfg.DefaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default role: %w", err)
+	}
+
+	groupRoles := make([]groupRole, 0, len(cfg.GroupRoles))
+	for _, gr := range cfg.GroupRoles {
+		role, err := domain.ParseRole(gr.Role)
+		if err != nil {
+			return nil, fmt.Errorf("invalid role of group %q: %w", gr.Group, err)
+		}
+		groupRoles = append(groupRoles, groupRole{group: gr.Group, role: role})
+	}
+
+	a := &Authenticator{
+		log:         log,
+		usrStorage:  usrStorage,
+		identities:  identities,
+		groupRoles:  groupRoles,
+		defaultRole: defaultRole,
+		cfg:         cfg,
+	}
+	a.dial = a.dialURL
+
+	return a, nil
+}
+
+func (a *Authenticator) dialURL() (Conn, error) {
+	conn, err := ldapv3.DialURL(a.cfg.URL, ldapv3.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		u, err := url.Parse(a.cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// entry is a user found in the directory.
+type entry struct {
+	dn        string
+	email     string
+	firstName string
+	lastName  string
+	barcode   string
+	role      domain.Role
+}
+
+func (a *Authenticator) VerifyPassword(ctx context.Context, email string, password string) (*domain.User, error) {
+	const op = "ldap.VerifyPassword"
+	log := a.log.With(slog.String("op", op))
+
+	// an empty password would make an unauthenticated bind, which succeeds
+	if password == "" {
+		return nil, fmt.Errorf("%s: %w", op, auth.ErrInvalidCredentials)
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		log.Error("failed to connect to ldap", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	e, err := a.search(conn, email)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = conn.Bind(e.dn, password)
+	if err != nil {
+		if ldapv3.IsErrorWithCode(err, ldapv3.LDAPResultInvalidCredentials) {
+			return nil, fmt.Errorf("%s: %w", op, auth.ErrInvalidCredentials)
+		}
+		log.Error("failed to bind as user", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.syncUser(ctx, log, e)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// search finds the single directory entry of the user.
+func (a *Authenticator) search(conn Conn, email string) (*entry, error) {
+	if a.cfg.BindDN != "" {
+		err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind service account: %w", err)
+		}
+	}
+
+	attrs := a.cfg.Attributes
+	res, err := conn.Search(ldapv3.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldapv3.ScopeWholeSubtree,
+		ldapv3.NeverDerefAliases,
+		2,
+		int(a.cfg.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(a.cfg.UserFilter, ldapv3.EscapeFilter(email)),
+		[]string{attrs.Email, attrs.FirstName, attrs.LastName, attrs.Barcode, attrs.Groups},
+		nil,
+	))
+	if err != nil {
+		if ldapv3.IsErrorWithCode(err, ldapv3.LDAPResultNoSuchObject) {
+			return nil, auth.ErrUserNotExist
+		}
+		return nil, fmt.Errorf("failed to search user: %w", err)
+	}
+
+	switch len(res.Entries) {
+	case 0:
+		return nil, auth.ErrUserNotExist
+	case 1:
+	default:
+		return nil, fmt.Errorf("user filter matched %d entries", len(res.Entries))
+	}
+
+	e := res.Entries[0]
+	found := &entry{
+		dn:        e.DN,
+		email:     e.GetAttributeValue(attrs.Email),
+		firstName: e.GetAttributeValue(attrs.FirstName),
+		lastName:  e.GetAttributeValue(attrs.LastName),
+		barcode:   e.GetAttributeValue(attrs.Barcode),
+		role:      a.role(e.GetAttributeValues(attrs.Groups)),
+	}
+	if found.email == "" {
+		found.email = email
+	}
+
+	return found, nil
+}
+
+// role returns the role of the first configured group the user is a member of.
+func (a *Authenticator) role(groups []string) domain.Role {
+	for _, gr := range a.groupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, gr.group) {
+				return gr.role
+			}
+		}
+	}
+
+	return a.defaultRole
+}
+
+// syncUser returns the user linked to the directory entry, provisioning it on the
+// first login and updating its role when the groups have changed. If a local
+// account with the email or barcode of the entry exists, it is not linked and
+// ErrInvalidCredentials is returned.
+func (a *Authenticator) syncUser(ctx context.Context, log *slog.Logger, e *entry) (*domain.User, error) {
+	var user *domain.User
+	err := a.usrStorage.WithTx(ctx, func(ctx context.Context) error {
+		userID, err := a.identities.GetUserIDByIdentity(ctx, identityIssuer, e.dn)
+		switch {
+		case err == nil:
+			user, err = a.usrStorage.GetUserByID(ctx, userID)
+			if err != nil {
+				return err
+			}
+		case errors.Is(err, storage.ErrIdentityNotExists):
+			user, err = a.provisionUser(ctx, log, e)
+			if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if user.Role != e.role {
+			err = a.usrStorage.SetUserRole(ctx, user.ID, e.role)
+			if err != nil {
+				return err
+			}
+		}
+
+		user, err = a.usrStorage.GetUserByID(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			log.Warn("ldap entry matches an account not provisioned through ldap", slog.String("dn", e.dn))
+			return nil, auth.ErrInvalidCredentials
+		}
+		log.Error("failed to sync ldap user", logger.Err(err))
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// provisionUser creates an activated user for the directory entry and links it to
+// the entry.
+func (a *Authenticator) provisionUser(ctx context.Context, log *slog.Logger, e *entry) (*domain.User, error) {
+	if e.barcode == "" || e.firstName == "" {
+		return nil, ErrMissingAttributes
+	}
+
+	user := &domain.User{
+		Email:        e.email,
+		PasswordHash: []byte{},
+		FirstName:    e.firstName,
+		LastName:     e.lastName,
+		Barcode:      e.barcode,
+	}
+	err := a.usrStorage.SaveUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	err = a.usrStorage.ActivateUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = a.identities.SaveIdentity(ctx, &domain.Identity{
+		UserID:  user.ID,
+		Issuer:  identityIssuer,
+		Subject: e.dn,
+		Email:   e.email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info("provisioned ldap user", slog.Int64("user_id", user.ID))
+
+	return user, nil
+}
@@ -0,0 +1,270 @@
+package ldap
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	ldapv3 "github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	staffGroup  = "cn=club-moderators,ou=groups,dc=astanait,dc=edu,dc=kz"
+	serviceDN   = "cn=uniclubs,ou=services,dc=astanait,dc=edu,dc=kz"
+	servicePass = "service-secret"
+)
+
+func TestAuthenticator_ProvisionsUserOnFirstLogin(t *testing.T) {
+	ctx := context.Background()
+	a, dir, users := newTestAuthenticator(t)
+	dir.add("uid=teacher,ou=staff,dc=astanait,dc=edu,dc=kz", "teacher-pass", map[string][]string{
+		"mail":           {"teacher@astanait.edu.kz"},
+		"givenName":      {"Aigerim"},
+		"sn":             {"Teacher"},
+		"employeeNumber": {"S-1001"},
+		"memberOf":       {strings.ToUpper(staffGroup)},
+	})
+
+	user, err := a.VerifyPassword(ctx, "teacher@astanait.edu.kz", "teacher-pass")
+	require.NoError(t, err)
+	assert.Equal(t, "Aigerim", user.FirstName)
+	assert.Equal(t, "Teacher", user.LastName)
+	assert.Equal(t, "S-1001", user.Barcode)
+	assert.Equal(t, domain.RoleModer, user.Role, "role must be mapped from the group")
+	assert.True(t, users.users[user.ID].Activated, "provisioned user must be activated")
+
+	again, err := a.VerifyPassword(ctx, "teacher@astanait.edu.kz", "teacher-pass")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Len(t, users.users, 1, "user must be provisioned only once")
+}
+
+func TestAuthenticator_SyncsRoleWithGroups(t *testing.T) {
+	ctx := context.Background()
+	a, dir, users := newTestAuthenticator(t)
+	dn := "uid=lecturer,ou=staff,dc=astanait,dc=edu,dc=kz"
+	users.users[1] = &domain.User{ID: 1, Email: "lecturer@astanait.edu.kz", Role: "MODER", Activated: true}
+	users.identities[dn] = 1
+	dir.add(dn, "pass", map[string][]string{
+		"mail": {"lecturer@astanait.edu.kz"},
+	})
+
+	user, err := a.VerifyPassword(ctx, "lecturer@astanait.edu.kz", "pass")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), user.ID)
+	assert.Equal(t, domain.RoleUser, user.Role, "user outside of the mapped groups must get the default role")
+}
+
+func TestAuthenticator_DoesNotLinkLocalAccounts(t *testing.T) {
+	ctx := context.Background()
+	a, dir, users := newTestAuthenticator(t)
+	users.users[1] = &domain.User{ID: 1, Email: "admin@astanait.edu.kz", Barcode: "A-1", Role: domain.RoleAdmin, Activated: true}
+	dir.add("uid=mallory,ou=staff,dc=astanait,dc=edu,dc=kz", "pass", map[string][]string{
+		"mail":           {"admin@astanait.edu.kz"},
+		"givenName":      {"Mallory"},
+		"employeeNumber": {"S-666"},
+		"memberOf":       {staffGroup},
+	})
+
+	_, err := a.VerifyPassword(ctx, "admin@astanait.edu.kz", "pass")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	assert.Equal(t, domain.RoleAdmin, users.users[1].Role, "the role of a local account must not be changed")
+	assert.Empty(t, users.identities)
+}
+
+func TestNew_RejectsUnknownRoles(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := newFakeUserStorage()
+
+	_, err := New(log, users, users, config.LDAP{DefaultRole: "SUPERUSER"})
+	assert.ErrorIs(t, err, domain.ErrUnknownRole)
+
+	_, err = New(log, users, users, config.LDAP{
+		GroupRoles:  []config.LDAPGroupRole{{Group: staffGroup, Role: "moder"}},
+		DefaultRole: "USER",
+	})
+	assert.ErrorIs(t, err, domain.ErrUnknownRole)
+}
+
+func TestAuthenticator_RejectsInvalidCredentials(t *testing.T) {
+	ctx := context.Background()
+	a, dir, users := newTestAuthenticator(t)
+	dir.add("uid=teacher,ou=staff,dc=astanait,dc=edu,dc=kz", "teacher-pass", map[string][]string{
+		"mail":           {"teacher@astanait.edu.kz"},
+		"givenName":      {"Aigerim"},
+		"employeeNumber": {"S-1001"},
+	})
+
+	_, err := a.VerifyPassword(ctx, "teacher@astanait.edu.kz", "wrong")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	_, err = a.VerifyPassword(ctx, "teacher@astanait.edu.kz", "")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials, "empty password must not make an unauthenticated bind")
+
+	_, err = a.VerifyPassword(ctx, "nobody@astanait.edu.kz", "pass")
+	assert.ErrorIs(t, err, auth.ErrUserNotExist)
+
+	_, err = a.VerifyPassword(ctx, "*)(mail=*", "pass")
+	assert.ErrorIs(t, err, auth.ErrUserNotExist, "filter must be escaped")
+
+	assert.Empty(t, users.users)
+}
+
+func newTestAuthenticator(t *testing.T) (*Authenticator, *directory, *fakeUserStorage) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := &directory{entries: map[string]*directoryEntry{}}
+	dir.add(serviceDN, servicePass, nil)
+	users := newFakeUserStorage()
+
+	a, err := New(log, users, users, config.LDAP{
+		BindDN:       serviceDN,
+		BindPassword: servicePass,
+		BaseDN:       "dc=astanait,dc=edu,dc=kz",
+		UserFilter:   "(mail=%s)",
+		Attributes: config.LDAPAttributes{
+			Email:     "mail",
+			FirstName: "givenName",
+			LastName:  "sn",
+			Barcode:   "employeeNumber",
+			Groups:    "memberOf",
+		},
+		GroupRoles:  []config.LDAPGroupRole{{Group: staffGroup, Role: "MODER"}},
+		DefaultRole: "USER",
+		Timeout:     time.Second,
+	})
+	require.NoError(t, err)
+	a.dial = func() (Conn, error) {
+		return &directoryConn{dir: dir}, nil
+	}
+
+	return a, dir, users
+}
+
+// directory is an in-process stand-in for an LDAP server. It supports simple binds
+// and equality filters on a single attribute.
+type directory struct {
+	entries map[string]*directoryEntry
+}
+
+type directoryEntry struct {
+	password string
+	attrs    map[string][]string
+}
+
+func (d *directory) add(dn string, password string, attrs map[string][]string) {
+	d.entries[dn] = &directoryEntry{password: password, attrs: attrs}
+}
+
+type directoryConn struct {
+	dir   *directory
+	bound string
+}
+
+func (c *directoryConn) Bind(username, password string) error {
+	e, ok := c.dir.entries[username]
+	if !ok || password == "" || e.password != password {
+		return ldapv3.NewError(ldapv3.LDAPResultInvalidCredentials, nil)
+	}
+	c.bound = username
+	return nil
+}
+
+func (c *directoryConn) Search(req *ldapv3.SearchRequest) (*ldapv3.SearchResult, error) {
+	if c.bound == "" {
+		return nil, ldapv3.NewError(ldapv3.LDAPResultInsufficientAccessRights, nil)
+	}
+
+	attr, value, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(req.Filter, "("), ")"), "=")
+	if !ok {
+		return nil, ldapv3.NewError(ldapv3.LDAPResultFilterError, nil)
+	}
+
+	res := &ldapv3.SearchResult{}
+	for dn, e := range c.dir.entries {
+		if !strings.HasSuffix(dn, req.BaseDN) {
+			continue
+		}
+		for _, v := range e.attrs[attr] {
+			if ldapv3.EscapeFilter(v) == value {
+				res.Entries = append(res.Entries, ldapv3.NewEntry(dn, e.attrs))
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (c *directoryConn) Close() error {
+	return nil
+}
+
+// fakeUserStorage also stores identities, by the subject.
+type fakeUserStorage struct {
+	users      map[int64]*domain.User
+	identities map[string]int64
+}
+
+func newFakeUserStorage() *fakeUserStorage {
+	return &fakeUserStorage{users: map[int64]*domain.User{}, identities: map[string]int64{}}
+}
+
+func (s *fakeUserStorage) SaveUser(_ context.Context, user *domain.User) error {
+	for _, u := range s.users {
+		if u.Email == user.Email || u.Barcode == user.Barcode {
+			return storage.ErrUserExists
+		}
+	}
+	user.ID = int64(len(s.users) + 1)
+	copied := *user
+	copied.Role = "USER"
+	s.users[user.ID] = &copied
+	return nil
+}
+
+func (s *fakeUserStorage) GetUserByID(_ context.Context, userID int64) (*domain.User, error) {
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, storage.ErrUserNotExists
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *fakeUserStorage) ActivateUser(_ context.Context, userID int64) error {
+	s.users[userID].Activated = true
+	return nil
+}
+
+func (s *fakeUserStorage) SetUserRole(_ context.Context, userID int64, role domain.Role) error {
+	s.users[userID].Role = role
+	return nil
+}
+
+func (s *fakeUserStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (s *fakeUserStorage) SaveIdentity(_ context.Context, identity *domain.Identity) error {
+	if _, ok := s.identities[identity.Subject]; ok {
+		return storage.ErrIdentityExists
+	}
+	s.identities[identity.Subject] = identity.UserID
+	return nil
+}
+
+func (s *fakeUserStorage) GetUserIDByIdentity(_ context.Context, _ string, subject string) (int64, error) {
+	userID, ok := s.identities[subject]
+	if !ok {
+		return 0, storage.ErrIdentityNotExists
+	}
+	return userID, nil
+}
@@ -15,6 +15,7 @@ import (
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserNotExist       = errors.New("user does not exist")
+	ErrEditConflict       = errors.New("user was modified concurrently")
 )
 
 type Management struct {
@@ -30,9 +31,11 @@ type Amqp interface {
 
 type UserStorage interface {
 	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
-	UpdateUser(ctx context.Context, user *domain.User) error
+	UpdateUser(ctx context.Context, user *domain.User, fields []string) error
 	DeleteUserByID(ctx context.Context, userID int64) error
 	GetAll(ctx context.Context, query string, filters domain.Filters) ([]*domain.User, domain.Metadata, error)
+	GetUserByIDForUpdate(ctx context.Context, userID int64) (user *domain.User, err error)
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 func New(log *slog.Logger, storage UserStorage, client *image.Client, amqp Amqp) *Management {
@@ -65,41 +68,78 @@ func (m Management) GetUser(ctx context.Context, userID int64) (*domain.User, er
 
 }
 
-func (m Management) UpdateUser(ctx context.Context, user *domain.User) error {
+// UpdateUser applies the given fields of user to the stored user and returns the
+// updated user. If user.Version is set, the update fails with ErrEditConflict when
+// the stored user has a different version. Fields that already hold the requested
+// value are not written.
+func (m Management) UpdateUser(ctx context.Context, user *domain.User, fields []string) (*domain.User, error) {
 	const op = "Management.UpdateUser"
 	log := m.log.With(slog.String("op", op))
 
-	err := m.usrStorage.UpdateUser(ctx, user)
+	var (
+		updated *domain.User
+		changed []string
+	)
+	err := m.usrStorage.WithTx(ctx, func(ctx context.Context) error {
+		current, err := m.usrStorage.GetUserByIDForUpdate(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if user.Version != 0 && user.Version != current.Version {
+			return storage.ErrEditConflict
+		}
+
+		changed = current.ChangedFields(user, fields)
+		if len(changed) == 0 {
+			updated = current
+			return nil
+		}
+
+		user.Version = current.Version
+		err = m.usrStorage.UpdateUser(ctx, user, changed)
+		if err != nil {
+			return err
+		}
+		updated = user
+
+		return nil
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, storage.ErrUserNotExists):
 			log.Error("user not found", logger.Err(err))
-			return fmt.Errorf("%s: %w", op, ErrUserNotExist)
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		case errors.Is(err, storage.ErrEditConflict):
+			log.Info("edit conflict", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, ErrEditConflict)
 		default:
 			log.Error("failed to update user", logger.Err(err))
-			return fmt.Errorf("%s: %w", op, err)
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 	}
 
-	msg := struct {
-		ID        int64   `json:"id"`
-		FirstName *string `json:"first_name"`
-		LastName  *string `json:"last_name"`
-		AvatarURL *string `json:"avatar_url"`
-	}{
-		ID:        user.ID,
-		FirstName: &user.FirstName,
-		LastName:  &user.LastName,
-		AvatarURL: &user.AvatarURL,
+	if len(changed) == 0 {
+		return updated, nil
 	}
 
-	err = m.amqp.Publish(ctx, "user.club.updated", msg)
+	err = m.amqp.Publish(ctx, "user.club.updated", updatedEvent(updated, changed))
 	if err != nil {
 		log.Error("failed to publish user updated event", logger.Err(err))
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	return updated, nil
+}
+
+// updatedEvent builds the user.club.updated message holding the user id and only
+// the fields that changed.
+func updatedEvent(user *domain.User, changed []string) map[string]any {
+	msg := make(map[string]any, len(changed)+1)
+	msg["id"] = user.ID
+	for _, field := range changed {
+		msg[field], _ = user.FieldValue(field)
+	}
+	return msg
 }
 
 func (m Management) DeleteUser(ctx context.Context, userID int64) error {
@@ -162,29 +202,35 @@ func (m Management) UpdateAvatar(ctx context.Context, userID int64, image []byte
 		log.Error("failed to upload avatar", logger.Err(err))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	user.AvatarURL = res.GetImageUrl()
+	avatarURL := res.GetImageUrl()
+
+	// re-read the user under a row lock so that concurrent profile updates made
+	// while the image was uploading are not overwritten.
+	err = m.usrStorage.WithTx(ctx, func(ctx context.Context) error {
+		user, err = m.usrStorage.GetUserByIDForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		user.AvatarURL = avatarURL
 
-	err = m.usrStorage.UpdateUser(ctx, user)
+		return m.usrStorage.UpdateUser(ctx, user, []string{domain.FieldAvatarURL})
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, storage.ErrUserNotExists):
 			log.Error("user not found", logger.Err(err))
 			return nil, fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		case errors.Is(err, storage.ErrEditConflict):
+			log.Info("edit conflict", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, ErrEditConflict)
 		default:
 			log.Error("failed to update user avatar url", logger.Err(err))
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 	}
 
-	msg := struct {
-		ID        int64   `json:"id"`
-		AvatarURL *string `json:"avatar_url"`
-	}{
-		ID:        user.ID,
-		AvatarURL: &user.AvatarURL,
-	}
-
-	err = m.amqp.Publish(ctx, "user.club.updated", msg)
+	err = m.amqp.Publish(ctx, "user.club.updated", updatedEvent(user, []string{domain.FieldAvatarURL}))
 	if err != nil {
 		log.Error("failed to publish user updated event", logger.Err(err))
 		return nil, fmt.Errorf("%s: %w", op, err)
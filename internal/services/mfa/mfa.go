@@ -0,0 +1,295 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/secretbox"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/totp"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodesCount = 10
+	// totpSkew is the number of time steps before and after the current one in
+	// which a code is still accepted, to tolerate clock drift.
+	totpSkew = 1
+)
+
+var (
+	ErrUserNotExist         = errors.New("user does not exist")
+	ErrMFAUnavailable       = errors.New("two-factor authentication is not configured")
+	ErrMFANotEnabled        = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrMFAEnrolmentNotExist = errors.New("two-factor authentication enrolment does not exist")
+	ErrInvalidCode          = errors.New("invalid code")
+)
+
+type MFA struct {
+	log        *slog.Logger
+	storage    Storage
+	usrStorage UserStorage
+	box        *secretbox.Box
+	issuer     string
+}
+
+type Storage interface {
+	SaveMFASecret(ctx context.Context, userID int64, secret []byte) error
+	GetMFA(ctx context.Context, userID int64) (*domain.MFA, error)
+	EnableMFA(ctx context.Context, userID int64, recoveryCodeHashes []string) error
+	SetMFALastUsedStep(ctx context.Context, userID int64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+	DeleteMFA(ctx context.Context, userID int64) error
+}
+
+type UserStorage interface {
+	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
+}
+
+// New creates the two-factor authentication service. box encrypts the TOTP secrets
+// at rest; if it is nil enrolment and verification fail with ErrMFAUnavailable,
+// while IsEnabled keeps working so that users with 2FA enabled cannot skip it.
+func New(log *slog.Logger, storage Storage, usrStorage UserStorage, box *secretbox.Box, issuer string) *MFA {
+	return &MFA{
+		log:        log,
+		storage:    storage,
+		usrStorage: usrStorage,
+		box:        box,
+		issuer:     issuer,
+	}
+}
+
+// Enroll generates a new TOTP secret for the user and returns its otpauth URI.
+// The secret is not used for login until the enrolment is confirmed.
+func (m MFA) Enroll(ctx context.Context, userID int64) (uri string, err error) {
+	const op = "mfa.Enroll"
+	log := m.log.With(slog.String("op", op))
+
+	if m.box == nil {
+		return "", fmt.Errorf("%s: %w", op, ErrMFAUnavailable)
+	}
+
+	user, err := m.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			log.Error("user does not exists", logger.Err(err))
+			return "", fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	enabled, err := m.IsEnabled(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if enabled {
+		return "", fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	sealed, err := m.box.Seal(secret)
+	if err != nil {
+		log.Error("failed to encrypt secret", logger.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = m.storage.SaveMFASecret(ctx, userID, sealed)
+	if err != nil {
+		log.Error("failed to save secret", logger.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return totp.URI(m.issuer, user.Email, secret), nil
+}
+
+// Confirm enables the pending enrolment of the user if code is valid and returns
+// the recovery codes. The codes are only stored hashed and cannot be shown again.
+func (m MFA) Confirm(ctx context.Context, userID int64, code string) (recoveryCodes []string, err error) {
+	const op = "mfa.Confirm"
+	log := m.log.With(slog.String("op", op))
+
+	mfa, err := m.getMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrMFANotEnabled) {
+			return nil, fmt.Errorf("%s: %w", op, ErrMFAEnrolmentNotExist)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if mfa.Enabled {
+		return nil, fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	err = m.verifyTOTP(ctx, mfa, code)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	recoveryCodes = make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range recoveryCodes {
+		recoveryCodes[i], err = generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		hashes[i] = hashRecoveryCode(recoveryCodes[i])
+	}
+
+	err = m.storage.EnableMFA(ctx, userID, hashes)
+	if err != nil {
+		log.Error("failed to enable mfa", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return recoveryCodes, nil
+}
+
+// Disable turns two-factor authentication off. code must be a valid TOTP or
+// recovery code.
+func (m MFA) Disable(ctx context.Context, userID int64, code string) error {
+	const op = "mfa.Disable"
+	log := m.log.With(slog.String("op", op))
+
+	err := m.Verify(ctx, userID, code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = m.storage.DeleteMFA(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrMFANotExists) {
+		log.Error("failed to delete mfa", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// IsEnabled reports whether login of the user requires a second factor.
+func (m MFA) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	const op = "mfa.IsEnabled"
+
+	mfa, err := m.storage.GetMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotExists) {
+			return false, nil
+		}
+		m.log.With(slog.String("op", op)).Error("failed to get mfa", logger.Err(err))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mfa.Enabled, nil
+}
+
+// Verify checks a TOTP or recovery code of a user with two-factor authentication
+// enabled. Each code is accepted only once.
+func (m MFA) Verify(ctx context.Context, userID int64, code string) error {
+	const op = "mfa.Verify"
+	log := m.log.With(slog.String("op", op))
+
+	mfa, err := m.getMFA(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !mfa.Enabled {
+		return fmt.Errorf("%s: %w", op, ErrMFANotEnabled)
+	}
+
+	if len(code) == totp.Digits {
+		err = m.verifyTOTP(ctx, mfa, code)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	err = m.storage.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeAlreadyUsed) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+		}
+		log.Error("failed to use recovery code", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (m MFA) getMFA(ctx context.Context, userID int64) (*domain.MFA, error) {
+	if m.box == nil {
+		return nil, ErrMFAUnavailable
+	}
+
+	mfa, err := m.storage.GetMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotExists) {
+			return nil, ErrMFANotEnabled
+		}
+		m.log.Error("failed to get mfa", logger.Err(err))
+		return nil, err
+	}
+
+	return mfa, nil
+}
+
+func (m MFA) verifyTOTP(ctx context.Context, mfa *domain.MFA, code string) error {
+	secret, err := m.box.Open(mfa.Secret)
+	if err != nil {
+		m.log.Error("failed to decrypt secret", logger.Err(err))
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok || step <= mfa.LastUsedStep {
+		return ErrInvalidCode
+	}
+
+	err = m.storage.SetMFALastUsedStep(ctx, mfa.UserID, step)
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeAlreadyUsed) {
+			return ErrInvalidCode
+		}
+		m.log.Error("failed to save last used step", logger.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode returns a code of the form xxxxx-xxxxx.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+
+	// Generate cryptographically secure random bytes
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode hashes a recovery code ignoring case, spaces and dashes.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,184 @@
+package mfa
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/secretbox"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUserID = 1
+
+func TestMFA_EnrollAndVerify(t *testing.T) {
+	ctx := context.Background()
+	m, s := newTestMFA(t)
+
+	uri, err := m.Enroll(ctx, testUserID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/"))
+
+	enabled, err := m.IsEnabled(ctx, testUserID)
+	require.NoError(t, err)
+	assert.False(t, enabled, "mfa is not enabled before the enrolment is confirmed")
+	assert.ErrorIs(t, m.Verify(ctx, testUserID, "123456"), ErrMFANotEnabled)
+
+	secret := openSecret(t, m, s)
+	now := totp.Step(time.Now())
+
+	_, err = m.Confirm(ctx, testUserID, wrongCode(secret, now))
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	recoveryCodes, err := m.Confirm(ctx, testUserID, totp.Code(secret, now))
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodesCount)
+
+	enabled, err = m.IsEnabled(ctx, testUserID)
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	// the code used to confirm can not be replayed, the next one is accepted
+	assert.ErrorIs(t, m.Verify(ctx, testUserID, totp.Code(secret, now)), ErrInvalidCode)
+	require.NoError(t, m.Verify(ctx, testUserID, totp.Code(secret, now+1)))
+	assert.ErrorIs(t, m.Verify(ctx, testUserID, totp.Code(secret, now+1)), ErrInvalidCode)
+
+	assert.ErrorIs(t, m.Verify(ctx, testUserID, wrongCode(secret, now+1)), ErrInvalidCode)
+	_, err = m.Enroll(ctx, testUserID)
+	assert.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+}
+
+func TestMFA_RecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	m, s := newTestMFA(t)
+
+	_, err := m.Enroll(ctx, testUserID)
+	require.NoError(t, err)
+	secret := openSecret(t, m, s)
+	recoveryCodes, err := m.Confirm(ctx, testUserID, totp.Code(secret, totp.Step(time.Now())))
+	require.NoError(t, err)
+
+	for _, code := range recoveryCodes {
+		assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		assert.NotContains(t, s.recoveryCodes, code, "recovery codes are only stored hashed")
+	}
+
+	// codes are accepted regardless of case and dashes, but only once
+	code := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	require.NoError(t, m.Verify(ctx, testUserID, code))
+	assert.ErrorIs(t, m.Verify(ctx, testUserID, recoveryCodes[0]), ErrInvalidCode)
+	assert.ErrorIs(t, m.Verify(ctx, testUserID, "aaaaa-aaaaa"), ErrInvalidCode)
+
+	require.NoError(t, m.Disable(ctx, testUserID, recoveryCodes[1]))
+	enabled, err := m.IsEnabled(ctx, testUserID)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+}
+
+func TestMFA_Unavailable(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeStorage{}
+	m := New(slog.New(slog.NewTextHandler(io.Discard, nil)), s, &fakeUserStorage{}, nil, "UniClubs")
+
+	_, err := m.Enroll(ctx, testUserID)
+	assert.ErrorIs(t, err, ErrMFAUnavailable)
+
+	// users who enabled mfa can not skip it while the key is missing
+	s.mfa = &domain.MFA{UserID: testUserID, Enabled: true}
+	enabled, err := m.IsEnabled(ctx, testUserID)
+	require.NoError(t, err)
+	assert.True(t, enabled)
+	assert.ErrorIs(t, m.Verify(ctx, testUserID, "123456"), ErrMFAUnavailable)
+}
+
+func newTestMFA(t *testing.T) (*MFA, *fakeStorage) {
+	t.Helper()
+
+	box, err := secretbox.New(make([]byte, 32))
+	require.NoError(t, err)
+
+	s := &fakeStorage{}
+	m := New(slog.New(slog.NewTextHandler(io.Discard, nil)), s, &fakeUserStorage{}, box, "UniClubs")
+
+	return m, s
+}
+
+func openSecret(t *testing.T, m *MFA, s *fakeStorage) []byte {
+	t.Helper()
+
+	secret, err := m.box.Open(s.mfa.Secret)
+	require.NoError(t, err)
+
+	return secret
+}
+
+// wrongCode returns a code that is not valid around step.
+func wrongCode(secret []byte, step int64) string {
+	for _, code := range []string{"000000", "111111", "222222", "333333"} {
+		if _, ok := totp.Validate(secret, code, time.Unix(step*totp.Period, 0), totpSkew+1); !ok {
+			return code
+		}
+	}
+	panic("no invalid code found")
+}
+
+type fakeStorage struct {
+	mfa           *domain.MFA
+	recoveryCodes map[string]bool
+}
+
+func (s *fakeStorage) SaveMFASecret(_ context.Context, userID int64, secret []byte) error {
+	s.mfa = &domain.MFA{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (s *fakeStorage) GetMFA(_ context.Context, userID int64) (*domain.MFA, error) {
+	if s.mfa == nil || s.mfa.UserID != userID {
+		return nil, storage.ErrMFANotExists
+	}
+	copied := *s.mfa
+	return &copied, nil
+}
+
+func (s *fakeStorage) EnableMFA(_ context.Context, _ int64, recoveryCodeHashes []string) error {
+	s.mfa.Enabled = true
+	s.recoveryCodes = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		s.recoveryCodes[hash] = false
+	}
+	return nil
+}
+
+func (s *fakeStorage) SetMFALastUsedStep(_ context.Context, _ int64, step int64) error {
+	if step <= s.mfa.LastUsedStep {
+		return storage.ErrCodeAlreadyUsed
+	}
+	s.mfa.LastUsedStep = step
+	return nil
+}
+
+func (s *fakeStorage) UseRecoveryCode(_ context.Context, _ int64, codeHash string) error {
+	used, ok := s.recoveryCodes[codeHash]
+	if !ok || used {
+		return storage.ErrCodeAlreadyUsed
+	}
+	s.recoveryCodes[codeHash] = true
+	return nil
+}
+
+func (s *fakeStorage) DeleteMFA(_ context.Context, _ int64) error {
+	s.mfa = nil
+	return nil
+}
+
+type fakeUserStorage struct{}
+
+func (fakeUserStorage) GetUserByID(_ context.Context, userID int64) (*domain.User, error) {
+	return &domain.User{ID: userID, Email: "student@astanait.edu.kz"}, nil
+}
@@ -0,0 +1,430 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/auth"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/services/token"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/session"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	scopeOpenID         = "openid"
+	responseTypeCode    = "code"
+	codeChallengeS256   = "S256"
+	grantAuthorization  = "authorization_code"
+	grantRefreshToken   = "refresh_token"
+	minCodeVerifierSize = 43
+	maxCodeVerifierSize = 128
+)
+
+// Errors of the authorization request that must not be sent to the redirect URI,
+// because the client or the redirect URI cannot be trusted.
+var (
+	ErrClientNotExists    = errors.New("client does not exist")
+	ErrInvalidRedirectURI = errors.New("redirect_uri is not registered for the client")
+)
+
+// Errors with the OAuth 2.0 error codes (RFC 6749) they are reported with.
+var (
+	ErrInvalidRequest          = errors.New("invalid_request")
+	ErrUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrInvalidScope            = errors.New("invalid_scope")
+	ErrInvalidClient           = errors.New("invalid_client")
+	ErrInvalidGrant            = errors.New("invalid_grant")
+	ErrUnsupportedGrantType    = errors.New("unsupported_grant_type")
+	ErrInvalidToken            = errors.New("invalid_token")
+)
+
+// Provider is a minimal OpenID Connect provider implementing the authorization
+// code flow with PKCE for first-party clients.
+type Provider struct {
+	log        *slog.Logger
+	auth       Auth
+	tokens     Tokens
+	clients    ClientStorage
+	codes      CodeStorage
+	usrStorage UserStorage
+	cfg        config.OIDC
+}
+
+type Auth interface {
+	Login(ctx context.Context, email string, password string) (*domain.User, string, error)
+	VerifyMFA(ctx context.Context, challenge string, code string) (*domain.User, string, error)
+}
+
+type Tokens interface {
+	IssueForClient(ctx context.Context, user *domain.User, sessionToken string, clientID string) (accessToken string, refreshToken string, err error)
+	RefreshForClient(ctx context.Context, refreshToken string, clientID string) (accessToken string, newRefreshToken string, err error)
+	SignIDToken(issuer string, audience string, user *domain.User, nonce string, authTime time.Time) (string, error)
+	Verify(accessToken string) (*token.Claims, error)
+	JWKS() ([]byte, error)
+	AccessTTL() time.Duration
+}
+
+type ClientStorage interface {
+	GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error)
+}
+
+type CodeStorage interface {
+	SaveAuthorizationCode(ctx context.Context, code string, authCode *domain.AuthorizationCode, duration time.Duration) error
+	TakeAuthorizationCode(ctx context.Context, code string) (*domain.AuthorizationCode, error)
+}
+
+type UserStorage interface {
+	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
+}
+
+func New(
+	log *slog.Logger,
+	auth Auth,
+	tokens Tokens,
+	clients ClientStorage,
+	codes CodeStorage,
+	usrStorage UserStorage,
+	cfg config.OIDC,
+) *Provider {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+
+	return &Provider{
+		log:        log,
+		auth:       auth,
+		tokens:     tokens,
+		clients:    clients,
+		codes:      codes,
+		usrStorage: usrStorage,
+		cfg:        cfg,
+	}
+}
+
+// AuthorizeRequest is an OAuth 2.0 authorization request.
+type AuthorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest is an OAuth 2.0 token request.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// ValidateAuthorizeRequest checks an authorization request before the user is asked
+// to log in. ErrClientNotExists and ErrInvalidRedirectURI must be shown to the
+// user; other errors can be reported to the redirect URI.
+func (p *Provider) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (*domain.OAuthClient, error) {
+	const op = "oidc.ValidateAuthorizeRequest"
+	log := p.log.With(slog.String("op", op))
+
+	client, err := p.clients.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrClientNotExists):
+			return nil, fmt.Errorf("%s: %w", op, ErrClientNotExists)
+		default:
+			log.Error("failed to get client", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidRedirectURI)
+	}
+
+	switch {
+	case req.ResponseType != responseTypeCode:
+		return client, fmt.Errorf("%s: %w", op, ErrUnsupportedResponseType)
+	case !slices.Contains(strings.Fields(req.Scope), scopeOpenID):
+		return client, fmt.Errorf("%s: %w: the openid scope is required", op, ErrInvalidScope)
+	case req.CodeChallenge == "" || req.CodeChallengeMethod != codeChallengeS256:
+		return client, fmt.Errorf("%s: %w: PKCE with S256 is required", op, ErrInvalidRequest)
+	}
+
+	return client, nil
+}
+
+// Authorize logs the user in with Auth.Login and returns the redirect URI carrying
+// a new authorization code. For users with two-factor authentication otp must be
+// set, otherwise the error wraps auth.ErrMFARequired.
+func (p *Provider) Authorize(ctx context.Context, req AuthorizeRequest, email string, password string, otp string) (redirectURI string, err error) {
+	const op = "oidc.Authorize"
+	log := p.log.With(slog.String("op", op))
+
+	_, err = p.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, sessionToken, err := p.auth.Login(ctx, email, password)
+	if errors.Is(err, auth.ErrMFARequired) && otp != "" {
+		user, sessionToken, err = p.auth.VerifyMFA(ctx, sessionToken, otp)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := session.GenerateToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = p.codes.SaveAuthorizationCode(ctx, code, &domain.AuthorizationCode{
+		ClientID:      req.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		SessionToken:  sessionToken,
+		AuthTime:      time.Now().Unix(),
+	}, p.cfg.CodeTTL)
+	if err != nil {
+		log.Error("can not save authorization code", logger.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return RedirectURI(req.RedirectURI, url.Values{"code": {code}, "state": {req.State}}), nil
+}
+
+// Exchange handles a token request for the authorization_code and refresh_token
+// grants.
+func (p *Provider) Exchange(ctx context.Context, req TokenRequest) (*TokenResponse, error) {
+	const op = "oidc.Exchange"
+	log := p.log.With(slog.String("op", op))
+
+	client, err := p.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch req.GrantType {
+	case grantAuthorization:
+		return p.exchangeCode(ctx, log, client, req)
+	case grantRefreshToken:
+		// refresh tokens are bound to the client they were issued to
+		accessToken, refreshToken, err := p.tokens.RefreshForClient(ctx, req.RefreshToken, client.ID)
+		if err != nil {
+			if errors.Is(err, token.ErrRefreshTokenNotExists) || errors.Is(err, token.ErrRefreshTokenReused) ||
+				errors.Is(err, token.ErrRefreshTokenClientMismatch) {
+				return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidGrant, err)
+			}
+			log.Error("failed to refresh tokens", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return p.tokenResponse(accessToken, refreshToken, ""), nil
+	default:
+		return nil, fmt.Errorf("%s: %w", op, ErrUnsupportedGrantType)
+	}
+}
+
+func (p *Provider) exchangeCode(ctx context.Context, log *slog.Logger, client *domain.OAuthClient, req TokenRequest) (*TokenResponse, error) {
+	const op = "oidc.exchangeCode"
+
+	authCode, err := p.codes.TakeAuthorizationCode(ctx, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTokenNotExists):
+			return nil, fmt.Errorf("%s: %w: unknown or expired code", op, ErrInvalidGrant)
+		default:
+			log.Error("failed to get authorization code", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	switch {
+	case authCode.ClientID != client.ID:
+		return nil, fmt.Errorf("%s: %w: code was issued to another client", op, ErrInvalidGrant)
+	case authCode.RedirectURI != req.RedirectURI:
+		return nil, fmt.Errorf("%s: %w: redirect_uri does not match", op, ErrInvalidGrant)
+	case !verifyCodeChallenge(authCode.CodeChallenge, req.CodeVerifier):
+		return nil, fmt.Errorf("%s: %w: invalid code_verifier", op, ErrInvalidGrant)
+	}
+
+	user, err := p.usrStorage.GetUserByID(ctx, authCode.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			return nil, fmt.Errorf("%s: %w: user does not exist", op, ErrInvalidGrant)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	accessToken, refreshToken, err := p.tokens.IssueForClient(ctx, user, authCode.SessionToken, client.ID)
+	if err != nil {
+		log.Error("failed to issue tokens", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	idToken, err := p.tokens.SignIDToken(p.cfg.Issuer, client.ID, user, authCode.Nonce, time.Unix(authCode.AuthTime, 0))
+	if err != nil {
+		log.Error("failed to sign id token", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return p.tokenResponse(accessToken, refreshToken, idToken), nil
+}
+
+// UserInfo returns the claims of the user an access token was issued to.
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	const op = "oidc.UserInfo"
+	log := p.log.With(slog.String("op", op))
+
+	claims, err := p.tokens.Verify(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	user, err := p.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			return nil, fmt.Errorf("%s: %w: user does not exist", op, ErrInvalidToken)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	obj := user.ToUserObject()
+
+	return map[string]any{
+		"sub":         claims.Subject,
+		"email":       obj.GetEmail(),
+		"given_name":  obj.GetFirstName(),
+		"family_name": obj.GetLastName(),
+		"picture":     obj.GetAvatarUrl(),
+		"role":        obj.GetRole().String(),
+		"barcode":     obj.GetBarcode(),
+		"major":       obj.GetMajor(),
+		"group_name":  obj.GetGroupName(),
+		"year":        obj.GetYear(),
+	}, nil
+}
+
+// Discovery returns the OpenID Provider Metadata.
+func (p *Provider) Discovery() map[string]any {
+	issuer := p.cfg.Issuer
+
+	return map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{responseTypeCode},
+		"grant_types_supported":                 []string{grantAuthorization, grantRefreshToken},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"EdDSA"},
+		"scopes_supported":                      []string{scopeOpenID, "email", "profile"},
+		"code_challenge_methods_supported":      []string{codeChallengeS256},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+// JWKS returns the keys ID tokens and access tokens are signed with.
+func (p *Provider) JWKS() ([]byte, error) {
+	return p.tokens.JWKS()
+}
+
+func (p *Provider) authenticateClient(ctx context.Context, clientID string, secret string) (*domain.OAuthClient, error) {
+	client, err := p.clients.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotExists) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if client.Public() {
+		return client, nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)) != nil {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+func (p *Provider) tokenResponse(accessToken string, refreshToken string, idToken string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(p.tokens.AccessTTL().Seconds()),
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+	}
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against an S256 code challenge.
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < minCodeVerifierSize || len(verifier) > maxCodeVerifierSize {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// RedirectURI adds params to the query of a redirect URI.
+func RedirectURI(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,186 @@
+// Package password decides which passwords users can set.
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/breached"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the longest max_length allowed, long enough for passphrases.
+const MaxLength = 128
+
+var (
+	ErrTooShort          = errors.New("password is too short")
+	ErrTooLong           = errors.New("password is too long")
+	ErrTooFewCharClasses = errors.New("password has too few kinds of characters")
+	ErrTooWeak           = errors.New("password is too easy to guess")
+	ErrPersonalInfo      = errors.New("password contains your name or email")
+	ErrBreached          = errors.New("password has appeared in a data breach")
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+// Policy is the password policy configured in config.Password.
+type Policy struct {
+	cfg        config.Password
+	breached   *breached.List
+	dictionary map[string]struct{}
+	maxWordLen int
+}
+
+func New(cfg config.Password) (*Policy, error) {
+	const op = "password.New"
+
+	err := validation.Errors{
+		"min_length":       validation.Validate(cfg.MinLength, validation.Min(0)),
+		"max_length":       validation.Validate(cfg.MaxLength, validation.Required, validation.Min(cfg.MinLength), validation.Max(MaxLength)),
+		"min_char_classes": validation.Validate(cfg.MinCharClasses, validation.Min(0), validation.Max(4)),
+		"min_strength":     validation.Validate(cfg.MinStrength, validation.Min(0), validation.Max(4)),
+	}.Filter()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	commonPasswords := parseList(commonPasswordsList)
+	p := &Policy{
+		cfg:        cfg,
+		dictionary: make(map[string]struct{}, len(commonPasswords)),
+	}
+	for _, word := range commonPasswords {
+		p.dictionary[word] = struct{}{}
+		p.maxWordLen = max(p.maxWordLen, utf8.RuneCountInString(word))
+	}
+
+	if cfg.BreachedList == "" {
+		p.breached = breached.FromPasswords(commonPasswords)
+	} else {
+		p.breached, err = breached.Open(cfg.BreachedList)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return p, nil
+}
+
+// Check returns validation.Errors keyed by "password" if the policy does not allow
+// the password, or nil. The error of "password" is validation.Errors too, keyed by
+// the violated rules: "length", "character_classes", "strength", "personal_info" and
+// "breached". They wrap the errors of this package. personal is the name and email
+// of the user.
+func (p *Policy) Check(password string, personal ...string) error {
+	const op = "password.Check"
+
+	violations := validation.Errors{}
+
+	length := utf8.RuneCountInString(password)
+	switch {
+	case length < p.cfg.MinLength:
+		violations["length"] = fmt.Errorf("%w, use at least %d characters", ErrTooShort, p.cfg.MinLength)
+	case length > p.cfg.MaxLength:
+		violations["length"] = fmt.Errorf("%w, use at most %d characters", ErrTooLong, p.cfg.MaxLength)
+	}
+
+	if charClasses(password) < p.cfg.MinCharClasses {
+		violations["character_classes"] = fmt.Errorf(
+			"%w, use at least %d of lowercase letters, uppercase letters, digits and symbols",
+			ErrTooFewCharClasses, p.cfg.MinCharClasses,
+		)
+	}
+
+	if score := p.Strength(password); score < p.cfg.MinStrength {
+		violations["strength"] = fmt.Errorf("%w, its strength is %d of the required %d", ErrTooWeak, score, p.cfg.MinStrength)
+	}
+
+	if p.cfg.RejectPersonalInfo && containsPersonalInfo(password, personal) {
+		violations["personal_info"] = ErrPersonalInfo
+	}
+
+	isBreached, err := p.isBreached(password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if isBreached {
+		violations["breached"] = ErrBreached
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return validation.Errors{"password": violations}
+}
+
+// isBreached reports whether the password, or the password in lowercase, is in the
+// breached password list.
+func (p *Policy) isBreached(password string) (bool, error) {
+	ok, err := p.breached.Contains(password)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	if lower := strings.ToLower(password); lower != password {
+		return p.breached.Contains(lower)
+	}
+
+	return false, nil
+}
+
+// charClasses returns how many of lowercase letters, uppercase letters, digits and
+// symbols the password contains.
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// containsPersonalInfo reports whether the password contains a word of at least 3
+// characters of the personal info, ignoring case. The domain of emails is ignored.
+func containsPersonalInfo(password string, personal []string) bool {
+	password = strings.ToLower(password)
+	for _, info := range personal {
+		local, _, _ := strings.Cut(strings.ToLower(info), "@")
+		words := strings.FieldsFunc(local, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if utf8.RuneCountInString(word) >= 3 && strings.Contains(password, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseList(list string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
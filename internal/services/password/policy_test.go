@@ -0,0 +1,109 @@
+package password
+
+import (
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/breached"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var defaultConfig = config.Password{
+	MinLength:          8,
+	MaxLength:          64,
+	MinCharClasses:     2,
+	MinStrength:        2,
+	RejectPersonalInfo: true,
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := New(defaultConfig)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		password string
+		wantErrs map[string]error
+	}{
+		{name: "strong", password: "k9#Lm2qZ-vT"},
+		{name: "passphrase", password: "correct horse battery staple"},
+		{name: "too short", password: "k9#Lm2q", wantErrs: map[string]error{"length": ErrTooShort}},
+		{name: "too long", password: strings.Repeat("k9#Lm2qZ-vT", 6), wantErrs: map[string]error{"length": ErrTooLong}},
+		{name: "single class", password: "vtqkzmwpxr", wantErrs: map[string]error{"character_classes": ErrTooFewCharClasses}},
+		{name: "keyboard pattern", password: "asdfgh123", wantErrs: map[string]error{"strength": ErrTooWeak}},
+		{
+			name:     "breached with another case",
+			password: "Password123",
+			wantErrs: map[string]error{"strength": ErrTooWeak, "breached": ErrBreached},
+		},
+		{name: "leetspeak word", password: "p@ssw0rd!!", wantErrs: map[string]error{"strength": ErrTooWeak}},
+		{name: "name", password: "Arman-2024!x", wantErrs: map[string]error{"personal_info": ErrPersonalInfo}},
+		{name: "email", password: "a.sultan#2024", wantErrs: map[string]error{"personal_info": ErrPersonalInfo}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(tt.password, "Arman", "Sultanov", "a.sultan@astanait.edu.kz")
+			if len(tt.wantErrs) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var errs validation.Errors
+			require.ErrorAs(t, err, &errs)
+			var violations validation.Errors
+			require.ErrorAs(t, errs["password"], &violations)
+			assert.Len(t, violations, len(tt.wantErrs), violations.Error())
+			for rule, wantErr := range tt.wantErrs {
+				assert.ErrorIs(t, violations[rule], wantErr, rule)
+			}
+		})
+	}
+}
+
+func TestPolicy_Strength(t *testing.T) {
+	p, err := New(defaultConfig)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, p.Strength("password"))
+	assert.Equal(t, 0, p.Strength("P@ssw0rd"))
+	assert.Equal(t, 1, p.Strength("aaaaaaaa"))
+	assert.Equal(t, 1, p.Strength("qwerty12"))
+	assert.Equal(t, 4, p.Strength("Tr0ub4dor&3"))
+	assert.Equal(t, 4, p.Strength("correct horse battery staple"))
+}
+
+func TestNew_BreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.bin")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := breached.NewWriter(f)
+	require.NoError(t, w.Add(breached.Hash("k9#Lm2qZ-vT")))
+	require.NoError(t, f.Close())
+
+	cfg := defaultConfig
+	cfg.BreachedList = path
+	p, err := New(cfg)
+	require.NoError(t, err)
+
+	var errs validation.Errors
+	require.ErrorAs(t, p.Check("k9#Lm2qZ-vT"), &errs)
+	assert.ErrorContains(t, errs["password"], ErrBreached.Error())
+	assert.NoError(t, p.Check("Password!x7Q"), "the embedded list is not used with a configured one")
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	cfg := defaultConfig
+	cfg.MaxLength = MaxLength + 1
+	_, err := New(cfg)
+	assert.Error(t, err)
+
+	cfg = defaultConfig
+	cfg.BreachedList = filepath.Join(t.TempDir(), "missing.bin")
+	_, err = New(cfg)
+	assert.Error(t, err)
+}
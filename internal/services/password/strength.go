@@ -0,0 +1,155 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// The strength estimate follows zxcvbn: it estimates how many guesses an attacker
+// trying common passwords, repeats, sequences and keyboard patterns first needs, and
+// scores the password by the order of magnitude.
+
+// scoreThresholds are the log10 of the guesses needed for the scores 1 to 4.
+var scoreThresholds = []float64{3, 6, 8, 10}
+
+// predictableWeight is the share of a guess a character continuing a repeat,
+// sequence or keyboard pattern adds.
+const predictableWeight = 0.2
+
+// minWordLen is the length of the shortest dictionary words looked for.
+const minWordLen = 4
+
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+var leet = map[rune]rune{'@': 'a', '4': 'a', '3': 'e', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't'}
+
+// Strength returns the estimated strength of the password, from 0 for too guessable
+// to 4 for very unguessable.
+func (p *Policy) Strength(password string) int {
+	guesses := p.log10Guesses(password)
+
+	score := 0
+	for _, threshold := range scoreThresholds {
+		if guesses < threshold {
+			break
+		}
+		score++
+	}
+
+	return score
+}
+
+func (p *Policy) log10Guesses(password string) float64 {
+	runes := []rune(strings.ToLower(password))
+	perChar := math.Log10(float64(charPool(password)))
+
+	inWord := make([]bool, len(runes))
+	words := p.matchWords(runes, inWord)
+	guesses := float64(words) * math.Log10(float64(len(p.dictionary)))
+
+	for i, r := range runes {
+		switch {
+		case inWord[i]:
+		case i > 0 && predictable(runes[i-1], r):
+			guesses += predictableWeight * perChar
+		default:
+			guesses += perChar
+		}
+	}
+
+	return guesses
+}
+
+// matchWords marks the characters of the dictionary words in runes, longest first
+// and undoing leetspeak, and returns how many words it found.
+func (p *Policy) matchWords(runes []rune, inWord []bool) int {
+	unleeted := make([]rune, len(runes))
+	for i, r := range runes {
+		unleeted[i] = r
+		if letter, ok := leet[r]; ok {
+			unleeted[i] = letter
+		}
+	}
+
+	words := 0
+	for i := 0; i < len(runes); {
+		n := p.longestWordAt(runes, unleeted, i)
+		if n == 0 {
+			i++
+			continue
+		}
+		for j := i; j < i+n; j++ {
+			inWord[j] = true
+		}
+		words++
+		i += n
+	}
+
+	return words
+}
+
+func (p *Policy) longestWordAt(runes []rune, unleeted []rune, i int) int {
+	for n := min(p.maxWordLen, len(runes)-i); n >= minWordLen; n-- {
+		if _, ok := p.dictionary[string(runes[i:i+n])]; ok {
+			return n
+		}
+		if _, ok := p.dictionary[string(unleeted[i:i+n])]; ok {
+			return n
+		}
+	}
+	return 0
+}
+
+// predictable reports whether b repeats a, follows it in a sequence like "abc" or
+// "321", or is next to it on the keyboard.
+func predictable(a rune, b rune) bool {
+	if a == b {
+		return true
+	}
+
+	isAlnum := func(r rune) bool { return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) }
+	if isAlnum(a) && isAlnum(b) && (b-a == 1 || a-b == 1) {
+		return true
+	}
+
+	for _, row := range keyboardRows {
+		i, j := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// charPool returns the size of the character set the password is drawn from.
+func charPool(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+
+	return max(pool, 1)
+}
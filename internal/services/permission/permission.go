@@ -0,0 +1,159 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"log/slog"
+	"slices"
+)
+
+var (
+	ErrUserNotExist        = errors.New("user does not exist")
+	ErrRoleNotExists       = errors.New("role does not exist")
+	ErrPermissionNotExists = errors.New("permission does not exist")
+)
+
+// Permissions evaluates the permissions of users, which are the permissions
+// granted to their role, and manages the grants.
+type Permissions struct {
+	log         *slog.Logger
+	usrStorage  UserStorage
+	permStorage Storage
+}
+
+type UserStorage interface {
+	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
+}
+
+type Storage interface {
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
+	GrantPermission(ctx context.Context, role string, permission string) error
+	RevokePermission(ctx context.Context, role string, permission string) error
+}
+
+func New(log *slog.Logger, usrStorage UserStorage, permStorage Storage) *Permissions {
+	return &Permissions{
+		log:         log,
+		usrStorage:  usrStorage,
+		permStorage: permStorage,
+	}
+}
+
+// CheckPermission reports whether the user has the permission.
+func (p Permissions) CheckPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	const op = "permissions.CheckPermission"
+
+	permissions, err := p.ListPermissions(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return slices.Contains(permissions, permission), nil
+}
+
+// ListPermissions returns the names of the permissions of the user.
+func (p Permissions) ListPermissions(ctx context.Context, userID int64) ([]string, error) {
+	const op = "permissions.ListPermissions"
+	log := p.log.With(slog.String("op", op))
+
+	user, err := p.usrStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	permissions, err := p.ListRolePermissions(ctx, user.Role.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permissions, nil
+}
+
+// ListRolePermissions returns the names of the permissions granted to the role.
+func (p Permissions) ListRolePermissions(ctx context.Context, role string) ([]string, error) {
+	const op = "permissions.ListRolePermissions"
+	log := p.log.With(slog.String("op", op))
+
+	permissions, err := p.permStorage.GetRolePermissions(ctx, role)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrRoleNotExists):
+			return nil, fmt.Errorf("%s: %w", op, ErrRoleNotExists)
+		default:
+			log.Error("failed to get role permissions", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return permissions, nil
+}
+
+// GrantPermission grants the permission to the role.
+func (p Permissions) GrantPermission(ctx context.Context, role string, permission string) error {
+	const op = "permissions.GrantPermission"
+	log := p.log.With(slog.String("op", op))
+
+	err := validateGrant(role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = p.permStorage.GrantPermission(ctx, role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, p.grantError(log, err))
+	}
+
+	log.Info("permission granted", slog.String("role", role), slog.String("permission", permission))
+
+	return nil
+}
+
+// RevokePermission revokes the permission from the role.
+func (p Permissions) RevokePermission(ctx context.Context, role string, permission string) error {
+	const op = "permissions.RevokePermission"
+	log := p.log.With(slog.String("op", op))
+
+	err := validateGrant(role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = p.permStorage.RevokePermission(ctx, role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, p.grantError(log, err))
+	}
+
+	log.Info("permission revoked", slog.String("role", role), slog.String("permission", permission))
+
+	return nil
+}
+
+func validateGrant(role string, permission string) error {
+	return validation.Errors{
+		"role":       validation.Validate(role, validation.Required),
+		"permission": validation.Validate(permission, validation.Required),
+	}.Filter()
+}
+
+func (p Permissions) grantError(log *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrRoleNotExists):
+		return ErrRoleNotExists
+	case errors.Is(err, storage.ErrPermissionNotExists):
+		return ErrPermissionNotExists
+	default:
+		log.Error("failed to update role permissions", logger.Err(err))
+		return err
+	}
+}
@@ -0,0 +1,164 @@
+// Package registration decides which emails and barcodes users can register with.
+package registration
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrDomainNotAllowed = errors.New("email domain is not allowed")
+	ErrDomainDenied     = errors.New("email domain is denied")
+	ErrDisposableEmail  = errors.New("disposable email addresses are not allowed")
+	ErrInvalidBarcode   = errors.New("barcode does not match the format of the email domain")
+)
+
+// The registration modes of config.Registration.
+const (
+	ModeOpen       = "open"
+	ModeInviteOnly = "invite_only"
+)
+
+//go:embed disposable_domains.txt
+var disposableDomainsList string
+
+// Policy is the registration policy configured in config.Registration.
+type Policy struct {
+	inviteOnly     bool
+	allowed        []string
+	denied         []string
+	disposable     map[string]struct{}
+	barcodeFormats []barcodeFormat
+}
+
+type barcodeFormat struct {
+	domain  string
+	pattern *regexp.Regexp
+}
+
+func New(cfg config.Registration) (*Policy, error) {
+	const op = "registration.New"
+
+	switch cfg.Mode {
+	case "", ModeOpen, ModeInviteOnly:
+	default:
+		return nil, fmt.Errorf("%s: unknown registration mode %q", op, cfg.Mode)
+	}
+
+	p := &Policy{
+		inviteOnly: cfg.Mode == ModeInviteOnly,
+		allowed:    normalizeDomains(cfg.AllowedDomains),
+		denied:     normalizeDomains(cfg.DeniedDomains),
+	}
+
+	if cfg.BlockDisposable {
+		p.disposable = parseDomainList(disposableDomainsList)
+	}
+
+	for _, format := range cfg.BarcodeFormats {
+		pattern, err := regexp.Compile(`^(?:` + format.Pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("%s: barcode format of %s: %w", op, format.Domain, err)
+		}
+		p.barcodeFormats = append(p.barcodeFormats, barcodeFormat{
+			domain:  normalizeDomain(format.Domain),
+			pattern: pattern,
+		})
+	}
+
+	return p, nil
+}
+
+// Check returns validation.Errors keyed by "email" and "barcode" if the policy does
+// not allow registering with them, or nil. The errors wrap the errors of this
+// package.
+func (p *Policy) Check(email string, barcode string) error {
+	_, domain, ok := strings.Cut(strings.ToLower(email), "@")
+	if !ok || domain == "" {
+		return validation.Errors{"email": ErrDomainNotAllowed}
+	}
+
+	errs := validation.Errors{}
+	switch {
+	case matchesAny(domain, p.denied):
+		errs["email"] = fmt.Errorf("%w: %s", ErrDomainDenied, domain)
+	case len(p.allowed) > 0 && !matchesAny(domain, p.allowed):
+		errs["email"] = fmt.Errorf("%w: %s, use an email of %s", ErrDomainNotAllowed, domain, strings.Join(p.allowed, ", "))
+	case p.isDisposable(domain):
+		errs["email"] = fmt.Errorf("%w: %s", ErrDisposableEmail, domain)
+	}
+
+	for _, format := range p.barcodeFormats {
+		if !matches(domain, format.domain) {
+			continue
+		}
+		if !format.pattern.MatchString(barcode) {
+			errs["barcode"] = fmt.Errorf("%w %s", ErrInvalidBarcode, format.domain)
+		}
+		break
+	}
+
+	return errs.Filter()
+}
+
+// InviteOnly reports whether users need an invitation code to register.
+func (p *Policy) InviteOnly() bool {
+	return p.inviteOnly
+}
+
+func (p *Policy) isDisposable(domain string) bool {
+	for d := domain; d != ""; {
+		if _, ok := p.disposable[d]; ok {
+			return true
+		}
+		_, d, _ = strings.Cut(d, ".")
+	}
+	return false
+}
+
+// matches reports whether domain is pattern or one of its subdomains.
+func matches(domain string, pattern string) bool {
+	return domain == pattern || strings.HasSuffix(domain, "."+pattern)
+}
+
+func matchesAny(domain string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matches(domain, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if d := normalizeDomain(domain); d != "" {
+			normalized = append(normalized, d)
+		}
+	}
+	return normalized
+}
+
+func parseDomainList(list string) map[string]struct{} {
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := normalizeDomain(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+	return domains
+}
@@ -0,0 +1,78 @@
+package registration
+
+import (
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := New(config.Registration{
+		AllowedDomains:  []string{"astanait.edu.kz", "@Gmail.com", "mailinator.com"},
+		DeniedDomains:   []string{"alumni.astanait.edu.kz"},
+		BlockDisposable: true,
+		BarcodeFormats:  []config.BarcodeFormat{{Domain: "astanait.edu.kz", Pattern: `\d{6}`}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		email   string
+		barcode string
+		field   string
+		wantErr error
+	}{
+		{name: "allowed domain", email: "student@astanait.edu.kz", barcode: "211234"},
+		{name: "allowed subdomain", email: "lecturer@staff.astanait.edu.kz", barcode: "123456"},
+		{name: "domains are case insensitive", email: "Student@GMAIL.COM", barcode: "anything"},
+		{name: "domain not allowed", email: "student@yandex.kz", field: "email", wantErr: ErrDomainNotAllowed},
+		{name: "lookalike domain", email: "student@fakeastanait.edu.kz", field: "email", wantErr: ErrDomainNotAllowed},
+		{name: "denied subdomain", email: "graduate@alumni.astanait.edu.kz", barcode: "211234", field: "email", wantErr: ErrDomainDenied},
+		{name: "disposable domain", email: "bot@mailinator.com", field: "email", wantErr: ErrDisposableEmail},
+		{name: "barcode format", email: "student@astanait.edu.kz", barcode: "21-1234", field: "barcode", wantErr: ErrInvalidBarcode},
+		{name: "barcode must match whole", email: "student@astanait.edu.kz", barcode: "2112345", field: "barcode", wantErr: ErrInvalidBarcode},
+		{name: "no domain", email: "student", field: "email", wantErr: ErrDomainNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(tt.email, tt.barcode)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var errs validation.Errors
+			require.ErrorAs(t, err, &errs)
+			assert.ErrorIs(t, errs[tt.field], tt.wantErr)
+		})
+	}
+}
+
+func TestPolicy_Check_DefaultsAllowAnyDomain(t *testing.T) {
+	p, err := New(config.Registration{})
+	require.NoError(t, err)
+
+	assert.NoError(t, p.Check("someone@example.com", "1"))
+	assert.NoError(t, p.Check("bot@mailinator.com", "1"), "disposable emails are blocked only when configured")
+}
+
+func TestNew_Mode(t *testing.T) {
+	p, err := New(config.Registration{Mode: ModeInviteOnly})
+	require.NoError(t, err)
+	assert.True(t, p.InviteOnly())
+
+	p, err = New(config.Registration{})
+	require.NoError(t, err)
+	assert.False(t, p.InviteOnly())
+
+	_, err = New(config.Registration{Mode: "closed"})
+	assert.Error(t, err)
+}
+
+func TestNew_InvalidBarcodePattern(t *testing.T) {
+	_, err := New(config.Registration{BarcodeFormats: []config.BarcodeFormat{{Domain: "astanait.edu.kz", Pattern: `(\d`}}})
+	assert.Error(t, err)
+}
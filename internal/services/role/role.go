@@ -0,0 +1,262 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrUserNotExist        = errors.New("user does not exist")
+	ErrRoleNotExists       = errors.New("role does not exist")
+	ErrScopedRoleExists    = errors.New("user already has the role in this scope")
+	ErrScopedRoleNotExists = errors.New("user does not have the role in this scope")
+)
+
+// Roles manages the roles users hold within a scope, like a single club. Grants can
+// expire, expired grants are reverted by RunExpiry. Every change is recorded in the
+// audit log.
+type Roles struct {
+	log     *slog.Logger
+	storage Storage
+	amqp    Amqp
+	cfg     config.Roles
+}
+
+type Storage interface {
+	SaveScopedRole(ctx context.Context, scopedRole *domain.ScopedRole) error
+	DeleteScopedRole(ctx context.Context, scopedRole *domain.ScopedRole) error
+	GetUserScopedRoles(ctx context.Context, userID int64) ([]*domain.ScopedRole, error)
+	DeleteExpiredScopedRoles(ctx context.Context) ([]*domain.ScopedRole, error)
+	SaveScopedRoleAudit(ctx context.Context, audit *domain.ScopedRoleAudit) error
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type Amqp interface {
+	Publish(ctx context.Context, routingKey string, msg any) error
+}
+
+func New(log *slog.Logger, storage Storage, amqp Amqp, cfg config.Roles) *Roles {
+	return &Roles{
+		log:     log,
+		storage: storage,
+		amqp:    amqp,
+		cfg:     cfg,
+	}
+}
+
+// scopedRoleEvent is the message published on user.club.role_granted,
+// user.club.role_revoked and user.club.role_expired.
+type scopedRoleEvent struct {
+	UserID    int64       `json:"user_id"`
+	ScopeType string      `json:"scope_type"`
+	ScopeID   int64       `json:"scope_id"`
+	Role      domain.Role `json:"role"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+}
+
+// GrantScopedRole grants the role to the user within the scope, until
+// scopedRole.ExpiresAt if it is set. actor is who grants the role, as recorded in
+// the audit log.
+func (r Roles) GrantScopedRole(ctx context.Context, scopedRole *domain.ScopedRole, actor string) error {
+	const op = "roles.GrantScopedRole"
+	log := r.log.With(slog.String("op", op))
+
+	err := validateScopedRole(scopedRole)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = r.storage.WithTx(ctx, func(ctx context.Context) error {
+		err := r.storage.SaveScopedRole(ctx, scopedRole)
+		if err != nil {
+			return err
+		}
+		return r.storage.SaveScopedRoleAudit(ctx, &domain.ScopedRoleAudit{
+			ScopedRole: *scopedRole,
+			Action:     domain.ScopedRoleGranted,
+			Actor:      actor,
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			return fmt.Errorf("%s: %w", op, ErrUserNotExist)
+		case errors.Is(err, storage.ErrRoleNotExists):
+			return fmt.Errorf("%s: %w", op, ErrRoleNotExists)
+		case errors.Is(err, storage.ErrScopedRoleExists):
+			return fmt.Errorf("%s: %w", op, ErrScopedRoleExists)
+		default:
+			log.Error("failed to save scoped role", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = r.amqp.Publish(ctx, "user.club.role_granted", newScopedRoleEvent(scopedRole))
+	if err != nil {
+		log.Error("failed to publish role granted event", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeScopedRole revokes the role of the user within the scope. actor is who
+// revokes the role, as recorded in the audit log.
+func (r Roles) RevokeScopedRole(ctx context.Context, scopedRole *domain.ScopedRole, actor string) error {
+	const op = "roles.RevokeScopedRole"
+	log := r.log.With(slog.String("op", op))
+
+	err := validateScopedRole(scopedRole)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = r.storage.WithTx(ctx, func(ctx context.Context) error {
+		err := r.storage.DeleteScopedRole(ctx, scopedRole)
+		if err != nil {
+			return err
+		}
+		return r.storage.SaveScopedRoleAudit(ctx, &domain.ScopedRoleAudit{
+			ScopedRole: *scopedRole,
+			Action:     domain.ScopedRoleRevoked,
+			Actor:      actor,
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrScopedRoleNotExists):
+			return fmt.Errorf("%s: %w", op, ErrScopedRoleNotExists)
+		default:
+			log.Error("failed to delete scoped role", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = r.amqp.Publish(ctx, "user.club.role_revoked", newScopedRoleEvent(scopedRole))
+	if err != nil {
+		log.Error("failed to publish role revoked event", logger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ListScopedRoles returns all the scoped roles of the user.
+func (r Roles) ListScopedRoles(ctx context.Context, userID int64) ([]*domain.ScopedRole, error) {
+	const op = "roles.ListScopedRoles"
+	log := r.log.With(slog.String("op", op))
+
+	scopedRoles, err := r.storage.GetUserScopedRoles(ctx, userID)
+	if err != nil {
+		log.Error("failed to get scoped roles", logger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scopedRoles, nil
+}
+
+// ExpireScopedRoles reverts the expired grants and returns how many were reverted.
+func (r Roles) ExpireScopedRoles(ctx context.Context) (int, error) {
+	const op = "roles.ExpireScopedRoles"
+	log := r.log.With(slog.String("op", op))
+
+	var expired []*domain.ScopedRole
+	err := r.storage.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		expired, err = r.storage.DeleteExpiredScopedRoles(ctx)
+		if err != nil {
+			return err
+		}
+		for _, scopedRole := range expired {
+			err = r.storage.SaveScopedRoleAudit(ctx, &domain.ScopedRoleAudit{
+				ScopedRole: *scopedRole,
+				Action:     domain.ScopedRoleExpired,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("failed to delete expired scoped roles", logger.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, scopedRole := range expired {
+		err = r.amqp.Publish(ctx, "user.club.role_expired", newScopedRoleEvent(scopedRole))
+		if err != nil {
+			log.Error("failed to publish role expired event", logger.Err(err))
+		}
+	}
+
+	if len(expired) > 0 {
+		log.Info("expired scoped roles reverted", slog.Int("count", len(expired)))
+	}
+
+	return len(expired), nil
+}
+
+// RunExpiry calls ExpireScopedRoles periodically until ctx is done.
+func (r Roles) RunExpiry(ctx context.Context) {
+	const op = "roles.RunExpiry"
+	log := r.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(r.cfg.ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.ExpireScopedRoles(ctx); err != nil {
+				log.Error("failed to expire scoped roles", logger.Err(err))
+			}
+		}
+	}
+}
+
+func validateScopedRole(scopedRole *domain.ScopedRole) error {
+	return validation.Errors{
+		"user_id":    validation.Validate(scopedRole.UserID, validation.Required, validation.Min(int64(1))),
+		"scope_type": validation.Validate(scopedRole.Scope.Type, validation.Required, validation.In(toAny(domain.RoleScopeTypes)...)),
+		"scope_id":   validation.Validate(scopedRole.Scope.ID, validation.Required, validation.Min(int64(1))),
+		"role":       validation.Validate(scopedRole.Role, validation.Required, validation.In(toAny(domain.Roles)...)),
+		"expires_at": validation.Validate(scopedRole.ExpiresAt, validation.By(inFuture)),
+	}.Filter()
+}
+
+func inFuture(value any) error {
+	expiresAt, _ := value.(*time.Time)
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errors.New("must be in the future")
+	}
+	return nil
+}
+
+func newScopedRoleEvent(scopedRole *domain.ScopedRole) scopedRoleEvent {
+	return scopedRoleEvent{
+		UserID:    scopedRole.UserID,
+		ScopeType: scopedRole.Scope.Type,
+		ScopeID:   scopedRole.Scope.ID,
+		Role:      scopedRole.Role,
+		ExpiresAt: scopedRole.ExpiresAt,
+	}
+}
+
+func toAny[T any](values []T) []any {
+	res := make([]any, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
@@ -0,0 +1,116 @@
+package role
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestRoles_GrantAndExpire(t *testing.T) {
+	ctx := context.Background()
+	rolesStorage := &fakeStorage{}
+	amqp := &fakeAmqp{}
+	r := New(slog.New(slog.NewTextHandler(io.Discard, nil)), rolesStorage, amqp, config.Roles{})
+
+	club := domain.RoleScope{Type: domain.RoleScopeClub, ID: 42}
+	expiresAt := time.Now().Add(time.Hour)
+
+	err := r.GrantScopedRole(ctx, &domain.ScopedRole{UserID: 1, Scope: club, Role: "MODER", ExpiresAt: &expiresAt}, "user:2")
+	require.NoError(t, err)
+	err = r.GrantScopedRole(ctx, &domain.ScopedRole{UserID: 1, Scope: club, Role: "MODER"}, "user:2")
+	assert.ErrorIs(t, err, ErrScopedRoleExists)
+
+	past := time.Now().Add(-time.Minute)
+	err = r.GrantScopedRole(ctx, &domain.ScopedRole{UserID: 3, Scope: club, Role: "MODER", ExpiresAt: &past}, "user:2")
+	assert.Error(t, err, "grants must not expire in the past")
+
+	n, err := r.ExpireScopedRoles(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	rolesStorage.roles[0].ExpiresAt = &past
+	n, err = r.ExpireScopedRoles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, rolesStorage.roles)
+
+	require.Len(t, rolesStorage.audit, 2)
+	assert.Equal(t, domain.ScopedRoleGranted, rolesStorage.audit[0].Action)
+	assert.Equal(t, "user:2", rolesStorage.audit[0].Actor)
+	assert.Equal(t, domain.ScopedRoleExpired, rolesStorage.audit[1].Action)
+	assert.Equal(t, []string{"user.club.role_granted", "user.club.role_expired"}, amqp.routingKeys)
+}
+
+type fakeStorage struct {
+	roles []*domain.ScopedRole
+	audit []*domain.ScopedRoleAudit
+}
+
+func (s *fakeStorage) SaveScopedRole(_ context.Context, scopedRole *domain.ScopedRole) error {
+	for _, r := range s.roles {
+		if r.UserID == scopedRole.UserID && r.Scope == scopedRole.Scope && r.Role == scopedRole.Role {
+			return storage.ErrScopedRoleExists
+		}
+	}
+	copied := *scopedRole
+	s.roles = append(s.roles, &copied)
+	return nil
+}
+
+func (s *fakeStorage) DeleteScopedRole(_ context.Context, scopedRole *domain.ScopedRole) error {
+	for i, r := range s.roles {
+		if r.UserID == scopedRole.UserID && r.Scope == scopedRole.Scope && r.Role == scopedRole.Role {
+			s.roles = append(s.roles[:i], s.roles[i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrScopedRoleNotExists
+}
+
+func (s *fakeStorage) GetUserScopedRoles(_ context.Context, userID int64) ([]*domain.ScopedRole, error) {
+	var roles []*domain.ScopedRole
+	for _, r := range s.roles {
+		if r.UserID == userID {
+			roles = append(roles, r)
+		}
+	}
+	return roles, nil
+}
+
+func (s *fakeStorage) DeleteExpiredScopedRoles(_ context.Context) ([]*domain.ScopedRole, error) {
+	var expired, active []*domain.ScopedRole
+	for _, r := range s.roles {
+		if r.Active(time.Now()) {
+			active = append(active, r)
+		} else {
+			expired = append(expired, r)
+		}
+	}
+	s.roles = active
+	return expired, nil
+}
+
+func (s *fakeStorage) SaveScopedRoleAudit(_ context.Context, audit *domain.ScopedRoleAudit) error {
+	s.audit = append(s.audit, audit)
+	return nil
+}
+
+func (s *fakeStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type fakeAmqp struct {
+	routingKeys []string
+}
+
+func (a *fakeAmqp) Publish(_ context.Context, routingKey string, _ any) error {
+	a.routingKeys = append(a.routingKeys, routingKey)
+	return nil
+}
@@ -0,0 +1,198 @@
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/apikey"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"log/slog"
+	"time"
+)
+
+// lastUsedInterval limits how often the last use of a key is written, so that
+// every authenticated call does not cost a database write.
+const lastUsedInterval = time.Minute
+
+var (
+	ErrServiceAccountExists    = errors.New("service account already exists")
+	ErrServiceAccountNotExists = errors.New("service account does not exists")
+	ErrAPIKeyNotExists         = errors.New("api key does not exists")
+	ErrInvalidAPIKey           = errors.New("invalid api key")
+	ErrAPIKeyExpired           = errors.New("api key has expired")
+	ErrAPIKeyRevoked           = errors.New("api key has been revoked")
+)
+
+// ServiceAccounts manages service accounts and authenticates their API keys.
+type ServiceAccounts struct {
+	log     *slog.Logger
+	storage Storage
+}
+
+type Storage interface {
+	SaveServiceAccount(ctx context.Context, account *domain.ServiceAccount) error
+	GetServiceAccountByName(ctx context.Context, name string) (*domain.ServiceAccount, error)
+	SaveAPIKey(ctx context.Context, key *domain.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error)
+	SetAPIKeyLastUsed(ctx context.Context, keyID int64, usedAt time.Time) error
+	RevokeAPIKey(ctx context.Context, prefix string) error
+}
+
+func New(log *slog.Logger, storage Storage) *ServiceAccounts {
+	return &ServiceAccounts{
+		log:     log,
+		storage: storage,
+	}
+}
+
+func (s ServiceAccounts) CreateServiceAccount(ctx context.Context, name string) (*domain.ServiceAccount, error) {
+	const op = "serviceAccounts.CreateServiceAccount"
+	log := s.log.With(slog.String("op", op))
+
+	err := validation.Validate(name, validation.Required, validation.Length(1, 64))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account := &domain.ServiceAccount{Name: name}
+	err = s.storage.SaveServiceAccount(ctx, account)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrServiceAccountExists):
+			return nil, fmt.Errorf("%s: %w", op, ErrServiceAccountExists)
+		default:
+			log.Error("failed to save service account", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return account, nil
+}
+
+// CreateAPIKey creates a key for the service account with the given scopes. The
+// returned key is not stored and cannot be shown again. A ttl of zero creates a
+// key that does not expire.
+func (s ServiceAccounts) CreateAPIKey(ctx context.Context, accountName string, scopes []string, ttl time.Duration) (string, *domain.APIKey, error) {
+	const op = "serviceAccounts.CreateAPIKey"
+	log := s.log.With(slog.String("op", op))
+
+	err := validation.Validate(scopes, validation.Required, validation.Each(validation.In(toAny(domain.Scopes)...)))
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := s.storage.GetServiceAccountByName(ctx, accountName)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrServiceAccountNotExists):
+			return "", nil, fmt.Errorf("%s: %w", op, ErrServiceAccountNotExists)
+		default:
+			log.Error("failed to get service account", logger.Err(err))
+			return "", nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	apiKey := &domain.APIKey{
+		ServiceAccountID:   account.ID,
+		ServiceAccountName: account.Name,
+		Prefix:             prefix,
+		SecretHash:         hash,
+		Scopes:             scopes,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	err = s.storage.SaveAPIKey(ctx, apiKey)
+	if err != nil {
+		log.Error("failed to save api key", logger.Err(err))
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("api key created", slog.String("service_account", account.Name), slog.String("prefix", prefix))
+
+	return key, apiKey, nil
+}
+
+// RevokeAPIKey revokes the key with the given prefix.
+func (s ServiceAccounts) RevokeAPIKey(ctx context.Context, prefix string) error {
+	const op = "serviceAccounts.RevokeAPIKey"
+	log := s.log.With(slog.String("op", op))
+
+	err := s.storage.RevokeAPIKey(ctx, prefix)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAPIKeyNotExists):
+			return fmt.Errorf("%s: %w", op, ErrAPIKeyNotExists)
+		default:
+			log.Error("failed to revoke api key", logger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("api key revoked", slog.String("prefix", prefix))
+
+	return nil
+}
+
+// Authenticate returns the API key matching key, recording its use.
+func (s ServiceAccounts) Authenticate(ctx context.Context, key string) (*domain.APIKey, error) {
+	const op = "serviceAccounts.Authenticate"
+	log := s.log.With(slog.String("op", op))
+
+	prefix, secret, err := apikey.Parse(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidAPIKey)
+	}
+
+	apiKey, err := s.storage.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAPIKeyNotExists):
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidAPIKey)
+		default:
+			log.Error("failed to get api key", logger.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if !apikey.Verify(secret, apiKey.SecretHash) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidAPIKey)
+	}
+
+	now := time.Now()
+	switch {
+	case apiKey.RevokedAt != nil:
+		log.Warn("revoked api key used", slog.String("prefix", prefix))
+		return nil, fmt.Errorf("%s: %w", op, ErrAPIKeyRevoked)
+	case !apiKey.Active(now):
+		return nil, fmt.Errorf("%s: %w", op, ErrAPIKeyExpired)
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > lastUsedInterval {
+		err = s.storage.SetAPIKeyLastUsed(ctx, apiKey.ID, now)
+		if err != nil {
+			log.Error("failed to record api key use", logger.Err(err))
+		}
+		apiKey.LastUsedAt = &now
+	}
+
+	return apiKey, nil
+}
+
+func toAny(values []string) []any {
+	res := make([]any, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
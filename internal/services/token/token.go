@@ -0,0 +1,538 @@
+package token
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/jwk"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/secretbox"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/token/session"
+	"github.com/golang-jwt/jwt/v5"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// keyRefreshInterval is how often the signing keys are reloaded, so that keys
+// rotated by another instance are picked up.
+const keyRefreshInterval = time.Minute
+
+var (
+	ErrNoSigningKey          = errors.New("no signing key available")
+	ErrInvalidToken          = errors.New("invalid access token")
+	ErrRefreshTokenNotExists = errors.New("refresh token does not exists")
+	ErrRefreshTokenReused    = errors.New("refresh token already used")
+	// ErrRefreshTokenClientMismatch is returned when a refresh token is presented
+	// by a client other than the one it was issued to.
+	ErrRefreshTokenClientMismatch = errors.New("refresh token was issued to another client")
+)
+
+// Tokens mints short-lived Ed25519 signed JWT access tokens and opaque refresh
+// tokens, and rotates the signing keys.
+type Tokens struct {
+	log            *slog.Logger
+	keyStorage     KeyStorage
+	refreshStorage RefreshTokenStorage
+	sessionStorage SessionStorage
+	usrStorage     UserStorage
+	amqp           Amqp
+	box            *secretbox.Box
+	cfg            config.Tokens
+
+	mu   sync.RWMutex
+	keys []signingKey
+}
+
+type KeyStorage interface {
+	SaveSigningKey(ctx context.Context, key *domain.SigningKey) error
+	GetSigningKeys(ctx context.Context, now time.Time) ([]*domain.SigningKey, error)
+	DeleteExpiredSigningKeys(ctx context.Context, now time.Time) error
+}
+
+type RefreshTokenStorage interface {
+	CreateRefreshFamily(ctx context.Context, sessionID string, sessionToken string, clientID string, duration time.Duration) error
+	CreateRefreshToken(ctx context.Context, token string, refresh *domain.RefreshToken, duration time.Duration) error
+	UseRefreshToken(ctx context.Context, token string, clientID string) (*domain.RefreshToken, error)
+	RevokeRefreshFamily(ctx context.Context, sessionID string) error
+}
+
+type SessionStorage interface {
+	Extend(ctx context.Context, sessionToken string, duration time.Duration) error
+	Delete(ctx context.Context, sessionToken string) error
+}
+
+type UserStorage interface {
+	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
+}
+
+type Amqp interface {
+	Publish(ctx context.Context, routingKey string, msg any) error
+}
+
+// Claims are the claims of an access token. The subject is the user id.
+type Claims struct {
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+func (c Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+type signingKey struct {
+	id         string
+	privateKey ed25519.PrivateKey
+}
+
+// New creates the token service. box encrypts the signing keys at rest. RotateKeys
+// must be called before the first token is issued.
+func New(
+	log *slog.Logger,
+	keyStorage KeyStorage,
+	refreshStorage RefreshTokenStorage,
+	sessionStorage SessionStorage,
+	usrStorage UserStorage,
+	amqp Amqp,
+	box *secretbox.Box,
+	cfg config.Tokens,
+) *Tokens {
+	return &Tokens{
+		log:            log,
+		keyStorage:     keyStorage,
+		refreshStorage: refreshStorage,
+		sessionStorage: sessionStorage,
+		usrStorage:     usrStorage,
+		amqp:           amqp,
+		box:            box,
+		cfg:            cfg,
+	}
+}
+
+// SessionID derives the session id carried in access tokens from a session token.
+// The session token itself is a bearer credential and must not be put in a token
+// that downstream services can read.
+func SessionID(sessionToken string) string {
+	sum := sha256.Sum256([]byte(sessionToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// Issue mints an access token for the session of user and the first refresh token
+// of the session's refresh token family. The session is extended to the refresh
+// token ttl, and again on every refresh, so that it lives as long as its refresh
+// tokens.
+func (t *Tokens) Issue(ctx context.Context, user *domain.User, sessionToken string) (accessToken string, refreshToken string, err error) {
+	return t.IssueForClient(ctx, user, sessionToken, "")
+}
+
+// IssueForClient is Issue for the OpenID Connect client clientID. The refresh
+// tokens of the family can only be used by the same client, see RefreshForClient.
+func (t *Tokens) IssueForClient(ctx context.Context, user *domain.User, sessionToken string, clientID string) (accessToken string, refreshToken string, err error) {
+	const op = "token.IssueForClient"
+	log := t.log.With(slog.String("op", op))
+
+	sessionID := SessionID(sessionToken)
+
+	err = t.sessionStorage.Extend(ctx, sessionToken, t.cfg.RefreshTTL)
+	if err != nil {
+		log.Error("can not extend session", logger.Err(err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = t.refreshStorage.CreateRefreshFamily(ctx, sessionID, sessionToken, clientID, t.cfg.RefreshTTL)
+	if err != nil {
+		log.Error("can not save refresh token family", logger.Err(err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, refreshToken, err = t.issue(ctx, user, sessionID)
+	if err != nil {
+		log.Error("can not issue tokens", logger.Err(err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token can be used once. Presenting a used token means it has leaked,
+// so the whole family and its session are revoked, a
+// user.notification.refresh_token_reused event is published and
+// ErrRefreshTokenReused is returned.
+func (t *Tokens) Refresh(ctx context.Context, refreshToken string) (accessToken string, newRefreshToken string, err error) {
+	return t.RefreshForClient(ctx, refreshToken, "")
+}
+
+// RefreshForClient is Refresh for the OpenID Connect client clientID. Tokens
+// issued to another client, or by the gRPC API when clientID is set, are rejected
+// with ErrRefreshTokenClientMismatch and are not used up.
+func (t *Tokens) RefreshForClient(ctx context.Context, refreshToken string, clientID string) (accessToken string, newRefreshToken string, err error) {
+	const op = "token.RefreshForClient"
+	log := t.log.With(slog.String("op", op))
+
+	refresh, err := t.refreshStorage.UseRefreshToken(ctx, refreshToken, clientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTokenNotExists):
+			return "", "", fmt.Errorf("%s: %w", op, ErrRefreshTokenNotExists)
+		case errors.Is(err, storage.ErrTokenClientMismatch):
+			log.Warn("refresh token used by another client", slog.String("client_id", clientID))
+			return "", "", fmt.Errorf("%s: %w", op, ErrRefreshTokenClientMismatch)
+		case errors.Is(err, storage.ErrTokenReused):
+			log.Warn("refresh token reused, revoking session", slog.Int64("user_id", refresh.UserID))
+			t.revokeFamily(ctx, log, refresh)
+			t.publishReuse(ctx, log, refresh)
+			return "", "", fmt.Errorf("%s: %w", op, ErrRefreshTokenReused)
+		default:
+			log.Error("failed to use refresh token", logger.Err(err))
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// refresh tokens must not outlive the session, e.g. after logout, and the
+	// session is kept alive as long as the new refresh token
+	err = t.sessionStorage.Extend(ctx, refresh.SessionToken, t.cfg.RefreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrSessionNotExists):
+			t.revokeFamily(ctx, log, refresh)
+			return "", "", fmt.Errorf("%s: %w", op, ErrRefreshTokenNotExists)
+		default:
+			log.Error("failed to extend session", logger.Err(err))
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	user, err := t.usrStorage.GetUserByID(ctx, refresh.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			t.revokeFamily(ctx, log, refresh)
+			return "", "", fmt.Errorf("%s: %w", op, ErrRefreshTokenNotExists)
+		default:
+			log.Error("failed to get user", logger.Err(err))
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	accessToken, newRefreshToken, err = t.issue(ctx, user, refresh.SessionID)
+	if err != nil {
+		log.Error("can not issue tokens", logger.Err(err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, newRefreshToken, nil
+}
+
+func (t *Tokens) issue(ctx context.Context, user *domain.User, sessionID string) (accessToken string, refreshToken string, err error) {
+	key, ok := t.currentKey()
+	if !ok {
+		return "", "", ErrNoSigningKey
+	}
+
+	now := time.Now()
+
+	jti, err := session.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	claims := Claims{
+		Role:      user.Role.String(),
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.cfg.Issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.cfg.AccessTTL)),
+			ID:        jti,
+		},
+	}
+
+	accessToken, err = sign(key, claims)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err = session.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = t.refreshStorage.CreateRefreshToken(ctx, refreshToken, &domain.RefreshToken{
+		UserID:    user.ID,
+		SessionID: sessionID,
+	}, t.cfg.RefreshTTL)
+	if err != nil {
+		return "", "", fmt.Errorf("can not save refresh token: %w", err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	Nonce      string `json:"nonce,omitempty"`
+	AuthTime   int64  `json:"auth_time"`
+	Email      string `json:"email"`
+	GivenName  string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+// SignIDToken signs an OpenID Connect ID token for user issued by issuer to the
+// client audience. It expires together with the access token issued with it.
+func (t *Tokens) SignIDToken(issuer string, audience string, user *domain.User, nonce string, authTime time.Time) (string, error) {
+	const op = "token.SignIDToken"
+
+	key, ok := t.currentKey()
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, ErrNoSigningKey)
+	}
+
+	now := time.Now()
+
+	idToken, err := sign(key, IDTokenClaims{
+		Nonce:      nonce,
+		AuthTime:   authTime.Unix(),
+		Email:      user.Email,
+		GivenName:  user.FirstName,
+		FamilyName: user.LastName,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.cfg.AccessTTL)),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return idToken, nil
+}
+
+// AccessTTL returns the lifetime of the access tokens.
+func (t *Tokens) AccessTTL() time.Duration {
+	return t.cfg.AccessTTL
+}
+
+func sign(key signingKey, claims jwt.Claims) (string, error) {
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	jwtToken.Header["kid"] = key.id
+
+	return jwtToken.SignedString(key.privateKey)
+}
+
+func (t *Tokens) revokeFamily(ctx context.Context, log *slog.Logger, refresh *domain.RefreshToken) {
+	err := t.refreshStorage.RevokeRefreshFamily(ctx, refresh.SessionID)
+	if err != nil {
+		log.Error("failed to revoke refresh token family", logger.Err(err))
+	}
+
+	err = t.sessionStorage.Delete(ctx, refresh.SessionToken)
+	if err != nil {
+		log.Error("failed to delete session", logger.Err(err))
+	}
+}
+
+func (t *Tokens) publishReuse(ctx context.Context, log *slog.Logger, refresh *domain.RefreshToken) {
+	user, err := t.usrStorage.GetUserByID(ctx, refresh.UserID)
+	if err != nil {
+		log.Error("failed to get user", logger.Err(err))
+		return
+	}
+
+	msg := struct {
+		UserID    int64  `json:"user_id"`
+		Email     string `json:"email"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		SessionID string `json:"session_id"`
+	}{
+		UserID:    user.ID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		SessionID: refresh.SessionID,
+	}
+
+	err = t.amqp.Publish(ctx, "user.notification.refresh_token_reused", msg)
+	if err != nil {
+		log.Error("failed to publish", logger.Err(err))
+	}
+}
+
+// Verify checks the signature, issuer and expiry of an access token and returns
+// its claims.
+func (t *Tokens) Verify(accessToken string) (*Claims, error) {
+	const op = "token.Verify"
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(accessToken, &claims, func(jwtToken *jwt.Token) (any, error) {
+		kid, _ := jwtToken.Header["kid"].(string)
+		key, ok := t.key(kid)
+		if !ok {
+			return nil, ErrNoSigningKey
+		}
+		return key.privateKey.Public(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(t.cfg.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	return &claims, nil
+}
+
+// JWKS returns the JSON Web Key Set of the public keys that tokens may currently
+// be signed with.
+func (t *Tokens) JWKS() ([]byte, error) {
+	const op = "token.JWKS"
+
+	t.mu.RLock()
+	set := jwk.Set{Keys: make([]jwk.Key, 0, len(t.keys))}
+	for _, key := range t.keys {
+		set.Keys = append(set.Keys, jwk.Ed25519(key.id, key.privateKey.Public().(ed25519.PublicKey)))
+	}
+	t.mu.RUnlock()
+
+	raw, err := json.Marshal(set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return raw, nil
+}
+
+// RotateKeys reloads the signing keys and generates a new one when the newest key
+// is older than the rotation interval. Retired keys stay published until the last
+// token they signed has expired, then they are deleted.
+func (t *Tokens) RotateKeys(ctx context.Context) error {
+	const op = "token.RotateKeys"
+	log := t.log.With(slog.String("op", op))
+
+	now := time.Now().UTC()
+
+	stored, err := t.keyStorage.GetSigningKeys(ctx, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(stored) == 0 || now.Sub(stored[0].CreatedAt) >= t.cfg.KeyRotationInterval {
+		key, err := t.generateKey(now)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = t.keyStorage.SaveSigningKey(ctx, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("generated new signing key", slog.String("kid", key.ID))
+		stored = append([]*domain.SigningKey{key}, stored...)
+	}
+
+	keys := make([]signingKey, 0, len(stored))
+	for _, key := range stored {
+		seed, err := t.box.Open(key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("%s: failed to decrypt signing key %s: %w", op, key.ID, err)
+		}
+		keys = append(keys, signingKey{
+			id:         key.ID,
+			privateKey: ed25519.NewKeyFromSeed(seed),
+		})
+	}
+
+	t.mu.Lock()
+	t.keys = keys
+	t.mu.Unlock()
+
+	err = t.keyStorage.DeleteExpiredSigningKeys(ctx, now)
+	if err != nil {
+		log.Error("failed to delete expired signing keys", logger.Err(err))
+	}
+
+	return nil
+}
+
+// RunKeyRotation calls RotateKeys periodically until ctx is done.
+func (t *Tokens) RunKeyRotation(ctx context.Context) {
+	const op = "token.RunKeyRotation"
+	log := t.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(keyRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.RotateKeys(ctx); err != nil {
+				log.Error("failed to rotate signing keys", logger.Err(err))
+			}
+		}
+	}
+}
+
+func (t *Tokens) generateKey(now time.Time) (*domain.SigningKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := t.box.Seal(privateKey.Seed())
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.SigningKey{
+		ID:         jwk.Ed25519("", publicKey).KeyID,
+		PrivateKey: sealed,
+		CreatedAt:  now,
+		// other instances may keep signing with the key until their next refresh
+		ExpiresAt: now.Add(t.cfg.KeyRotationInterval + keyRefreshInterval + t.cfg.AccessTTL),
+	}, nil
+}
+
+// currentKey returns the newest signing key.
+func (t *Tokens) currentKey() (signingKey, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(t.keys) == 0 {
+		return signingKey{}, false
+	}
+
+	return t.keys[0], true
+}
+
+func (t *Tokens) key(kid string) (signingKey, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, key := range t.keys {
+		if key.id == kid {
+			return key, true
+		}
+	}
+
+	return signingKey{}, false
+}
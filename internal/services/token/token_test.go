@@ -0,0 +1,316 @@
+package token
+
+import (
+	"context"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/secretbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+const (
+	testSessionToken = "session-token"
+	// testSessionTTL is the ttl sessions are created with, shorter than the refresh
+	// token ttl.
+	testSessionTTL = 30 * time.Minute
+)
+
+func TestRefresh_RotatesRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	tokens, _ := newTestTokens(t)
+
+	_, refreshToken, err := tokens.Issue(ctx, testUser, testSessionToken)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		accessToken, newRefreshToken, err := tokens.Refresh(ctx, refreshToken)
+		require.NoError(t, err)
+		assert.NotEqual(t, refreshToken, newRefreshToken)
+
+		claims, err := tokens.Verify(accessToken)
+		require.NoError(t, err)
+		assert.Equal(t, "1", claims.Subject)
+		assert.Equal(t, SessionID(testSessionToken), claims.SessionID)
+
+		refreshToken = newRefreshToken
+	}
+}
+
+func TestRefresh_ReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	tokens, deps := newTestTokens(t)
+
+	_, first, err := tokens.Issue(ctx, testUser, testSessionToken)
+	require.NoError(t, err)
+	_, second, err := tokens.Refresh(ctx, first)
+	require.NoError(t, err)
+
+	_, _, err = tokens.Refresh(ctx, first)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.Equal(t, []string{"user.notification.refresh_token_reused"}, deps.amqp.routingKeys)
+
+	// the rotated token of the family and the session are revoked too
+	_, _, err = tokens.Refresh(ctx, second)
+	assert.ErrorIs(t, err, ErrRefreshTokenNotExists)
+	_, ok := deps.sessions.sessions[testSessionToken]
+	assert.False(t, ok)
+}
+
+func TestRefresh_BoundToClient(t *testing.T) {
+	ctx := context.Background()
+	tokens, deps := newTestTokens(t)
+
+	_, refreshToken, err := tokens.IssueForClient(ctx, testUser, testSessionToken, "clubs-web")
+	require.NoError(t, err)
+
+	_, _, err = tokens.RefreshForClient(ctx, refreshToken, "another-client")
+	assert.ErrorIs(t, err, ErrRefreshTokenClientMismatch)
+	_, _, err = tokens.Refresh(ctx, refreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenClientMismatch)
+
+	// rejected attempts do not use the token up
+	_, refreshToken, err = tokens.RefreshForClient(ctx, refreshToken, "clubs-web")
+	require.NoError(t, err)
+	_, _, err = tokens.RefreshForClient(ctx, refreshToken, "clubs-web")
+	require.NoError(t, err)
+
+	deps.sessions.sessions["another-session"] = testUser.ID
+	deps.sessions.expiresAt["another-session"] = deps.refresh.now.Add(testSessionTTL)
+	_, refreshToken, err = tokens.Issue(ctx, testUser, "another-session")
+	require.NoError(t, err)
+	_, _, err = tokens.RefreshForClient(ctx, refreshToken, "clubs-web")
+	assert.ErrorIs(t, err, ErrRefreshTokenClientMismatch)
+}
+
+func TestRefresh_Expiry(t *testing.T) {
+	ctx := context.Background()
+	tokens, deps := newTestTokens(t)
+
+	_, refreshToken, err := tokens.Issue(ctx, testUser, testSessionToken)
+	require.NoError(t, err)
+
+	deps.refresh.now = deps.refresh.now.Add(tokens.cfg.RefreshTTL - time.Second)
+	_, refreshToken, err = tokens.Refresh(ctx, refreshToken)
+	require.NoError(t, err, "a token is valid until the refresh ttl")
+
+	// rotation extends the family, so only the unused token expires
+	deps.refresh.now = deps.refresh.now.Add(tokens.cfg.RefreshTTL - time.Second)
+	_, _, err = tokens.Refresh(ctx, refreshToken)
+	require.NoError(t, err)
+
+	_, refreshToken, err = tokens.Issue(ctx, testUser, testSessionToken)
+	require.NoError(t, err)
+	deps.refresh.now = deps.refresh.now.Add(tokens.cfg.RefreshTTL)
+	_, _, err = tokens.Refresh(ctx, refreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenNotExists)
+}
+
+func TestRefresh_ExtendsSession(t *testing.T) {
+	ctx := context.Background()
+	tokens, deps := newTestTokens(t)
+
+	_, refreshToken, err := tokens.Issue(ctx, testUser, testSessionToken)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		deps.refresh.now = deps.refresh.now.Add(testSessionTTL + time.Minute)
+		_, refreshToken, err = tokens.Refresh(ctx, refreshToken)
+		require.NoError(t, err, "refresh tokens outlive the ttl the session was created with")
+	}
+
+	_, ok := deps.sessions.sessions[testSessionToken]
+	assert.True(t, ok)
+	assert.Equal(t, deps.refresh.now.Add(tokens.cfg.RefreshTTL), deps.sessions.expiresAt[testSessionToken])
+}
+
+func TestRefresh_EndedSession(t *testing.T) {
+	ctx := context.Background()
+	tokens, deps := newTestTokens(t)
+
+	_, refreshToken, err := tokens.Issue(ctx, testUser, testSessionToken)
+	require.NoError(t, err)
+
+	delete(deps.sessions.sessions, testSessionToken)
+
+	_, _, err = tokens.Refresh(ctx, refreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenNotExists)
+	assert.Empty(t, deps.refresh.families, "the family of an ended session is revoked")
+}
+
+var testUser = &domain.User{ID: 1, Email: "student@astanait.edu.kz", Role: domain.RoleUser}
+
+type testDeps struct {
+	refresh  *fakeRefreshStorage
+	sessions *fakeSessionStorage
+	amqp     *fakeAmqp
+}
+
+func newTestTokens(t *testing.T) (*Tokens, testDeps) {
+	t.Helper()
+
+	box, err := secretbox.New(make([]byte, 32))
+	require.NoError(t, err)
+
+	deps := testDeps{
+		refresh: &fakeRefreshStorage{
+			now:      time.Now(),
+			families: map[string]*fakeFamily{},
+			tokens:   map[string]*fakeRefreshToken{},
+		},
+		amqp: &fakeAmqp{},
+	}
+	deps.sessions = &fakeSessionStorage{
+		now:       &deps.refresh.now,
+		sessions:  map[string]int64{testSessionToken: testUser.ID},
+		expiresAt: map[string]time.Time{testSessionToken: deps.refresh.now.Add(testSessionTTL)},
+	}
+	users := &fakeUserStorage{users: map[int64]*domain.User{testUser.ID: testUser}}
+
+	tokens := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		&fakeKeyStorage{},
+		deps.refresh,
+		deps.sessions,
+		users,
+		deps.amqp,
+		box,
+		config.Tokens{
+			Issuer:              "test",
+			AccessTTL:           time.Minute,
+			RefreshTTL:          time.Hour,
+			KeyRotationInterval: time.Hour,
+		},
+	)
+	require.NoError(t, tokens.RotateKeys(context.Background()))
+
+	return tokens, deps
+}
+
+type fakeKeyStorage struct {
+	keys []*domain.SigningKey
+}
+
+func (s *fakeKeyStorage) SaveSigningKey(_ context.Context, key *domain.SigningKey) error {
+	s.keys = append([]*domain.SigningKey{key}, s.keys...)
+	return nil
+}
+
+func (s *fakeKeyStorage) GetSigningKeys(_ context.Context, _ time.Time) ([]*domain.SigningKey, error) {
+	return s.keys, nil
+}
+
+func (s *fakeKeyStorage) DeleteExpiredSigningKeys(_ context.Context, _ time.Time) error {
+	return nil
+}
+
+// fakeRefreshStorage keeps refresh tokens like the redis storage does, expiring
+// them by its own clock.
+type fakeRefreshStorage struct {
+	now      time.Time
+	families map[string]*fakeFamily
+	tokens   map[string]*fakeRefreshToken
+}
+
+type fakeFamily struct {
+	sessionToken string
+	clientID     string
+	expiresAt    time.Time
+}
+
+type fakeRefreshToken struct {
+	refresh   domain.RefreshToken
+	used      bool
+	expiresAt time.Time
+}
+
+func (s *fakeRefreshStorage) CreateRefreshFamily(_ context.Context, sessionID string, sessionToken string, clientID string, duration time.Duration) error {
+	s.families[sessionID] = &fakeFamily{sessionToken: sessionToken, clientID: clientID, expiresAt: s.now.Add(duration)}
+	return nil
+}
+
+func (s *fakeRefreshStorage) CreateRefreshToken(_ context.Context, token string, refresh *domain.RefreshToken, duration time.Duration) error {
+	s.tokens[token] = &fakeRefreshToken{refresh: *refresh, expiresAt: s.now.Add(duration)}
+	if family, ok := s.families[refresh.SessionID]; ok {
+		family.expiresAt = s.now.Add(duration)
+	}
+	return nil
+}
+
+func (s *fakeRefreshStorage) UseRefreshToken(_ context.Context, token string, clientID string) (*domain.RefreshToken, error) {
+	stored, ok := s.tokens[token]
+	if !ok || !s.now.Before(stored.expiresAt) {
+		return nil, storage.ErrTokenNotExists
+	}
+	family, ok := s.families[stored.refresh.SessionID]
+	if !ok || !s.now.Before(family.expiresAt) {
+		return nil, storage.ErrTokenNotExists
+	}
+	if family.clientID != clientID {
+		return nil, storage.ErrTokenClientMismatch
+	}
+
+	refresh := stored.refresh
+	refresh.SessionToken = family.sessionToken
+	refresh.ClientID = clientID
+	if stored.used {
+		return &refresh, storage.ErrTokenReused
+	}
+	stored.used = true
+
+	return &refresh, nil
+}
+
+func (s *fakeRefreshStorage) RevokeRefreshFamily(_ context.Context, sessionID string) error {
+	delete(s.families, sessionID)
+	return nil
+}
+
+// fakeSessionStorage expires sessions by the clock of fakeRefreshStorage.
+type fakeSessionStorage struct {
+	now       *time.Time
+	sessions  map[string]int64
+	expiresAt map[string]time.Time
+}
+
+func (s *fakeSessionStorage) Extend(_ context.Context, token string, duration time.Duration) error {
+	_, ok := s.sessions[token]
+	if !ok || !s.now.Before(s.expiresAt[token]) {
+		return storage.ErrSessionNotExists
+	}
+	s.expiresAt[token] = s.now.Add(duration)
+	return nil
+}
+
+func (s *fakeSessionStorage) Delete(_ context.Context, token string) error {
+	delete(s.sessions, token)
+	delete(s.expiresAt, token)
+	return nil
+}
+
+type fakeUserStorage struct {
+	users map[int64]*domain.User
+}
+
+func (s *fakeUserStorage) GetUserByID(_ context.Context, userID int64) (*domain.User, error) {
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, storage.ErrUserNotExists
+	}
+	copied := *user
+	return &copied, nil
+}
+
+type fakeAmqp struct {
+	routingKeys []string
+}
+
+func (a *fakeAmqp) Publish(_ context.Context, routingKey string, _ any) error {
+	a.routingKeys = append(a.routingKeys, routingKey)
+	return nil
+}
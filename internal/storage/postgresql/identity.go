@@ -0,0 +1,51 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s *Storage) SaveIdentity(ctx context.Context, identity *domain.Identity) error {
+	const op = "storage.postgresql.SaveIdentity"
+
+	query := `
+		INSERT INTO user_identities(user_id, issuer, subject, email)
+		VALUES($1, $2, $3, $4)
+		RETURNING id, created_at;
+	`
+
+	err := s.conn(ctx).QueryRow(ctx, query, identity.UserID, identity.Issuer, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("%s: %w", op, storage.ErrIdentityExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetUserIDByIdentity returns the user linked to the external account.
+func (s *Storage) GetUserIDByIdentity(ctx context.Context, issuer string, subject string) (int64, error) {
+	const op = "storage.postgresql.GetUserIDByIdentity"
+
+	var userID int64
+	err := s.conn(ctx).QueryRow(ctx, `
+		SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2;
+	`, issuer, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrIdentityNotExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,116 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const impersonationColumns = `id, impersonator_id, user_id, started_at, expires_at, ended_at, end_reason`
+
+// SaveImpersonation records the start of the impersonation, which expires after ttl.
+func (s *Storage) SaveImpersonation(ctx context.Context, impersonation *domain.Impersonation, ttl time.Duration) error {
+	const op = "storage.postgresql.SaveImpersonation"
+
+	err := s.conn(ctx).QueryRow(ctx, `
+		INSERT INTO impersonations(impersonator_id, user_id, expires_at)
+		VALUES($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))
+		RETURNING id, started_at, expires_at;
+	`, impersonation.ImpersonatorID, impersonation.UserID, ttl.Seconds()).Scan(
+		&impersonation.ID,
+		&impersonation.StartedAt,
+		&impersonation.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetImpersonation(ctx context.Context, id int64) (*domain.Impersonation, error) {
+	const op = "storage.postgresql.GetImpersonation"
+
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+impersonationColumns+` FROM impersonations WHERE id = $1;`, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	impersonation, err := pgx.CollectExactlyOneRow(rows, scanImpersonation)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrImpersonationNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return impersonation, nil
+}
+
+// EndImpersonation records the end of the impersonation. ErrImpersonationNotExists
+// is returned if it has already ended.
+func (s *Storage) EndImpersonation(ctx context.Context, id int64, reason string) (*domain.Impersonation, error) {
+	const op = "storage.postgresql.EndImpersonation"
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		UPDATE impersonations
+		SET ended_at = CURRENT_TIMESTAMP, end_reason = $2
+		WHERE id = $1 AND ended_at IS NULL
+		RETURNING `+impersonationColumns+`;
+	`, id, reason)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	impersonation, err := pgx.CollectExactlyOneRow(rows, scanImpersonation)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrImpersonationNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return impersonation, nil
+}
+
+// EndExpiredImpersonations records the end of the expired impersonations and returns
+// them. Each impersonation is returned by only one call, even when called
+// concurrently.
+func (s *Storage) EndExpiredImpersonations(ctx context.Context) ([]*domain.Impersonation, error) {
+	const op = "storage.postgresql.EndExpiredImpersonations"
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		UPDATE impersonations
+		SET ended_at = expires_at, end_reason = $1
+		WHERE ended_at IS NULL AND expires_at <= CURRENT_TIMESTAMP
+		RETURNING `+impersonationColumns+`;
+	`, domain.ImpersonationExpired)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	impersonations, err := pgx.CollectRows(rows, scanImpersonation)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return impersonations, nil
+}
+
+func scanImpersonation(row pgx.CollectableRow) (*domain.Impersonation, error) {
+	var impersonation domain.Impersonation
+	err := row.Scan(
+		&impersonation.ID,
+		&impersonation.ImpersonatorID,
+		&impersonation.UserID,
+		&impersonation.StartedAt,
+		&impersonation.ExpiresAt,
+		&impersonation.EndedAt,
+		&impersonation.EndReason,
+	)
+	return &impersonation, err
+}
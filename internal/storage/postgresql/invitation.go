@@ -0,0 +1,130 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+const invitationColumns = `id, code_hash, email, role, max_uses, uses, created_by, created_at, expires_at, revoked_at`
+
+func (s *Storage) SaveInvitation(ctx context.Context, invitation *domain.Invitation) error {
+	const op = "storage.postgresql.SaveInvitation"
+
+	err := s.conn(ctx).QueryRow(ctx, `
+		INSERT INTO invitations(code_hash, email, role, max_uses, created_by, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at;
+	`,
+		invitation.CodeHash,
+		invitation.Email,
+		invitation.Role.String(),
+		invitation.MaxUses,
+		invitation.CreatedBy,
+		invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetInvitationByCodeHash(ctx context.Context, codeHash []byte) (*domain.Invitation, error) {
+	const op = "storage.postgresql.GetInvitationByCodeHash"
+
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE code_hash = $1;`, codeHash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	invitation, err := pgx.CollectExactlyOneRow(rows, scanInvitation)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrInvitationNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return invitation, nil
+}
+
+// GetInvitations returns all the invitations, the most recent first.
+func (s *Storage) GetInvitations(ctx context.Context) ([]*domain.Invitation, error) {
+	const op = "storage.postgresql.GetInvitations"
+
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+invitationColumns+` FROM invitations ORDER BY id DESC;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	invitations, err := pgx.CollectRows(rows, scanInvitation)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return invitations, nil
+}
+
+// UseInvitation counts a use of the invitation. ErrInvitationUsedUp is returned if
+// it has been used up, revoked or has expired in the meantime.
+func (s *Storage) UseInvitation(ctx context.Context, invitationID int64) error {
+	const op = "storage.postgresql.UseInvitation"
+
+	result, err := s.conn(ctx).Exec(ctx, `
+		UPDATE invitations
+		SET uses = uses + 1
+		WHERE id = $1 AND uses < max_uses AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP);
+	`, invitationID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrInvitationUsedUp)
+	}
+
+	return nil
+}
+
+func (s *Storage) RevokeInvitation(ctx context.Context, invitationID int64) error {
+	const op = "storage.postgresql.RevokeInvitation"
+
+	result, err := s.conn(ctx).Exec(ctx, `
+		UPDATE invitations SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL;
+	`, invitationID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrInvitationNotExists)
+	}
+
+	return nil
+}
+
+func scanInvitation(row pgx.CollectableRow) (*domain.Invitation, error) {
+	var invitation domain.Invitation
+	var role string
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.CodeHash,
+		&invitation.Email,
+		&role,
+		&invitation.MaxUses,
+		&invitation.Uses,
+		&invitation.CreatedBy,
+		&invitation.CreatedAt,
+		&invitation.ExpiresAt,
+		&invitation.RevokedAt,
+	)
+	// the role is empty for the default role, which domain.Role does not scan
+	invitation.Role = domain.Role(role)
+	return &invitation, err
+}
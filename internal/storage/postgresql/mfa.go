@@ -0,0 +1,137 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveMFASecret starts a new, not yet enabled, TOTP enrolment of the user replacing
+// any previous one.
+func (s *Storage) SaveMFASecret(ctx context.Context, userID int64, secret []byte) error {
+	const op = "storage.postgresql.SaveMFASecret"
+
+	query := `
+		INSERT INTO user_mfa(user_id, secret)
+		VALUES($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, enabled = false, last_used_step = 0, created_at = CURRENT_TIMESTAMP;
+	`
+
+	_, err := s.conn(ctx).Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetMFA(ctx context.Context, userID int64) (*domain.MFA, error) {
+	const op = "storage.postgresql.GetMFA"
+
+	mfa := domain.MFA{}
+
+	err := s.conn(ctx).QueryRow(ctx, `
+		SELECT user_id, secret, enabled, last_used_step
+		FROM user_mfa
+		WHERE user_id = $1;
+	`, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrMFANotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &mfa, nil
+}
+
+// EnableMFA enables the pending enrolment of the user and replaces its recovery codes.
+func (s *Storage) EnableMFA(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	const op = "storage.postgresql.EnableMFA"
+
+	err := s.WithTx(ctx, func(ctx context.Context) error {
+		result, err := s.conn(ctx).Exec(ctx, `UPDATE user_mfa SET enabled = true WHERE user_id = $1;`, userID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return storage.ErrMFANotExists
+		}
+
+		_, err = s.conn(ctx).Exec(ctx, `DELETE FROM user_mfa_recovery_codes WHERE user_id = $1;`, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.conn(ctx).Exec(ctx, `
+			INSERT INTO user_mfa_recovery_codes(user_id, code_hash)
+			SELECT $1, unnest($2::text[]);
+		`, userID, recoveryCodeHashes)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetMFALastUsedStep records the time step of an accepted code. ErrCodeAlreadyUsed is
+// returned if a code of the same or a later step was accepted before.
+func (s *Storage) SetMFALastUsedStep(ctx context.Context, userID int64, step int64) error {
+	const op = "storage.postgresql.SetMFALastUsedStep"
+
+	result, err := s.conn(ctx).Exec(ctx, `
+		UPDATE user_mfa SET last_used_step = $2
+		WHERE user_id = $1 and last_used_step < $2;
+	`, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrCodeAlreadyUsed)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used. ErrCodeAlreadyUsed
+// is returned if there is no such unused code.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	const op = "storage.postgresql.UseRecoveryCode"
+
+	result, err := s.conn(ctx).Exec(ctx, `
+		UPDATE user_mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 and code_hash = $2 and used_at IS NULL;
+	`, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrCodeAlreadyUsed)
+	}
+
+	return nil
+}
+
+// DeleteMFA removes the second factor of the user together with its recovery codes.
+func (s *Storage) DeleteMFA(ctx context.Context, userID int64) error {
+	const op = "storage.postgresql.DeleteMFA"
+
+	result, err := s.conn(ctx).Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1;`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFANotExists)
+	}
+
+	return nil
+}
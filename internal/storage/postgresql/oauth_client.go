@@ -0,0 +1,36 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	const op = "storage.postgresql.GetOAuthClient"
+
+	var (
+		client     domain.OAuthClient
+		secretHash *string
+	)
+
+	err := s.conn(ctx).QueryRow(ctx, `
+		SELECT id, secret_hash, name, redirect_uris
+		FROM oauth_clients
+		WHERE id = $1;
+	`, clientID).Scan(&client.ID, &secretHash, &client.Name, &client.RedirectURIs)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrClientNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if secretHash != nil {
+		client.SecretHash = *secretHash
+	}
+
+	return &client, nil
+}
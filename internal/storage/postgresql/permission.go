@@ -0,0 +1,108 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetRolePermissions returns the names of the permissions granted to the role.
+func (s *Storage) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	const op = "storage.postgresql.GetRolePermissions"
+
+	_, err := s.roleID(ctx, role)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		SELECT p.name
+		FROM role_permissions rp
+		JOIN roles r ON rp.role_id = r.id
+		JOIN permissions p ON rp.permission_id = p.id
+		WHERE r.name = $1
+		ORDER BY p.name;
+	`, role)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	permissions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permissions, nil
+}
+
+// GrantPermission grants the permission to the role, granting it again does
+// nothing.
+func (s *Storage) GrantPermission(ctx context.Context, role string, permission string) error {
+	const op = "storage.postgresql.GrantPermission"
+
+	roleID, permissionID, err := s.rolePermissionIDs(ctx, role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.conn(ctx).Exec(ctx, `
+		INSERT INTO role_permissions(role_id, permission_id) VALUES($1, $2)
+		ON CONFLICT DO NOTHING;
+	`, roleID, permissionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokePermission revokes the permission from the role, revoking a permission
+// that is not granted does nothing.
+func (s *Storage) RevokePermission(ctx context.Context, role string, permission string) error {
+	const op = "storage.postgresql.RevokePermission"
+
+	roleID, permissionID, err := s.rolePermissionIDs(ctx, role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.conn(ctx).Exec(ctx, `
+		DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2;
+	`, roleID, permissionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) rolePermissionIDs(ctx context.Context, role string, permission string) (roleID int64, permissionID int64, err error) {
+	roleID, err = s.roleID(ctx, role)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = s.conn(ctx).QueryRow(ctx, `SELECT id FROM permissions WHERE name = $1;`, permission).Scan(&permissionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, storage.ErrPermissionNotExists
+		}
+		return 0, 0, err
+	}
+
+	return roleID, permissionID, nil
+}
+
+func (s *Storage) roleID(ctx context.Context, role string) (roleID int64, err error) {
+	err = s.conn(ctx).QueryRow(ctx, `SELECT id FROM roles WHERE name = $1;`, role).Scan(&roleID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, storage.ErrRoleNotExists
+		}
+		return 0, err
+	}
+
+	return roleID, nil
+}
@@ -2,49 +2,121 @@ package postgresql
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/config"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
 	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
 	"time"
 )
 
 type Storage struct {
-	DB *sql.DB
+	DB *pgxpool.Pool
 }
 
-func New(databaseDSN string) (*Storage, error) {
+// querier is implemented by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txKey struct{}
+
+func New(databaseDSN string, cfg config.Postgres) (*Storage, error) {
 	const op = "storage.postgresql.New"
 
-	db, err := sql.Open("pgx", databaseDSN)
+	poolCfg, err := pgxpool.ParseConfig(databaseDSN)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = db.Ping()
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.StatementCacheCapacity > 0 {
+		poolCfg.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Storage{DB: db}, nil
+	err = pool.Ping(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{DB: pool}, nil
 }
 
+func (s *Storage) Close() {
+	s.DB.Close()
+}
+
+// WithTx runs fn in a single transaction. Every storage call made with the context
+// passed to fn joins that transaction; the transaction is committed when fn returns nil
+// and rolled back otherwise. Nested calls reuse the outer transaction.
+func (s *Storage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	const op = "storage.postgresql.WithTx"
+
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = fn(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// conn returns the transaction stored in ctx, or the pool when there is none.
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return s.DB
+}
+
+const userColumns = `
+	u.id, u.email, u.pass_hash, u.first_name, u.last_name, u.avatar_url, u.created_at, u.barcode, u.major, u.group_name, u.year, u.version, u.phone_number, u.phone_verified_at, r.name as role
+`
+
 func (s *Storage) SaveUser(ctx context.Context, user *domain.User) error {
 	const op = "storage.postgresql.SaveUser"
 
-	stmt, err := s.DB.Prepare(`
+	query := `
 		INSERT INTO users(email, pass_hash, first_name, last_name, barcode, major, group_name, year, role_id)
 		values($1, $2, $3, $4, $5, $6, $7, $8, DEFAULT)
 		returning id;
-	`)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-
-	defer stmt.Close()
+	`
 
 	args := []any{
 		user.Email,
@@ -57,9 +129,7 @@ func (s *Storage) SaveUser(ctx context.Context, user *domain.User) error {
 		user.Year,
 	}
 
-	result := stmt.QueryRowContext(ctx, args...)
-
-	err = result.Scan(&user.ID)
+	err := s.conn(ctx).QueryRow(ctx, query, args...).Scan(&user.ID)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -76,89 +146,104 @@ func (s *Storage) SaveUser(ctx context.Context, user *domain.User) error {
 func (s *Storage) GetUserByID(ctx context.Context, userID int64) (*domain.User, error) {
 	const op = "storage.postgresql.GetUserByID"
 
-	stmt, err := s.DB.Prepare(`
-		SELECT u.id, u.email, u.pass_hash, u.first_name, u.last_name, u.avatar_url, u.created_at, u.barcode, u.major, u.group_name, u.year, r.name as role
+	query := `SELECT` + userColumns + `
 		FROM users u LEFT JOIN roles r
 		ON  u.role_id = r.id
 		WHERE u.id = $1;
-	`)
+	`
+
+	user, err := scanUser(s.conn(ctx).QueryRow(ctx, query, userID))
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	defer stmt.Close()
+	return user, nil
+}
 
-	result := stmt.QueryRowContext(ctx, userID)
-	user := domain.User{}
+// GetUserByIDForUpdate is like GetUserByID but locks the user row until the end of
+// the surrounding transaction. It must be called inside WithTx.
+func (s *Storage) GetUserByIDForUpdate(ctx context.Context, userID int64) (*domain.User, error) {
+	const op = "storage.postgresql.GetUserByIDForUpdate"
 
-	err = result.Scan(
-		&user.ID, &user.Email, &user.PasswordHash,
-		&user.FirstName, &user.LastName, &user.AvatarURL,
-		&user.CreatedAt, &user.Barcode, &user.Major,
-		&user.GroupName, &user.Year, &user.Role,
-	)
+	query := `SELECT` + userColumns + `
+		FROM users u LEFT JOIN roles r
+		ON  u.role_id = r.id
+		WHERE u.id = $1
+		FOR UPDATE OF u;
+	`
+
+	user, err := scanUser(s.conn(ctx).QueryRow(ctx, query, userID))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
-		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (s *Storage) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
 	const op = "storage.postgresql.GetUserByEmail"
 
-	stmt, err := s.DB.Prepare(`
-		SELECT u.id, u.email, u.pass_hash, u.first_name, u.last_name, u.avatar_url, u.created_at, u.barcode, u.major, u.group_name, u.year, r.name as role
+	query := `SELECT` + userColumns + `
 		FROM users u LEFT JOIN roles r
 		ON  u.role_id = r.id
 		WHERE u.email = $1 and u.activated;
-	`)
+	`
+
+	user, err := scanUser(s.conn(ctx).QueryRow(ctx, query, email))
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	defer stmt.Close()
+	return user, nil
+}
 
-	result := stmt.QueryRowContext(ctx, email)
+func scanUser(row pgx.Row) (*domain.User, error) {
 	user := domain.User{}
 
-	err = result.Scan(
+	err := row.Scan(
 		&user.ID, &user.Email, &user.PasswordHash,
 		&user.FirstName, &user.LastName, &user.AvatarURL,
 		&user.CreatedAt, &user.Barcode, &user.Major,
-		&user.GroupName, &user.Year, &user.Role,
+		&user.GroupName, &user.Year, &user.Version,
+		&user.PhoneNumber, &user.PhoneVerifiedAt, &user.Role,
 	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrUserNotExists
 		}
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
 	return &user, nil
 }
 
-func (s *Storage) GetUserRoleByID(ctx context.Context, userID int64) (role string, err error) {
+// EmailExists reports whether any user, activated or not, has the email.
+func (s *Storage) EmailExists(ctx context.Context, email string) (bool, error) {
+	const op = "storage.postgresql.EmailExists"
+
+	var exists bool
+
+	err := s.conn(ctx).QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1);`, email).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) GetUserRoleByID(ctx context.Context, userID int64) (role domain.Role, err error) {
 	const op = "storage.postgresql.GetUserRoleByID"
 
-	stmt, err := s.DB.Prepare(`
+	query := `
 		SELECT r.name
 		FROM users u left join roles r 
 		ON u.role_id = r.id
 		where u.id = $1 and u.activated;
-	`)
-	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
-	}
-
-	defer stmt.Close()
+	`
 
-	err = stmt.QueryRowContext(ctx, userID).Scan(&role)
+	err = s.conn(ctx).QueryRow(ctx, query, userID).Scan(&role)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return "", fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
 		}
 		return "", fmt.Errorf("%s: %w", op, err)
@@ -167,93 +252,165 @@ func (s *Storage) GetUserRoleByID(ctx context.Context, userID int64) (role strin
 	return role, nil
 }
 
-func (s *Storage) UpdateUser(ctx context.Context, user *domain.User) error {
+// UpdateUser writes the given fields of user only if its version still matches
+// user.Version, bumps the version and reads the updated row back into user.
+// ErrEditConflict is returned when the user was modified since it was read.
+func (s *Storage) UpdateUser(ctx context.Context, user *domain.User, fields []string) error {
 	const op = "storage.postgresql.UpdateUser"
 
-	stmt, err := s.DB.Prepare(`
-		UPDATE users
-		SET email = $2, first_name = $3, last_name = $4,
-		    phone_number = $5, barcode = $6, major = $7,
-		    group_name = $8, year = $9, avatar_url = $10
-		WHERE id = $1 and activated;
-	`)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	if len(fields) == 0 {
+		return fmt.Errorf("%s: no fields to update", op)
 	}
-	defer stmt.Close()
 
-	args := []any{
-		user.ID,
-		user.Email,
-		user.FirstName,
-		user.LastName,
-		user.PhoneNumber,
-		user.Barcode,
-		user.Major,
-		user.GroupName,
-		user.Year,
-		user.AvatarURL,
+	args := []any{user.ID, user.Version}
+	set := make([]string, 0, len(fields)+1)
+	for _, field := range fields {
+		value, ok := user.FieldValue(field)
+		if !ok {
+			return fmt.Errorf("%s: unknown field %q", op, field)
+		}
+		args = append(args, value)
+		// field names are whitelisted by FieldValue and match the column names
+		set = append(set, fmt.Sprintf("%s = $%d", field, len(args)))
 	}
-	result, err := stmt.ExecContext(ctx, args...)
+	set = append(set, "version = version + 1")
+
+	query := `
+		WITH u AS (
+			UPDATE users
+			SET ` + strings.Join(set, ", ") + `
+			WHERE id = $1 and activated and version = $2
+			RETURNING *
+		)
+		SELECT` + userColumns + `
+		FROM u LEFT JOIN roles r
+		ON  u.role_id = r.id;
+	`
+
+	updated, err := scanUser(s.conn(ctx).QueryRow(ctx, query, args...))
 	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, storage.ErrUserNotExists):
+			return fmt.Errorf("%s: %w", op, s.updateMissReason(ctx, user.ID))
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	*user = *updated
+
+	return nil
+}
+
+// updateMissReason tells apart a missing user from a version mismatch after a
+// conditional update matched no rows.
+func (s *Storage) updateMissReason(ctx context.Context, userID int64) error {
+	var exists bool
+
+	err := s.conn(ctx).QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 and activated);`, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return storage.ErrUserNotExists
+	}
+
+	return storage.ErrEditConflict
+}
+
+// SetPhoneVerified sets the phone number of the user and marks it as verified.
+func (s *Storage) SetPhoneVerified(ctx context.Context, userID int64, phoneNumber string) error {
+	const op = "storage.postgresql.SetPhoneVerified"
+
+	query := `
+		UPDATE users
+		SET phone_number = $2, phone_verified_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1 and activated;
+	`
 
-	rowsAffected, err := result.RowsAffected()
+	result, err := s.conn(ctx).Exec(ctx, query, userID, phoneNumber)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	if rowsAffected == 0 {
+
+	if result.RowsAffected() == 0 {
 		return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
 	}
 
 	return nil
 }
 
-func (s *Storage) DeleteUserByID(ctx context.Context, userID int64) error {
-	const op = "storage.postgresql.DeleteUserByID"
+// RehashPassword replaces the password hash of the user with newHash, unless it has
+// changed from oldHash in the meantime.
+func (s *Storage) RehashPassword(ctx context.Context, userID int64, oldHash []byte, newHash []byte) error {
+	const op = "storage.postgresql.RehashPassword"
 
-	stmt, err := s.DB.Prepare(`DELETE FROM users WHERE id = $1 and activated;`)
+	query := `
+		UPDATE users
+		SET pass_hash = $3
+		WHERE id = $1 and pass_hash = $2;
+	`
+
+	result, err := s.conn(ctx).Exec(ctx, query, userID, oldHash, newHash)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	result, err := stmt.ExecContext(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return nil
+}
+
+// SetUserRole changes the role of the user to the role with the given name.
+func (s *Storage) SetUserRole(ctx context.Context, userID int64, role domain.Role) error {
+	const op = "storage.postgresql.SetUserRole"
+
+	query := `
+		UPDATE users u
+		SET role_id = r.id, version = u.version + 1
+		FROM roles r
+		WHERE u.id = $1 AND r.name = $2;
+	`
+
+	result, err := s.conn(ctx).Exec(ctx, query, userID, role)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	if rowsAffected == 0 {
+
+	if result.RowsAffected() == 0 {
 		return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
 	}
 
 	return nil
 }
 
-func (s *Storage) ActivateUser(ctx context.Context, userID int64) error {
-	const op = "storage.postgresql.ActivateUser"
+func (s *Storage) DeleteUserByID(ctx context.Context, userID int64) error {
+	const op = "storage.postgresql.DeleteUserByID"
 
-	stmt, err := s.DB.Prepare(`UPDATE users SET activated = true  WHERE id = $1;`)
+	result, err := s.conn(ctx).Exec(ctx, `DELETE FROM users WHERE id = $1 and activated;`, userID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	result, err := stmt.ExecContext(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return nil
+}
+
+func (s *Storage) ActivateUser(ctx context.Context, userID int64) error {
+	const op = "storage.postgresql.ActivateUser"
+
+	result, err := s.conn(ctx).Exec(ctx, `UPDATE users SET activated = true  WHERE id = $1;`, userID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	if rowsAffected == 0 {
+
+	if result.RowsAffected() == 0 {
 		return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
 	}
 
@@ -263,11 +420,11 @@ func (s *Storage) ActivateUser(ctx context.Context, userID int64) error {
 func (s *Storage) GetAll(ctx context.Context, query string, filters domain.Filters) ([]*domain.User, domain.Metadata, error) {
 	const op = "storage.postgresql.GetAll"
 
-	stmt, err := s.DB.Prepare(`
+	stmt := `
 		SELECT count(*) OVER(), u.id,
 		       u.email, u.first_name, u.last_name, u.avatar_url,
 		       u.created_at, u.barcode, u.major,
-		       u.group_name, u.year, r.name as role
+		       u.group_name, u.year, u.version, r.name as role
 		FROM users u LEFT JOIN roles r
 		ON  u.role_id = r.id
 		WHERE 
@@ -277,18 +434,14 @@ func (s *Storage) GetAll(ctx context.Context, query string, filters domain.Filte
 			AND u.activated
 		ORDER BY id ASC
         LIMIT $2 OFFSET $3;
-	`)
-	if err != nil {
-		return nil, domain.Metadata{}, fmt.Errorf("%s: %w", op, err)
-	}
-	defer stmt.Close()
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	args := []any{query, filters.Limit(), filters.Offset()}
 
-	rows, err := stmt.QueryContext(ctx, args...)
+	rows, err := s.conn(ctx).Query(ctx, stmt, args...)
 	if err != nil {
 		return nil, domain.Metadata{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -305,7 +458,7 @@ func (s *Storage) GetAll(ctx context.Context, query string, filters domain.Filte
 			&totalRecords, &user.ID, &user.Email,
 			&user.FirstName, &user.LastName, &user.AvatarURL,
 			&user.CreatedAt, &user.Barcode, &user.Major,
-			&user.GroupName, &user.Year, &user.Role,
+			&user.GroupName, &user.Year, &user.Version, &user.Role,
 		)
 		if err != nil {
 			return nil, domain.Metadata{}, fmt.Errorf("%s: %w", op, err)
@@ -0,0 +1,24 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetRoleNames returns the names of all the rows of the roles table.
+func (s *Storage) GetRoleNames(ctx context.Context) ([]string, error) {
+	const op = "storage.postgresql.GetRoleNames"
+
+	rows, err := s.conn(ctx).Query(ctx, `SELECT name FROM roles ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return names, nil
+}
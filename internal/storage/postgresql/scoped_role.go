@@ -0,0 +1,171 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SaveScopedRole grants the scoped role. A grant that has expired but not been
+// reverted yet is replaced.
+func (s *Storage) SaveScopedRole(ctx context.Context, scopedRole *domain.ScopedRole) error {
+	const op = "storage.postgresql.SaveScopedRole"
+
+	roleID, err := s.roleID(ctx, scopedRole.Role.String())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.conn(ctx).QueryRow(ctx, `
+		INSERT INTO user_scoped_roles(user_id, scope_type, scope_id, role_id, expires_at)
+		VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, scope_type, scope_id, role_id) DO UPDATE
+		SET expires_at = EXCLUDED.expires_at, created_at = CURRENT_TIMESTAMP
+		WHERE user_scoped_roles.expires_at <= CURRENT_TIMESTAMP
+		RETURNING created_at;
+	`, scopedRole.UserID, scopedRole.Scope.Type, scopedRole.Scope.ID, roleID, scopedRole.ExpiresAt).Scan(&scopedRole.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrScopedRoleExists)
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteScopedRole(ctx context.Context, scopedRole *domain.ScopedRole) error {
+	const op = "storage.postgresql.DeleteScopedRole"
+
+	err := s.conn(ctx).QueryRow(ctx, `
+		DELETE FROM user_scoped_roles sr
+		USING roles r
+		WHERE sr.role_id = r.id AND sr.user_id = $1 AND sr.scope_type = $2 AND sr.scope_id = $3 AND r.name = $4
+		RETURNING sr.created_at, sr.expires_at;
+	`, scopedRole.UserID, scopedRole.Scope.Type, scopedRole.Scope.ID, scopedRole.Role).Scan(&scopedRole.CreatedAt, &scopedRole.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrScopedRoleNotExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetScopedRoles returns the names of the unexpired roles the user holds within the
+// scope.
+func (s *Storage) GetScopedRoles(ctx context.Context, userID int64, scope domain.RoleScope) ([]domain.Role, error) {
+	const op = "storage.postgresql.GetScopedRoles"
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		SELECT r.name
+		FROM user_scoped_roles sr JOIN roles r
+		ON sr.role_id = r.id
+		WHERE sr.user_id = $1 AND sr.scope_type = $2 AND sr.scope_id = $3
+		AND (sr.expires_at IS NULL OR sr.expires_at > CURRENT_TIMESTAMP);
+	`, userID, scope.Type, scope.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[domain.Role])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// GetUserScopedRoles returns the unexpired scoped roles of the user.
+func (s *Storage) GetUserScopedRoles(ctx context.Context, userID int64) ([]*domain.ScopedRole, error) {
+	const op = "storage.postgresql.GetUserScopedRoles"
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		SELECT sr.user_id, sr.scope_type, sr.scope_id, r.name, sr.created_at, sr.expires_at
+		FROM user_scoped_roles sr JOIN roles r
+		ON sr.role_id = r.id
+		WHERE sr.user_id = $1 AND (sr.expires_at IS NULL OR sr.expires_at > CURRENT_TIMESTAMP)
+		ORDER BY sr.scope_type, sr.scope_id, r.name;
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	scopedRoles, err := collectScopedRoles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scopedRoles, nil
+}
+
+// DeleteExpiredScopedRoles deletes and returns the expired grants. Each grant is
+// returned by only one call, even when called concurrently.
+func (s *Storage) DeleteExpiredScopedRoles(ctx context.Context) ([]*domain.ScopedRole, error) {
+	const op = "storage.postgresql.DeleteExpiredScopedRoles"
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		DELETE FROM user_scoped_roles sr
+		USING roles r
+		WHERE sr.role_id = r.id AND sr.expires_at <= CURRENT_TIMESTAMP
+		RETURNING sr.user_id, sr.scope_type, sr.scope_id, r.name, sr.created_at, sr.expires_at;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	scopedRoles, err := collectScopedRoles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scopedRoles, nil
+}
+
+func (s *Storage) SaveScopedRoleAudit(ctx context.Context, audit *domain.ScopedRoleAudit) error {
+	const op = "storage.postgresql.SaveScopedRoleAudit"
+
+	r := audit.ScopedRole
+	err := s.conn(ctx).QueryRow(ctx, `
+		INSERT INTO scoped_role_audit(user_id, scope_type, scope_id, role, action, actor, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at;
+	`, r.UserID, r.Scope.Type, r.Scope.ID, r.Role, audit.Action, audit.Actor, r.ExpiresAt).Scan(&audit.ID, &audit.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func collectScopedRoles(rows pgx.Rows) ([]*domain.ScopedRole, error) {
+	defer rows.Close()
+
+	var scopedRoles []*domain.ScopedRole
+	for rows.Next() {
+		var scopedRole domain.ScopedRole
+		err := rows.Scan(
+			&scopedRole.UserID,
+			&scopedRole.Scope.Type,
+			&scopedRole.Scope.ID,
+			&scopedRole.Role,
+			&scopedRole.CreatedAt,
+			&scopedRole.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		scopedRoles = append(scopedRoles, &scopedRole)
+	}
+
+	return scopedRoles, rows.Err()
+}
@@ -0,0 +1,128 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+func (s *Storage) SaveServiceAccount(ctx context.Context, account *domain.ServiceAccount) error {
+	const op = "storage.postgresql.SaveServiceAccount"
+
+	err := s.conn(ctx).QueryRow(ctx, `
+		INSERT INTO service_accounts(name) VALUES($1)
+		RETURNING id, created_at;
+	`, account.Name).Scan(&account.ID, &account.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("%s: %w", op, storage.ErrServiceAccountExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetServiceAccountByName(ctx context.Context, name string) (*domain.ServiceAccount, error) {
+	const op = "storage.postgresql.GetServiceAccountByName"
+
+	var account domain.ServiceAccount
+	err := s.conn(ctx).QueryRow(ctx, `
+		SELECT id, name, created_at FROM service_accounts WHERE name = $1;
+	`, name).Scan(&account.ID, &account.Name, &account.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrServiceAccountNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &account, nil
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key *domain.APIKey) error {
+	const op = "storage.postgresql.SaveAPIKey"
+
+	err := s.conn(ctx).QueryRow(ctx, `
+		INSERT INTO api_keys(service_account_id, prefix, secret_hash, scopes, expires_at)
+		VALUES($1, $2, $3, $4, $5)
+		RETURNING id, created_at;
+	`, key.ServiceAccountID, key.Prefix, key.SecretHash, key.Scopes, key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return fmt.Errorf("%s: %w", op, storage.ErrServiceAccountNotExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	const op = "storage.postgresql.GetAPIKeyByPrefix"
+
+	var key domain.APIKey
+	err := s.conn(ctx).QueryRow(ctx, `
+		SELECT k.id, k.service_account_id, a.name, k.prefix, k.secret_hash, k.scopes,
+		       k.created_at, k.expires_at, k.last_used_at, k.revoked_at
+		FROM api_keys k JOIN service_accounts a
+		ON k.service_account_id = a.id
+		WHERE k.prefix = $1;
+	`, prefix).Scan(
+		&key.ID,
+		&key.ServiceAccountID,
+		&key.ServiceAccountName,
+		&key.Prefix,
+		&key.SecretHash,
+		&key.Scopes,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &key, nil
+}
+
+func (s *Storage) SetAPIKeyLastUsed(ctx context.Context, keyID int64, usedAt time.Time) error {
+	const op = "storage.postgresql.SetAPIKeyLastUsed"
+
+	_, err := s.conn(ctx).Exec(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1;`, keyID, usedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeAPIKey revokes the key with the given prefix. Revoking a revoked key keeps
+// the original revocation time.
+func (s *Storage) RevokeAPIKey(ctx context.Context, prefix string) error {
+	const op = "storage.postgresql.RevokeAPIKey"
+
+	result, err := s.conn(ctx).Exec(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE prefix = $1;
+	`, prefix)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyNotExists)
+	}
+
+	return nil
+}
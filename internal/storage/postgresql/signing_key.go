@@ -0,0 +1,64 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"time"
+)
+
+func (s *Storage) SaveSigningKey(ctx context.Context, key *domain.SigningKey) error {
+	const op = "storage.postgresql.SaveSigningKey"
+
+	_, err := s.conn(ctx).Exec(ctx, `
+		INSERT INTO signing_keys(id, private_key, created_at, expires_at)
+		VALUES($1, $2, $3, $4);
+	`, key.ID, key.PrivateKey, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetSigningKeys returns the keys that have not expired at now, newest first.
+func (s *Storage) GetSigningKeys(ctx context.Context, now time.Time) ([]*domain.SigningKey, error) {
+	const op = "storage.postgresql.GetSigningKeys"
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		SELECT id, private_key, created_at, expires_at
+		FROM signing_keys
+		WHERE expires_at > $1
+		ORDER BY created_at DESC;
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []*domain.SigningKey
+	for rows.Next() {
+		var key domain.SigningKey
+		err := rows.Scan(&key.ID, &key.PrivateKey, &key.CreatedAt, &key.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, &key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) DeleteExpiredSigningKeys(ctx context.Context, now time.Time) error {
+	const op = "storage.postgresql.DeleteExpiredSigningKeys"
+
+	_, err := s.conn(ctx).Exec(ctx, `DELETE FROM signing_keys WHERE expires_at <= $1;`, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
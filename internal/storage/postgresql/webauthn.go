@@ -0,0 +1,110 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, cred *domain.WebAuthnCredential) error {
+	const op = "storage.postgresql.SaveWebAuthnCredential"
+
+	query := `
+		INSERT INTO webauthn_credentials(
+			user_id, credential_id, public_key, attestation_type, aaguid,
+			sign_count, transports, backup_eligible, backup_state
+		)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at;
+	`
+
+	args := []any{
+		cred.UserID,
+		cred.CredentialID,
+		cred.PublicKey,
+		cred.AttestationType,
+		cred.AAGUID,
+		int64(cred.SignCount),
+		cred.Transports,
+		cred.BackupEligible,
+		cred.BackupState,
+	}
+
+	err := s.conn(ctx).QueryRow(ctx, query, args...).Scan(&cred.ID, &cred.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("%s: %w", op, storage.ErrCredentialExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetWebAuthnCredentialsByUserID(ctx context.Context, userID int64) ([]*domain.WebAuthnCredential, error) {
+	const op = "storage.postgresql.GetWebAuthnCredentialsByUserID"
+
+	rows, err := s.conn(ctx).Query(ctx, `
+		SELECT id, user_id, credential_id, public_key, attestation_type, aaguid,
+		       sign_count, transports, backup_eligible, backup_state, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY id ASC;
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	creds := []*domain.WebAuthnCredential{}
+
+	for rows.Next() {
+		var (
+			cred      domain.WebAuthnCredential
+			signCount int64
+		)
+
+		err = rows.Scan(
+			&cred.ID, &cred.UserID, &cred.CredentialID, &cred.PublicKey, &cred.AttestationType, &cred.AAGUID,
+			&signCount, &cred.Transports, &cred.BackupEligible, &cred.BackupState, &cred.CreatedAt, &cred.LastUsedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		cred.SignCount = uint32(signCount)
+
+		creds = append(creds, &cred)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return creds, nil
+}
+
+// UpdateWebAuthnCredentialUsage stores the signature counter and backup state reported
+// by the last successful assertion.
+func (s *Storage) UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	const op = "storage.postgresql.UpdateWebAuthnCredentialUsage"
+
+	result, err := s.conn(ctx).Exec(ctx, `
+		UPDATE webauthn_credentials
+		SET sign_count = $2, backup_state = $3, last_used_at = CURRENT_TIMESTAMP
+		WHERE credential_id = $1;
+	`, credentialID, int64(signCount), backupState)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+	}
+
+	return nil
+}
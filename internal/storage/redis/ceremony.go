@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// SaveCeremony stores the state of a multi-step authentication ceremony.
+func (s Storage) SaveCeremony(ctx context.Context, key string, data []byte, duration time.Duration) error {
+	const op = "storage.redis.SaveCeremony"
+
+	err := s.client.Set(ctx, s.prefix+key, data, duration).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeCeremony returns and deletes the state of a ceremony, so that each ceremony
+// can be completed only once.
+func (s Storage) TakeCeremony(ctx context.Context, key string) ([]byte, error) {
+	const op = "storage.redis.TakeCeremony"
+
+	data, err := s.client.GetDel(ctx, s.prefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return data, nil
+}
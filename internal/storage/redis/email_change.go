@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func emailChangeKey(token string) string {
+	return "email_change:" + token
+}
+
+// CreateEmailChange stores a pending email change of the user under token, as
+// "<user_id>:<email>" so that it can be taken with a single GETDEL.
+func (s Storage) CreateEmailChange(ctx context.Context, token string, userID int64, newEmail string, duration time.Duration) error {
+	const op = "storage.redis.CreateEmailChange"
+
+	value := strconv.FormatInt(userID, 10) + ":" + newEmail
+
+	err := s.client.Set(ctx, emailChangeKey(token), value, duration).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeEmailChange returns the user and the requested email of a pending email
+// change and deletes it, so that each token can be used only once.
+func (s Storage) TakeEmailChange(ctx context.Context, token string) (userID int64, newEmail string, err error) {
+	const op = "storage.redis.TakeEmailChange"
+
+	value, err := s.client.GetDel(ctx, emailChangeKey(token)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, "", fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+		}
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, newEmail, _ := strings.Cut(value, ":")
+	userID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, newEmail, nil
+}
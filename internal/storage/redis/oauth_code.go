@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+func authorizationCodeKey(code string) string {
+	return "oauth_code:" + code
+}
+
+func (s Storage) SaveAuthorizationCode(ctx context.Context, code string, authCode *domain.AuthorizationCode, duration time.Duration) error {
+	const op = "storage.redis.SaveAuthorizationCode"
+
+	bytes, err := json.Marshal(authCode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.client.Set(ctx, authorizationCodeKey(code), bytes, duration).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeAuthorizationCode returns and deletes an authorization code, so that each
+// code can be exchanged only once.
+func (s Storage) TakeAuthorizationCode(ctx context.Context, code string) (*domain.AuthorizationCode, error) {
+	const op = "storage.redis.TakeAuthorizationCode"
+
+	bytes, err := s.client.GetDel(ctx, authorizationCodeKey(code)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var authCode domain.AuthorizationCode
+	err = json.Unmarshal(bytes, &authCode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &authCode, nil
+}
@@ -0,0 +1,116 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"time"
+)
+
+// PermissionStorage is the persistent permission storage wrapped by PermissionCache.
+type PermissionStorage interface {
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
+	GrantPermission(ctx context.Context, role string, permission string) error
+	RevokePermission(ctx context.Context, role string, permission string) error
+}
+
+// PermissionCache is a read-through cache for the permissions granted to roles,
+// which are read on every permission check and rarely change.
+//
+// Writes succeed once the persistent storage is written. If the cached permissions
+// can not be invalidated afterwards, the failure is logged and the entry expires
+// after ttl.
+type PermissionCache struct {
+	PermissionStorage
+	log    *slog.Logger
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewPermissionCache(log *slog.Logger, s *Storage, permissionStorage PermissionStorage, ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		PermissionStorage: permissionStorage,
+		log:               log,
+		client:            s.client,
+		ttl:               ttl,
+	}
+}
+
+func rolePermissionsKey(role string) string {
+	return "role_permissions:" + role
+}
+
+func (c *PermissionCache) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	const op = "storage.redis.PermissionCache.GetRolePermissions"
+
+	val, err := c.client.Get(ctx, rolePermissionsKey(role)).Bytes()
+	switch {
+	case err == nil:
+		var permissions []string
+		if err := json.Unmarshal(val, &permissions); err == nil {
+			return permissions, nil
+		}
+	case !errors.Is(err, redis.Nil):
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	permissions, err := c.PermissionStorage.GetRolePermissions(ctx, role)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	bytes, err := json.Marshal(permissions)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = c.client.Set(ctx, rolePermissionsKey(role), bytes, c.ttl).Err()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permissions, nil
+}
+
+func (c *PermissionCache) GrantPermission(ctx context.Context, role string, permission string) error {
+	const op = "storage.redis.PermissionCache.GrantPermission"
+
+	err := c.PermissionStorage.GrantPermission(ctx, role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.invalidate(ctx, op, role)
+
+	return nil
+}
+
+func (c *PermissionCache) RevokePermission(ctx context.Context, role string, permission string) error {
+	const op = "storage.redis.PermissionCache.RevokePermission"
+
+	err := c.PermissionStorage.RevokePermission(ctx, role, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.invalidate(ctx, op, role)
+
+	return nil
+}
+
+// invalidate removes the cached permissions of the role. Failures are only logged,
+// since the write they follow has succeeded and must not be retried by the client.
+func (c *PermissionCache) invalidate(ctx context.Context, op string, role string) {
+	err := c.client.Del(ctx, rolePermissionsKey(role)).Err()
+	if err != nil {
+		c.log.With(slog.String("op", op)).Error(
+			"failed to invalidate cached permissions, they expire after the cache ttl",
+			slog.String("role", role),
+			logger.Err(err),
+		)
+	}
+}
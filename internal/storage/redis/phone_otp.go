@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+func phoneOTPKey(userID int64) string {
+	return fmt.Sprintf("phone_otp:%d", userID)
+}
+
+// CreatePhoneOTP stores the hash of a one-time code sent to phoneNumber, replacing
+// any pending code of the user. ErrTooManyRequests is returned if the previous code
+// was issued less than resendInterval ago.
+func (s Storage) CreatePhoneOTP(
+	ctx context.Context,
+	userID int64,
+	phoneNumber string,
+	codeHash string,
+	duration time.Duration,
+	resendInterval time.Duration,
+) error {
+	const op = "storage.redis.CreatePhoneOTP"
+
+	key := phoneOTPKey(userID)
+
+	ttl, err := s.client.TTL(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if ttl > duration-resendInterval {
+		return fmt.Errorf("%s: %w", op, storage.ErrTooManyRequests)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "phone_number", phoneNumber, "code_hash", codeHash, "attempts", 0)
+		pipe.Expire(ctx, key, duration)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetPhoneOTP returns the pending one-time code of the user and the number of failed
+// attempts made so far.
+func (s Storage) GetPhoneOTP(ctx context.Context, userID int64) (phoneNumber string, codeHash string, attempts int, err error) {
+	const op = "storage.redis.GetPhoneOTP"
+
+	vals, err := s.client.HGetAll(ctx, phoneOTPKey(userID)).Result()
+	if err != nil {
+		return "", "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(vals) == 0 {
+		return "", "", 0, fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+	}
+
+	attempts, err = strconv.Atoi(vals["attempts"])
+	if err != nil {
+		return "", "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return vals["phone_number"], vals["code_hash"], attempts, nil
+}
+
+// IncrPhoneOTPAttempts records a failed attempt and returns the new attempt count.
+func (s Storage) IncrPhoneOTPAttempts(ctx context.Context, userID int64) (int, error) {
+	const op = "storage.redis.IncrPhoneOTPAttempts"
+
+	attempts, err := s.client.HIncrBy(ctx, phoneOTPKey(userID), "attempts", 1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(attempts), nil
+}
+
+func (s Storage) DeletePhoneOTP(ctx context.Context, userID int64) error {
+	const op = "storage.redis.DeletePhoneOTP"
+
+	err := s.client.Del(ctx, phoneOTPKey(userID)).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
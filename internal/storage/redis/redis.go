@@ -13,6 +13,7 @@ import (
 
 type Storage struct {
 	client *redis.Client
+	prefix string
 }
 
 func New(redisURL string) (*Storage, error) {
@@ -33,10 +34,17 @@ func New(redisURL string) (*Storage, error) {
 	return &Storage{client: client}, err
 }
 
+// WithPrefix returns a storage sharing the same connection whose tokens are kept
+// under the given key prefix, so tokens of different kinds cannot be mixed up.
+func (s Storage) WithPrefix(prefix string) Storage {
+	s.prefix = prefix
+	return s
+}
+
 func (s Storage) Create(ctx context.Context, sessionToken string, userID int64, duration time.Duration) error {
 	const op = "storage.redis.Create"
 
-	err := s.client.Set(ctx, sessionToken, userID, duration).Err()
+	err := s.client.Set(ctx, s.prefix+sessionToken, userID, duration).Err()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -47,7 +55,7 @@ func (s Storage) Create(ctx context.Context, sessionToken string, userID int64,
 func (s Storage) Get(ctx context.Context, sessionToken string) (int64, error) {
 	const op = "storage.redis.Get"
 
-	val, err := s.client.Get(ctx, sessionToken).Result()
+	val, err := s.client.Get(ctx, s.prefix+sessionToken).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			return 0, fmt.Errorf("%s: %w", op, storage.ErrSessionNotExists)
@@ -62,9 +70,94 @@ func (s Storage) Get(ctx context.Context, sessionToken string) (int64, error) {
 	return int64(userID), nil
 }
 
+// Extend makes the session expire after duration from now. It returns
+// ErrSessionNotExists if the session has already ended.
+func (s Storage) Extend(ctx context.Context, sessionToken string, duration time.Duration) error {
+	const op = "storage.redis.Extend"
+
+	ok, err := s.client.Expire(ctx, s.prefix+sessionToken, duration).Result()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotExists)
+	}
+
+	return nil
+}
+
+// Take returns the user of a token and deletes it, so that each token can be used
+// only once.
+func (s Storage) Take(ctx context.Context, token string) (int64, error) {
+	const op = "storage.redis.Take"
+
+	userID, err := s.client.GetDel(ctx, s.prefix+token).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
 func (s Storage) Delete(ctx context.Context, sessionToken string) error {
 	const op = "storage.redis.Delete"
-	err := s.client.Del(ctx, sessionToken).Err()
+	err := s.client.Del(ctx, s.prefix+sessionToken, s.prefix+attemptsKey(sessionToken)).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func attemptsKey(token string) string {
+	return "attempts:" + token
+}
+
+// IncrAttempts counts a failed attempt to use token and returns the number of
+// attempts made so far. The counter expires after duration.
+func (s Storage) IncrAttempts(ctx context.Context, token string, duration time.Duration) (int, error) {
+	const op = "storage.redis.IncrAttempts"
+
+	key := s.prefix + attemptsKey(token)
+
+	attempts, err := s.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if attempts == 1 {
+		err = s.client.Expire(ctx, key, duration).Err()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return int(attempts), nil
+}
+
+// Attempts returns the number of failed attempts recorded for token by IncrAttempts.
+func (s Storage) Attempts(ctx context.Context, token string) (int, error) {
+	const op = "storage.redis.Attempts"
+
+	attempts, err := s.client.Get(ctx, s.prefix+attemptsKey(token)).Int()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// ResetAttempts discards the failed attempts recorded for token.
+func (s Storage) ResetAttempts(ctx context.Context, token string) error {
+	const op = "storage.redis.ResetAttempts"
+
+	err := s.client.Del(ctx, s.prefix+attemptsKey(token)).Err()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
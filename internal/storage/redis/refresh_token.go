@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/storage"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// Refresh tokens of one session form a family. A token is marked used when it is
+// exchanged, and is kept until it expires so that a second use can be detected.
+// The family holds the session token and is deleted when the family is revoked,
+// which invalidates all of its refresh tokens at once.
+
+func refreshTokenKey(token string) string {
+	return "refresh_token:" + token
+}
+
+func refreshFamilyKey(sessionID string) string {
+	return "refresh_family:" + sessionID
+}
+
+// useRefreshTokenScript marks the refresh token KEYS[1] of the family KEYS[2] as
+// used. Scripts may only touch the keys passed in KEYS, so the session id of the
+// token is read before the script runs and passed as ARGV[1], and the script
+// checks that the token still belongs to it. ARGV[2] is the client using the
+// token, which must be the client of the family. It returns {0} if the token or
+// its family does not exist, {3} if the family belongs to another client, and
+// otherwise leaves the token unused. It returns {1, user_id, session_token} on the
+// first use and {2, ...} if the token had already been used.
+var useRefreshTokenScript = redis.NewScript(`
+local token = redis.call('HMGET', KEYS[1], 'user_id', 'session_id', 'used')
+if not token[1] or token[2] ~= ARGV[1] then
+	return {0}
+end
+
+local family = redis.call('HMGET', KEYS[2], 'session_token', 'client_id')
+if not family[1] then
+	return {0}
+end
+if (family[2] or '') ~= ARGV[2] then
+	return {3}
+end
+
+if token[3] then
+	return {2, token[1], family[1]}
+end
+
+redis.call('HSET', KEYS[1], 'used', 1)
+return {1, token[1], family[1]}
+`)
+
+// CreateRefreshFamily starts the refresh token family of a session, issued to the
+// OpenID Connect client clientID or to the gRPC API if it is empty.
+func (s Storage) CreateRefreshFamily(ctx context.Context, sessionID string, sessionToken string, clientID string, duration time.Duration) error {
+	const op = "storage.redis.CreateRefreshFamily"
+
+	key := refreshFamilyKey(sessionID)
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "session_token", sessionToken, "client_id", clientID)
+		pipe.Expire(ctx, key, duration)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CreateRefreshToken adds a refresh token to the family of its session and extends
+// the lifetime of the family to that of the token.
+func (s Storage) CreateRefreshToken(ctx context.Context, token string, refresh *domain.RefreshToken, duration time.Duration) error {
+	const op = "storage.redis.CreateRefreshToken"
+
+	key := refreshTokenKey(token)
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", refresh.UserID, "session_id", refresh.SessionID)
+		pipe.Expire(ctx, key, duration)
+		pipe.Expire(ctx, refreshFamilyKey(refresh.SessionID), duration)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseRefreshToken marks a refresh token as used by clientID and returns it. If the
+// token had already been used, the token is returned together with ErrTokenReused
+// so that the caller can revoke its family. ErrTokenClientMismatch is returned,
+// without using the token, if its family was issued to another client.
+func (s Storage) UseRefreshToken(ctx context.Context, token string, clientID string) (*domain.RefreshToken, error) {
+	const op = "storage.redis.UseRefreshToken"
+
+	key := refreshTokenKey(token)
+
+	sessionID, err := s.client.HGet(ctx, key, "session_id").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := useRefreshTokenScript.Run(ctx, s.client, []string{key, refreshFamilyKey(sessionID)}, sessionID, clientID).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	status, _ := res[0].(int64)
+	switch status {
+	case 0:
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrTokenNotExists)
+	case 3:
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrTokenClientMismatch)
+	}
+	if len(res) != 3 {
+		return nil, fmt.Errorf("%s: unexpected script result %v", op, res)
+	}
+
+	userIDStr, _ := res[1].(string)
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sessionToken, _ := res[2].(string)
+
+	refresh := &domain.RefreshToken{UserID: userID, SessionID: sessionID, SessionToken: sessionToken, ClientID: clientID}
+	if status == 2 {
+		return refresh, fmt.Errorf("%s: %w", op, storage.ErrTokenReused)
+	}
+
+	return refresh, nil
+}
+
+// RevokeRefreshFamily invalidates all refresh tokens of a session.
+func (s Storage) RevokeRefreshFamily(ctx context.Context, sessionID string) error {
+	const op = "storage.redis.RevokeRefreshFamily"
+
+	err := s.client.Del(ctx, refreshFamilyKey(sessionID)).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
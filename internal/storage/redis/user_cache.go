@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ARUMANDESU/uniclubs-user-service/internal/domain"
+	"github.com/ARUMANDESU/uniclubs-user-service/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// UserStorage is the persistent user storage wrapped by UserCache.
+type UserStorage interface {
+	SaveUser(ctx context.Context, user *domain.User) error
+	GetUserByID(ctx context.Context, userID int64) (user *domain.User, err error)
+	GetUserByIDForUpdate(ctx context.Context, userID int64) (user *domain.User, err error)
+	GetUserByEmail(ctx context.Context, email string) (user *domain.User, err error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	GetUserRoleByID(ctx context.Context, userID int64) (role domain.Role, err error)
+	ActivateUser(ctx context.Context, userID int64) error
+	UpdateUser(ctx context.Context, user *domain.User, fields []string) error
+	SetPhoneVerified(ctx context.Context, userID int64, phoneNumber string) error
+	SetUserRole(ctx context.Context, userID int64, role domain.Role) error
+	// RehashPassword needs no invalidation, the password hash is not cached.
+	RehashPassword(ctx context.Context, userID int64, oldHash []byte, newHash []byte) error
+	DeleteUserByID(ctx context.Context, userID int64) error
+	GetAll(ctx context.Context, query string, filters domain.Filters) ([]*domain.User, domain.Metadata, error)
+	GetScopedRoles(ctx context.Context, userID int64, scope domain.RoleScope) ([]domain.Role, error)
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// UserCache is a read-through cache for user profiles returned by GetUserByID.
+// Cached users are stored as JSON, so the password hash is never written to redis
+// and users returned from the cache have an empty PasswordHash.
+//
+// Writes succeed once the persistent storage is written. If the cached user can not
+// be invalidated afterwards, the failure is logged and the entry expires after ttl.
+type UserCache struct {
+	UserStorage
+	log    *slog.Logger
+	client *redis.Client
+	ttl    time.Duration
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// CacheStats holds the hit and miss counters of the cache.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+func NewUserCache(log *slog.Logger, s *Storage, userStorage UserStorage, ttl time.Duration) *UserCache {
+	return &UserCache{
+		UserStorage: userStorage,
+		log:         log,
+		client:      s.client,
+		ttl:         ttl,
+	}
+}
+
+// pendingInvalidationsKey carries the ids of users written inside a transaction.
+// They are invalidated again after the transaction ends, so that neither a read
+// made before the commit nor a rollback leaves a stale entry behind.
+type pendingInvalidationsKey struct{}
+
+func userKey(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// GetUserByID returns the cached user, or reads it from the persistent storage and
+// caches it. Redis failures are logged and the user is read from the persistent
+// storage. Reads inside a transaction bypass the cache, since they may see rows
+// that are not committed yet.
+func (c *UserCache) GetUserByID(ctx context.Context, userID int64) (*domain.User, error) {
+	const op = "storage.redis.UserCache.GetUserByID"
+	log := c.log.With(slog.String("op", op))
+
+	if _, ok := ctx.Value(pendingInvalidationsKey{}).(*[]int64); ok {
+		return c.UserStorage.GetUserByID(ctx, userID)
+	}
+
+	val, err := c.client.Get(ctx, userKey(userID)).Bytes()
+	switch {
+	case err == nil:
+		var user domain.User
+		if err := json.Unmarshal(val, &user); err == nil {
+			c.hits.Add(1)
+			return &user, nil
+		}
+	case !errors.Is(err, redis.Nil):
+		log.Error("failed to get cached user", slog.Int64("user_id", userID), logger.Err(err))
+	}
+	c.misses.Add(1)
+
+	user, err := c.UserStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	bytes, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = c.client.Set(ctx, userKey(userID), bytes, c.ttl).Err()
+	if err != nil {
+		log.Error("failed to cache user", slog.Int64("user_id", userID), logger.Err(err))
+	}
+
+	return user, nil
+}
+
+func (c *UserCache) UpdateUser(ctx context.Context, user *domain.User, fields []string) error {
+	const op = "storage.redis.UserCache.UpdateUser"
+
+	err := c.UserStorage.UpdateUser(ctx, user, fields)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.invalidate(ctx, op, user.ID)
+
+	return nil
+}
+
+func (c *UserCache) SetPhoneVerified(ctx context.Context, userID int64, phoneNumber string) error {
+	const op = "storage.redis.UserCache.SetPhoneVerified"
+
+	err := c.UserStorage.SetPhoneVerified(ctx, userID, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.invalidate(ctx, op, userID)
+
+	return nil
+}
+
+func (c *UserCache) SetUserRole(ctx context.Context, userID int64, role domain.Role) error {
+	const op = "storage.redis.UserCache.SetUserRole"
+
+	err := c.UserStorage.SetUserRole(ctx, userID, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.invalidate(ctx, op, userID)
+
+	return nil
+}
+
+func (c *UserCache) DeleteUserByID(ctx context.Context, userID int64) error {
+	const op = "storage.redis.UserCache.DeleteUserByID"
+
+	err := c.UserStorage.DeleteUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.invalidate(ctx, op, userID)
+
+	return nil
+}
+
+func (c *UserCache) ActivateUser(ctx context.Context, userID int64) error {
+	const op = "storage.redis.UserCache.ActivateUser"
+
+	err := c.UserStorage.ActivateUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.invalidate(ctx, op, userID)
+
+	return nil
+}
+
+func (c *UserCache) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	const op = "storage.redis.UserCache.WithTx"
+
+	if _, ok := ctx.Value(pendingInvalidationsKey{}).(*[]int64); ok {
+		return c.UserStorage.WithTx(ctx, fn)
+	}
+
+	// users written inside the transaction are invalidated again whether it
+	// commits or rolls back
+	var userIDs []int64
+	defer func() {
+		for _, userID := range userIDs {
+			c.del(ctx, op, userID)
+		}
+	}()
+
+	return c.UserStorage.WithTx(context.WithValue(ctx, pendingInvalidationsKey{}, &userIDs), fn)
+}
+
+// Stats returns the number of cache hits and misses since the cache was created.
+func (c *UserCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// invalidate removes the cached user after a write, and again after the
+// transaction in ctx ends, if any.
+func (c *UserCache) invalidate(ctx context.Context, op string, userID int64) {
+	if pending, ok := ctx.Value(pendingInvalidationsKey{}).(*[]int64); ok {
+		*pending = append(*pending, userID)
+	}
+
+	c.del(ctx, op, userID)
+}
+
+// del removes the cached user. Failures are only logged, since the write they follow
+// has succeeded and must not be retried by the client.
+func (c *UserCache) del(ctx context.Context, op string, userID int64) {
+	err := c.client.Del(ctx, userKey(userID)).Err()
+	if err != nil {
+		c.log.With(slog.String("op", op)).Error(
+			"failed to invalidate cached user, it expires after the cache ttl",
+			slog.Int64("user_id", userID),
+			logger.Err(err),
+		)
+	}
+}
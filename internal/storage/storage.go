@@ -3,8 +3,29 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists       = errors.New("user already exists")
-	ErrUserNotExists    = errors.New("user does not exists")
-	ErrSessionNotExists = errors.New("session does not exists")
-	ErrSessinoExists    = errors.New("session already exists")
+	ErrUserExists              = errors.New("user already exists")
+	ErrUserNotExists           = errors.New("user does not exists")
+	ErrSessionNotExists        = errors.New("session does not exists")
+	ErrSessinoExists           = errors.New("session already exists")
+	ErrEditConflict            = errors.New("edit conflict")
+	ErrTokenNotExists          = errors.New("token does not exists")
+	ErrTooManyRequests         = errors.New("too many requests")
+	ErrMFANotExists            = errors.New("mfa does not exists")
+	ErrCodeAlreadyUsed         = errors.New("code already used")
+	ErrCredentialExists        = errors.New("credential already exists")
+	ErrTokenReused             = errors.New("token already used")
+	ErrTokenClientMismatch     = errors.New("token was issued to another client")
+	ErrClientNotExists         = errors.New("client does not exists")
+	ErrIdentityExists          = errors.New("identity already linked")
+	ErrIdentityNotExists       = errors.New("identity does not exists")
+	ErrServiceAccountExists    = errors.New("service account already exists")
+	ErrServiceAccountNotExists = errors.New("service account does not exists")
+	ErrAPIKeyNotExists         = errors.New("api key does not exists")
+	ErrRoleNotExists           = errors.New("role does not exists")
+	ErrPermissionNotExists     = errors.New("permission does not exists")
+	ErrScopedRoleExists        = errors.New("scoped role already granted")
+	ErrScopedRoleNotExists     = errors.New("scoped role does not exists")
+	ErrImpersonationNotExists  = errors.New("impersonation does not exists")
+	ErrInvitationNotExists     = errors.New("invitation does not exists")
+	ErrInvitationUsedUp        = errors.New("invitation used up")
 )
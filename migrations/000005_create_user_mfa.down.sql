@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_mfa_recovery_codes;
+
+DROP TABLE IF EXISTS user_mfa;
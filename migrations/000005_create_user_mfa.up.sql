@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_mfa(
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret BYTEA NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_mfa_recovery_codes(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES user_mfa(user_id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS user_mfa_recovery_codes_user_id_idx ON user_mfa_recovery_codes(user_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS signing_keys(
+    id TEXT PRIMARY KEY,
+    private_key BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS signing_keys_expires_at_idx ON signing_keys(expires_at);
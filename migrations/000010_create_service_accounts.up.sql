@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS service_accounts(
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS api_keys(
+    id BIGSERIAL PRIMARY KEY,
+    service_account_id BIGINT NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    prefix TEXT NOT NULL UNIQUE,
+    secret_hash BYTEA NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_service_account_id_idx ON api_keys(service_account_id);
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS permissions(
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions(
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'View user profiles'),
+    ('users:update', 'Edit the profile of any user'),
+    ('users:delete', 'Delete users'),
+    ('users:lock', 'Lock and unlock user accounts'),
+    ('roles:assign', 'Change the role of users'),
+    ('permissions:manage', 'Edit the permissions granted to roles'),
+    ('clubs:create', 'Request a new club'),
+    ('clubs:approve', 'Approve and reject club requests'),
+    ('clubs:manage', 'Edit clubs and their members'),
+    ('events:join', 'Join club events'),
+    ('events:manage', 'Create and edit club events'),
+    ('events:approve', 'Approve and reject club events');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r JOIN permissions p ON
+    (r.name IN ('DSVR', 'ADMIN'))
+    OR (r.name = 'MODER' AND p.name IN ('users:read', 'clubs:create', 'clubs:manage', 'events:join', 'events:manage'))
+    OR (r.name = 'USER' AND p.name IN ('users:read', 'clubs:create', 'events:join'));
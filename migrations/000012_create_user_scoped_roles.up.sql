@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_scoped_roles(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scope_type TEXT NOT NULL,
+    scope_id BIGINT NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES roles(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, scope_type, scope_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_scoped_roles_scope_idx ON user_scoped_roles(scope_type, scope_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS scoped_role_audit;
+DROP INDEX IF EXISTS user_scoped_roles_expires_at_idx;
+ALTER TABLE user_scoped_roles DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,17 @@
+ALTER TABLE user_scoped_roles ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS user_scoped_roles_expires_at_idx ON user_scoped_roles(expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS scoped_role_audit(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    scope_type TEXT NOT NULL,
+    scope_id BIGINT NOT NULL,
+    role TEXT NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scoped_role_audit_user_id_idx ON scoped_role_audit(user_id);
@@ -0,0 +1,10 @@
+-- GUEST can only be removed once nothing references it: guests become users and
+-- club grants of GUEST are dropped.
+UPDATE users SET role_id = (SELECT id FROM roles WHERE name = 'USER')
+WHERE role_id = (SELECT id FROM roles WHERE name = 'GUEST');
+
+DELETE FROM user_scoped_roles WHERE role_id = (SELECT id FROM roles WHERE name = 'GUEST');
+
+DELETE FROM roles WHERE name = 'GUEST';
+
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_name_key;
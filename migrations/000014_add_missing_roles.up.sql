@@ -0,0 +1,4 @@
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+
+INSERT INTO roles (name) VALUES ('GUEST'), ('USER'), ('MODER'), ('ADMIN'), ('DSVR')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS impersonations(
+    id BIGSERIAL PRIMARY KEY,
+    impersonator_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    end_reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS impersonations_impersonator_id_idx ON impersonations(impersonator_id);
+CREATE INDEX IF NOT EXISTS impersonations_user_id_idx ON impersonations(user_id);
+CREATE INDEX IF NOT EXISTS impersonations_expires_at_idx ON impersonations(expires_at) WHERE ended_at IS NULL;
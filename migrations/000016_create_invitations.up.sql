@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS invitations(
+    id BIGSERIAL PRIMARY KEY,
+    code_hash BYTEA NOT NULL UNIQUE,
+    email TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT '',
+    max_uses INTEGER NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    created_by BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
@@ -0,0 +1,162 @@
+// Package breached looks up passwords in a list of breached passwords.
+//
+// A list is a file of the first 8 bytes of the SHA-1 hashes of the passwords,
+// sorted and without duplicates, so that it can be searched in place without
+// loading it into memory. The Pwned Passwords list ordered by hash converts to this
+// format line by line.
+package breached
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+const entrySize = 8
+
+var ErrNotSorted = errors.New("hashes are not sorted")
+
+// List is a list of breached passwords.
+type List struct {
+	r io.ReaderAt
+	n int64
+}
+
+// New returns the list read from r holding size bytes.
+func New(r io.ReaderAt, size int64) (*List, error) {
+	if size%entrySize != 0 {
+		return nil, fmt.Errorf("breached list size %d is not a multiple of %d", size, entrySize)
+	}
+	return &List{r: r, n: size / entrySize}, nil
+}
+
+// Open returns the list in the file at path. The file stays open for the lifetime
+// of the list.
+func Open(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	l, err := New(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// FromPasswords returns an in-memory list of the passwords.
+func FromPasswords(passwords []string) *List {
+	hashes := make([]uint64, len(passwords))
+	for i, password := range passwords {
+		hashes[i] = Hash(password)
+	}
+	slices.Sort(hashes)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, hash := range hashes {
+		// the hashes are sorted, so this never fails
+		_ = w.Add(hash)
+	}
+
+	return &List{r: bytes.NewReader(buf.Bytes()), n: int64(buf.Len() / entrySize)}
+}
+
+// Len returns the number of hashes in the list.
+func (l *List) Len() int64 {
+	return l.n
+}
+
+// Contains reports whether the password is in the list.
+func (l *List) Contains(password string) (bool, error) {
+	target := Hash(password)
+	entry := make([]byte, entrySize)
+
+	lo, hi := int64(0), l.n
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if _, err := l.r.ReadAt(entry, mid*entrySize); err != nil {
+			return false, fmt.Errorf("read breached list: %w", err)
+		}
+
+		switch hash := binary.BigEndian.Uint64(entry); {
+		case hash == target:
+			return true, nil
+		case hash < target:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// Hash returns the hash of the password stored in lists.
+func Hash(password string) uint64 {
+	sum := sha1.Sum([]byte(password))
+	return binary.BigEndian.Uint64(sum[:entrySize])
+}
+
+// ParseSHA1 returns the hash stored in lists for the hex encoded SHA-1 hash of a
+// password, as published in the Pwned Passwords list.
+func ParseSHA1(s string) (uint64, error) {
+	sum, err := hex.DecodeString(s)
+	if err != nil || len(sum) != sha1.Size {
+		return 0, fmt.Errorf("invalid sha1 hash %q", s)
+	}
+	return binary.BigEndian.Uint64(sum[:entrySize]), nil
+}
+
+// Writer writes a list from sorted hashes.
+type Writer struct {
+	w    io.Writer
+	last uint64
+	n    int64
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Add writes the hash, skipping duplicates. ErrNotSorted is returned if the hash is
+// less than the previous one.
+func (w *Writer) Add(hash uint64) error {
+	if w.n > 0 {
+		switch {
+		case hash == w.last:
+			return nil
+		case hash < w.last:
+			return ErrNotSorted
+		}
+	}
+
+	err := binary.Write(w.w, binary.BigEndian, hash)
+	if err != nil {
+		return err
+	}
+	w.last = hash
+	w.n++
+
+	return nil
+}
+
+// Len returns the number of hashes written.
+func (w *Writer) Len() int64 {
+	return w.n
+}
@@ -0,0 +1,62 @@
+package breached
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestList_Contains(t *testing.T) {
+	l := FromPasswords([]string{"123456", "password", "qwerty", "password"})
+	assert.Equal(t, int64(3), l.Len(), "duplicates are skipped")
+
+	for _, password := range []string{"123456", "password", "qwerty"} {
+		ok, err := l.Contains(password)
+		require.NoError(t, err)
+		assert.True(t, ok, password)
+	}
+
+	ok, err := l.Contains("Password")
+	require.NoError(t, err)
+	assert.False(t, ok, "passwords are case sensitive")
+}
+
+func TestOpen(t *testing.T) {
+	// SHA-1 hashes of "password" and "letmein" as in the Pwned Passwords list
+	hashes := make([]uint64, 0, 2)
+	for _, s := range []string{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", "B7A875FC1EA228B9061041B7CEC4BD3C52AB3CE3"} {
+		hash, err := ParseSHA1(s)
+		require.NoError(t, err)
+		hashes = append(hashes, hash)
+	}
+	slices.Sort(hashes)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, hash := range hashes {
+		require.NoError(t, w.Add(hash))
+	}
+	assert.ErrorIs(t, w.Add(0), ErrNotSorted)
+
+	path := filepath.Join(t.TempDir(), "breached.bin")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	l, err := Open(path)
+	require.NoError(t, err)
+
+	ok, err := l.Contains("letmein")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = l.Contains("correct horse battery staple")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestNew_InvalidSize(t *testing.T) {
+	_, err := New(bytes.NewReader(make([]byte, 12)), 12)
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+// Package hasher hashes passwords with argon2id into PHC strings such as
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// and verifies them, along with legacy bcrypt hashes. Verify reports when a hash
+// should be replaced by a new one, so that hashes are upgraded as users log in.
+//
+// With a pepper, the password is keyed with HMAC-SHA256 before it is hashed, and the
+// hash records an id of the pepper in its keyid parameter. Old peppers are kept to
+// verify the hashes made with them, so that the pepper can be rotated.
+package hasher
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
+)
+
+const argon2idID = "argon2id"
+
+var (
+	ErrUnknownFormat  = errors.New("unknown password hash format")
+	ErrInvalidHash    = errors.New("invalid password hash")
+	ErrPepperMismatch = errors.New("password hash was peppered with an unknown pepper")
+)
+
+var b64 = base64.RawStdEncoding
+
+// Params are the argon2id parameters of new hashes. Memory is in KiB.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type Hasher struct {
+	params   Params
+	pepper   []byte
+	pepperID string
+	// peppers holds the current and old peppers by id.
+	peppers map[string][]byte
+}
+
+// New returns a hasher of new hashes with params. pepper is optional. oldPeppers
+// only verify existing hashes, which are then reported for rehashing with pepper.
+func New(params Params, pepper []byte, oldPeppers ...[]byte) (*Hasher, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	h := &Hasher{params: params, peppers: map[string][]byte{}}
+	for _, old := range oldPeppers {
+		if len(old) > 0 {
+			h.peppers[pepperID(old)] = old
+		}
+	}
+	if len(pepper) > 0 {
+		h.pepper = pepper
+		h.pepperID = pepperID(pepper)
+		h.peppers[h.pepperID] = pepper
+	}
+	return h, nil
+}
+
+func pepperID(pepper []byte) string {
+	id := sha256.Sum256(pepper)
+	return b64.EncodeToString(id[:4])
+}
+
+// Hash returns the PHC string of the argon2id hash of the password.
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	p := h.params
+	key := argon2.IDKey(keyed(password, h.pepper), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Iterations, p.Parallelism)
+	if h.pepperID != "" {
+		params += ",keyid=" + h.pepperID
+	}
+
+	return []byte(fmt.Sprintf("$%s$v=%d$%s$%s$%s",
+		argon2idID, argon2.Version, params, b64.EncodeToString(salt), b64.EncodeToString(key),
+	)), nil
+}
+
+// Verify reports whether the password matches the hash, and if so whether the hash
+// should be replaced by Hash because it uses another algorithm, other parameters or
+// an old pepper. An empty hash matches no password. ErrPepperMismatch is returned
+// for hashes made with a pepper that is neither the current nor an old one.
+func (h *Hasher) Verify(hash []byte, password string) (ok bool, rehash bool, err error) {
+	s := string(hash)
+	switch {
+	case s == "":
+		return false, false, nil
+	case strings.HasPrefix(s, "$2a$"), strings.HasPrefix(s, "$2b$"), strings.HasPrefix(s, "$2y$"):
+		err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, fmt.Errorf("%w: %w", ErrInvalidHash, err)
+		}
+		return true, true, nil
+	case strings.HasPrefix(s, "$"+argon2idID+"$"):
+		return h.verifyArgon2id(s, password)
+	default:
+		return false, false, ErrUnknownFormat
+	}
+}
+
+func (h *Hasher) verifyArgon2id(s string, password string) (bool, bool, error) {
+	parts := strings.Split(s, "$")
+	// "", "argon2id", "v=19", params, salt, key
+	if len(parts) != 6 || parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return false, false, ErrInvalidHash
+	}
+
+	var p Params
+	var pepperID string
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		var err error
+		switch name {
+		case "m":
+			p.Memory, err = parseUint32(value)
+		case "t":
+			p.Iterations, err = parseUint32(value)
+		case "p":
+			var parallelism uint64
+			parallelism, err = strconv.ParseUint(value, 10, 8)
+			p.Parallelism = uint8(parallelism)
+		case "keyid":
+			pepperID = value
+		default:
+			err = fmt.Errorf("unknown parameter %q", name)
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("%w: %w", ErrInvalidHash, err)
+		}
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("%w: salt: %w", ErrInvalidHash, err)
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("%w: hash: %w", ErrInvalidHash, err)
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+	if err := p.validate(); err != nil {
+		return false, false, fmt.Errorf("%w: %w", ErrInvalidHash, err)
+	}
+
+	var pepper []byte
+	if pepperID != "" {
+		var ok bool
+		pepper, ok = h.peppers[pepperID]
+		if !ok {
+			return false, false, ErrPepperMismatch
+		}
+	}
+
+	other := argon2.IDKey(keyed(password, pepper), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, p != h.params || pepperID != h.pepperID, nil
+}
+
+// validate rejects parameters argon2 can not use, and salts and keys too short to
+// be safe.
+func (p Params) validate() error {
+	switch {
+	case p.Iterations < 1:
+		return errors.New("argon2id needs at least 1 iteration")
+	case p.Parallelism < 1:
+		return errors.New("argon2id needs a parallelism of at least 1")
+	case p.Memory < 8*uint32(p.Parallelism):
+		return errors.New("argon2id needs at least 8 KiB of memory per thread")
+	case p.SaltLength < 8:
+		return errors.New("argon2id salts must be at least 8 bytes")
+	case p.KeyLength < 16:
+		return errors.New("argon2id keys must be at least 16 bytes")
+	}
+	return nil
+}
+
+// keyed returns the password keyed with the pepper, or the password without one.
+func keyed(password string, pepper []byte) []byte {
+	if len(pepper) == 0 {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+func parseUint32(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	return uint32(v), err
+}
@@ -0,0 +1,162 @@
+package hasher
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testParams keep the tests fast, they are far too weak for production.
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher_HashAndVerify(t *testing.T) {
+	h := newHasher(t, testParams, nil)
+
+	hash, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^\$argon2id\$v=19\$m=1024,t=1,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`), string(hash))
+
+	ok, rehash, err := h.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = h.Verify(hash, "correct horse battery stapler")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	other, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "hashes are salted")
+}
+
+func TestHasher_LongPasswordsAreNotTruncated(t *testing.T) {
+	h := newHasher(t, testParams, nil)
+	password := strings.Repeat("a", 72)
+
+	hash, err := h.Hash(password + "1")
+	require.NoError(t, err)
+
+	ok, _, err := h.Verify(hash, password+"2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestHasher_Verify_Rehash(t *testing.T) {
+	h := newHasher(t, testParams, nil)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	ok, rehash, err := h.Verify(legacy, "secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash, "bcrypt hashes are upgraded")
+
+	ok, rehash, err = h.Verify(legacy, "wrong")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+
+	weaker := testParams
+	weaker.Memory /= 2
+	old, err := newHasher(t, weaker, nil).Hash("secret")
+	require.NoError(t, err)
+	ok, rehash, err = h.Verify(old, "secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash, "hashes with other parameters are upgraded")
+}
+
+func TestHasher_Pepper(t *testing.T) {
+	unpeppered := newHasher(t, testParams, nil)
+	peppered := newHasher(t, testParams, []byte("pepper"))
+
+	hash, err := peppered.Hash("secret")
+	require.NoError(t, err)
+	assert.Contains(t, string(hash), ",keyid=")
+
+	ok, rehash, err := peppered.Verify(hash, "secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	_, _, err = unpeppered.Verify(hash, "secret")
+	assert.ErrorIs(t, err, ErrPepperMismatch)
+	_, _, err = newHasher(t, testParams, []byte("another pepper")).Verify(hash, "secret")
+	assert.ErrorIs(t, err, ErrPepperMismatch)
+
+	old, err := unpeppered.Hash("secret")
+	require.NoError(t, err)
+	ok, rehash, err = peppered.Verify(old, "secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash, "hashes are peppered once a pepper is configured")
+}
+
+func TestHasher_PepperRotation(t *testing.T) {
+	old := newHasher(t, testParams, []byte("old pepper"))
+	hash, err := old.Hash("secret")
+	require.NoError(t, err)
+
+	rotated, err := New(testParams, []byte("new pepper"), []byte("old pepper"))
+	require.NoError(t, err)
+
+	ok, rehash, err := rotated.Verify(hash, "secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash, "hashes with an old pepper are upgraded")
+
+	ok, _, err = rotated.Verify(hash, "wrong")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	upgraded, err := rotated.Hash("secret")
+	require.NoError(t, err)
+	ok, rehash, err = rotated.Verify(upgraded, "secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	// once the old pepper is dropped, its hashes can not be verified
+	_, _, err = newHasher(t, testParams, []byte("new pepper")).Verify(hash, "secret")
+	assert.ErrorIs(t, err, ErrPepperMismatch)
+}
+
+func TestHasher_Verify_InvalidHashes(t *testing.T) {
+	h := newHasher(t, testParams, nil)
+
+	ok, _, err := h.Verify(nil, "secret")
+	assert.NoError(t, err, "users without a password, e.g. from SSO, match no password")
+	assert.False(t, ok)
+
+	_, _, err = h.Verify([]byte("plaintext"), "secret")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	_, _, err = h.Verify([]byte("$argon2id$v=19$m=1024,t=1$c2FsdA$"), "secret")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+	_, _, err = h.Verify([]byte("$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$aGFzaA"), "secret")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+	ok, _, err = h.Verify([]byte("$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$"), "secret")
+	assert.ErrorIs(t, err, ErrInvalidHash, "an empty key would match any password")
+	assert.False(t, ok)
+}
+
+func TestNew_InvalidParams(t *testing.T) {
+	params := testParams
+	params.Iterations = 0
+	_, err := New(params, nil)
+	assert.Error(t, err)
+
+	params = testParams
+	params.SaltLength = 4
+	_, err = New(params, nil)
+	assert.Error(t, err)
+}
+
+func newHasher(t *testing.T, params Params, pepper []byte) *Hasher {
+	h, err := New(params, pepper)
+	require.NoError(t, err)
+	return h
+}
@@ -0,0 +1,78 @@
+package jwk
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var ErrUnsupportedKey = errors.New("jwk: unsupported key")
+
+// Key is a JSON Web Key (RFC 7517) holding an Ed25519 public key (RFC 8037).
+type Key struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// Set is a JSON Web Key Set.
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// Ed25519 returns the signing JWK of an Ed25519 public key. If kid is empty the
+// RFC 7638 thumbprint of the key is used.
+func Ed25519(kid string, publicKey ed25519.PublicKey) Key {
+	key := Key{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(publicKey),
+		Use:       "sig",
+		Algorithm: "EdDSA",
+	}
+	if kid == "" {
+		kid = key.Thumbprint()
+	}
+	key.KeyID = kid
+
+	return key
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key.
+func (k Key) Thumbprint() string {
+	// members in lexicographic order, without whitespace
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Curve, k.KeyType, k.X)
+	sum := sha256.Sum256([]byte(canonical))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKey returns the Ed25519 public key of the JWK.
+func (k Key) PublicKey() (ed25519.PublicKey, error) {
+	if k.KeyType != "OKP" || k.Curve != "Ed25519" {
+		return nil, ErrUnsupportedKey
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(x) != ed25519.PublicKeySize {
+		return nil, ErrUnsupportedKey
+	}
+
+	return ed25519.PublicKey(x), nil
+}
+
+// Lookup returns the key with the given id.
+func (s Set) Lookup(kid string) (Key, bool) {
+	for _, key := range s.Keys {
+		if key.KeyID == kid {
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
@@ -0,0 +1,57 @@
+package jwk
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// RFC 8037 appendix A.1 and A.3
+const (
+	rfcPublicKey  = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	rfcThumbprint = "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"
+)
+
+func TestEd25519(t *testing.T) {
+	publicKey, err := hex.DecodeString(rfcPublicKey)
+	require.NoError(t, err)
+
+	key := Ed25519("", publicKey)
+	assert.Equal(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", key.X)
+	assert.Equal(t, rfcThumbprint, key.KeyID)
+
+	decoded, err := key.PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, ed25519.PublicKey(publicKey), decoded)
+}
+
+func TestSet_RoundTrip(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	raw, err := json.Marshal(Set{Keys: []Key{Ed25519("key-1", publicKey)}})
+	require.NoError(t, err)
+
+	var set Set
+	require.NoError(t, json.Unmarshal(raw, &set))
+
+	key, ok := set.Lookup("key-1")
+	require.True(t, ok)
+	decoded, err := key.PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, publicKey, decoded)
+
+	_, ok = set.Lookup("key-2")
+	assert.False(t, ok)
+}
+
+func TestPublicKey_Unsupported(t *testing.T) {
+	_, err := Key{KeyType: "EC", Curve: "P-256"}.PublicKey()
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+
+	_, err = Key{KeyType: "OKP", Curve: "Ed25519", X: "c2hvcnQ"}.PublicKey()
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
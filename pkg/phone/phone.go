@@ -0,0 +1,50 @@
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidNumber = errors.New("invalid phone number")
+
+// Normalize converts a phone number to E.164 format. Spaces, dashes, dots and
+// parentheses are ignored and a leading 00 is treated as +. Numbers without a
+// country code are assumed to be in national format: trunkPrefix, if set, is
+// stripped and defaultCountryCode is prepended.
+func Normalize(raw, defaultCountryCode, trunkPrefix string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidNumber
+		}
+	}
+	number := b.String()
+
+	switch {
+	case strings.HasPrefix(number, "+"):
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	default:
+		if defaultCountryCode == "" {
+			return "", ErrInvalidNumber
+		}
+		if trunkPrefix != "" {
+			number = strings.TrimPrefix(number, trunkPrefix)
+		}
+		number = defaultCountryCode + number
+	}
+
+	// E.164 numbers have at most 15 digits and never start with 0
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidNumber
+	}
+
+	return "+" + number, nil
+}
@@ -0,0 +1,35 @@
+package phone
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNormalize_HappyPath(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "+7 701 123 45 67", want: "+77011234567"},
+		{raw: "8 (701) 123-45-67", want: "+77011234567"},
+		{raw: "7011234567", want: "+77011234567"},
+		{raw: "0044 20 7946 0958", want: "+442079460958"},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.raw, "7", "8")
+		require.NoError(t, err, tt.raw)
+		assert.Equal(t, tt.want, got, tt.raw)
+	}
+}
+
+func TestNormalize_FailPath(t *testing.T) {
+	for _, raw := range []string{"", "+7 abc", "12+34567890", "+0123456789", "+1234567890123456"} {
+		_, err := Normalize(raw, "7", "8")
+		assert.ErrorIs(t, err, ErrInvalidNumber, raw)
+	}
+
+	_, err := Normalize("7011234567", "", "")
+	assert.ErrorIs(t, err, ErrInvalidNumber, "national number without default country code")
+}
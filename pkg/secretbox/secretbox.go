@@ -0,0 +1,64 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidKey        = errors.New("secretbox: key must be 32 bytes")
+	ErrInvalidCiphertext = errors.New("secretbox: invalid ciphertext")
+)
+
+// Box encrypts small secrets with AES-256-GCM. The random nonce is stored as the
+// prefix of the ciphertext.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func New(key []byte) (*Box, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: %w", err)
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+func (b *Box) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plaintext)+b.aead.Overhead())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: %w", err)
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (b *Box) Open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < b.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce, sealed := ciphertext[:b.aead.NonceSize()], ciphertext[b.aead.NonceSize():]
+
+	plaintext, err := b.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
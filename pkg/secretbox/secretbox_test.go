@@ -0,0 +1,29 @@
+package secretbox
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	box, err := New(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("secret"))
+	require.NoError(t, err)
+
+	opened, err := box.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), opened)
+
+	sealed[len(sealed)-1] ^= 0xff
+	_, err = box.Open(sealed)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext, "tampered ciphertext must be rejected")
+}
+
+func TestNew_InvalidKey(t *testing.T) {
+	_, err := New([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,61 @@
+// Package apikey generates and parses API keys of the form
+//
+//	uck_<prefix>_<secret>
+//
+// The prefix identifies the key and can be stored and shown in plain text, only a
+// hash of the secret is stored.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	Scheme = "uck"
+
+	prefixSize = 6
+	secretSize = 32
+)
+
+var ErrMalformed = errors.New("malformed api key")
+
+// Generate returns a new key, its prefix and the hash of its secret.
+func Generate() (key string, prefix string, hash []byte, err error) {
+	b := make([]byte, prefixSize+secretSize)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	prefix = hex.EncodeToString(b[:prefixSize])
+	secret := hex.EncodeToString(b[prefixSize:])
+
+	return Scheme + "_" + prefix + "_" + secret, prefix, Hash(secret), nil
+}
+
+// Parse splits a key into its prefix and secret.
+func Parse(key string) (prefix string, secret string, err error) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != Scheme ||
+		len(parts[1]) != hex.EncodedLen(prefixSize) || len(parts[2]) != hex.EncodedLen(secretSize) {
+		return "", "", ErrMalformed
+	}
+
+	return parts[1], parts[2], nil
+}
+
+// Hash returns the hash of a secret. Secrets are random, so a fast hash is enough.
+func Hash(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// Verify reports whether secret matches hash in constant time.
+func Verify(secret string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(Hash(secret), hash) == 1
+}
@@ -0,0 +1,41 @@
+package apikey
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAndParse(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, Scheme+"_"+prefix+"_"))
+
+	parsedPrefix, secret, err := Parse(key)
+	require.NoError(t, err)
+	assert.Equal(t, prefix, parsedPrefix)
+	assert.True(t, Verify(secret, hash))
+	assert.False(t, Verify(secret+"0", hash))
+
+	other, _, _, err := Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestParse_Malformed(t *testing.T) {
+	key, _, _, err := Generate()
+	require.NoError(t, err)
+
+	for _, malformed := range []string{
+		"",
+		"uck",
+		strings.Replace(key, Scheme, "abc", 1),
+		key[:len(key)-1],
+		key + "_extra",
+		strings.TrimPrefix(key, Scheme+"_"),
+	} {
+		_, _, err := Parse(malformed)
+		assert.ErrorIs(t, err, ErrMalformed, malformed)
+	}
+}
@@ -0,0 +1,53 @@
+// Package invite generates invitation codes of the form
+//
+//	XXXX-XXXX-XXXX
+//
+// from an alphabet without easily confused characters, so that codes can be typed
+// by hand. Only a hash of the code is stored.
+package invite
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"strings"
+)
+
+const (
+	alphabet  = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	groups    = 3
+	groupSize = 4
+)
+
+// Generate returns a new code.
+func Generate() (string, error) {
+	b := make([]byte, groups*groupSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i, c := range b {
+		if i > 0 && i%groupSize == 0 {
+			sb.WriteByte('-')
+		}
+		// the alphabet has 32 characters, so every character is equally likely
+		sb.WriteByte(alphabet[int(c)%len(alphabet)])
+	}
+
+	return sb.String(), nil
+}
+
+// Hash returns the hash of a code. Case, spaces and dashes are ignored, so codes can
+// be entered as they are read out.
+func Hash(code string) []byte {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+
+	sum := sha256.Sum256([]byte(normalized))
+	return sum[:]
+}
@@ -0,0 +1,24 @@
+package invite
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	code, err := Generate()
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[A-Z2-9]{4}-[A-Z2-9]{4}-[A-Z2-9]{4}$`), code)
+
+	other, err := Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, code, other)
+}
+
+func TestHash_IgnoresFormatting(t *testing.T) {
+	assert.Equal(t, Hash("ABCD-EFGH-JKLM"), Hash("abcd efgh jklm"))
+	assert.Equal(t, Hash("ABCD-EFGH-JKLM"), Hash("ABCDEFGHJKLM"))
+	assert.NotEqual(t, Hash("ABCD-EFGH-JKLM"), Hash("ABCD-EFGH-JKLN"))
+}
@@ -0,0 +1,21 @@
+package otp
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// GenerateCode returns a random numeric code of the given number of digits.
+func GenerateCode(digits int) (string, error) {
+	code := make([]byte, digits)
+	for i := range code {
+		// Generate cryptographically secure random digits
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+
+	return string(code), nil
+}
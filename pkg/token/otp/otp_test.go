@@ -0,0 +1,17 @@
+package otp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGenerateCode(t *testing.T) {
+	code, err := GenerateCode(6)
+	require.NoError(t, err, "must not return error")
+
+	assert.Len(t, code, 6)
+	for _, r := range code {
+		assert.True(t, r >= '0' && r <= '9', "code must contain only digits")
+	}
+}
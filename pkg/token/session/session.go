@@ -5,8 +5,11 @@ import (
 	"encoding/hex"
 )
 
+// tokenLength is the number of random bytes in a token.
+const tokenLength = 32
+
 func GenerateToken() (string, error) {
-	b := make([]byte, 32)
+	b := make([]byte, tokenLength)
 
 	// Generate cryptographically secure random bytes
 	_, err := rand.Read(b)
@@ -17,3 +20,17 @@ func GenerateToken() (string, error) {
 	// Return the encoded string in hexadecimal format
 	return hex.EncodeToString(b), nil
 }
+
+// Valid reports whether token has the format of the tokens made by GenerateToken,
+// so that other values are rejected before they are looked up.
+func Valid(token string) bool {
+	if len(token) != hex.EncodedLen(tokenLength) {
+		return false
+	}
+	for _, c := range token {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -10,3 +11,14 @@ func TestGenerateSessionToken(t *testing.T) {
 	require.NoError(t, err, "must not return error")
 
 }
+
+func TestValid(t *testing.T) {
+	token, err := GenerateToken()
+	require.NoError(t, err)
+	require.True(t, Valid(token))
+
+	require.False(t, Valid(""))
+	require.False(t, Valid(token[1:]))
+	require.False(t, Valid(strings.ToUpper(token)))
+	require.False(t, Valid("magic_link_requests:attempts:student@astanait.edu.kz"))
+}
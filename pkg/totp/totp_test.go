@@ -0,0 +1,56 @@
+package totp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 test secret from RFC 6238 appendix B.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode_RFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Code(rfcSecret, Step(time.Unix(tt.unix, 0))), tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	step, ok := Validate(rfcSecret, "050471", now, 1)
+	require.True(t, ok, "current code must be valid")
+	assert.Equal(t, Step(now), step)
+
+	previous := Code(rfcSecret, Step(now)-1)
+	step, ok = Validate(rfcSecret, previous, now, 1)
+	require.True(t, ok, "code within skew must be valid")
+	assert.Equal(t, Step(now)-1, step)
+
+	_, ok = Validate(rfcSecret, Code(rfcSecret, Step(now)-2), now, 1)
+	assert.False(t, ok, "code outside skew must be rejected")
+
+	_, ok = Validate(rfcSecret, "12345", now, 1)
+	assert.False(t, ok, "code of wrong length must be rejected")
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("UniClubs", "student@astanait.edu.kz", rfcSecret)
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/UniClubs:student@astanait.edu.kz?"), uri)
+	assert.Contains(t, uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	assert.Contains(t, uri, "issuer=UniClubs")
+}